@@ -5,20 +5,31 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	corebus "github.com/yttydcs/myflowhub-core/eventbus"
 	authsvc "github.com/yttydcs/myflowhub-win/internal/services/auth"
+	bridgesvc "github.com/yttydcs/myflowhub-win/internal/services/bridge"
+	configfleetsvc "github.com/yttydcs/myflowhub-win/internal/services/configfleet"
 	debugsvc "github.com/yttydcs/myflowhub-win/internal/services/debug"
 	filesvc "github.com/yttydcs/myflowhub-win/internal/services/file"
 	flowsvc "github.com/yttydcs/myflowhub-win/internal/services/flow"
+	flowexecsvc "github.com/yttydcs/myflowhub-win/internal/services/flowexec"
+	flowfleetsvc "github.com/yttydcs/myflowhub-win/internal/services/flowfleet"
+	inventorysvc "github.com/yttydcs/myflowhub-win/internal/services/inventory"
+	latencysvc "github.com/yttydcs/myflowhub-win/internal/services/latency"
 	localhubsvc "github.com/yttydcs/myflowhub-win/internal/services/localhub"
 	logssvc "github.com/yttydcs/myflowhub-win/internal/services/logs"
 	mgmtsvc "github.com/yttydcs/myflowhub-win/internal/services/management"
+	mqttbridgesvc "github.com/yttydcs/myflowhub-win/internal/services/mqttbridge"
 	presetssvc "github.com/yttydcs/myflowhub-win/internal/services/presets"
+	recordersvc "github.com/yttydcs/myflowhub-win/internal/services/recorder"
+	schedulersvc "github.com/yttydcs/myflowhub-win/internal/services/scheduler"
 	sessionsvc "github.com/yttydcs/myflowhub-win/internal/services/session"
 	topicbussvc "github.com/yttydcs/myflowhub-win/internal/services/topicbus"
+	topologysvc "github.com/yttydcs/myflowhub-win/internal/services/topology"
 	varpoolsvc "github.com/yttydcs/myflowhub-win/internal/services/varpool"
 	storagesvc "github.com/yttydcs/myflowhub-win/internal/storage"
 )
@@ -34,9 +45,19 @@ type App struct {
 	topicbus     *topicbussvc.TopicBusService
 	file         *filesvc.FileService
 	flow         *flowsvc.FlowService
+	flowfleet    *flowfleetsvc.FlowFleetService
+	flowexec     *flowexecsvc.FlowExecService
 	management   *mgmtsvc.ManagementService
+	topology     *topologysvc.TopologyService
+	configfleet  *configfleetsvc.ConfigFleetService
+	inventory    *inventorysvc.InventoryService
+	latency      *latencysvc.LatencyService
 	debug        *debugsvc.DebugService
 	presets      *presetssvc.PresetService
+	recorder     *recordersvc.RecorderService
+	scheduler    *schedulersvc.SchedulerService
+	bridge       *bridgesvc.BridgeService
+	mqttbridge   *mqttbridgesvc.MQTTBridgeService
 	store        *storagesvc.Store
 	bridgeTokens []busToken
 }
@@ -59,30 +80,87 @@ func NewApp() *App {
 			logs.Appendf("warn", "node keys migration warning: %v", err)
 		}
 	}
+	varpool := varpoolsvc.New(session, logs, bus)
+	topicbus := topicbussvc.New(session, logs, bus)
+	file := filesvc.New(session, logs, store, bus)
+	localhub := localhubsvc.New(store, logs)
+	flow := flowsvc.New(session, logs, store, bus)
+	management := mgmtsvc.New(session, logs, store, bus)
+	topology := topologysvc.New(management, logs, bus)
 	app := &App{
-		bus:        bus,
-		logs:       logs,
-		session:    session,
-		localhub:   localhubsvc.New(store, logs),
-		auth:       authsvc.New(session, logs),
-		varpool:    varpoolsvc.New(session, logs, bus),
-		topicbus:   topicbussvc.New(session, logs, bus),
-		file:       filesvc.New(session, logs, store, bus),
-		flow:       flowsvc.New(session, logs),
-		management: mgmtsvc.New(session, logs, store),
-		debug:      debugsvc.New(session, logs),
-		presets:    presetssvc.New(session, bus),
-		store:      store,
+		bus:         bus,
+		logs:        logs,
+		session:     session,
+		localhub:    localhub,
+		auth:        authsvc.New(session, logs),
+		varpool:     varpool,
+		topicbus:    topicbus,
+		file:        file,
+		flow:        flow,
+		flowfleet:   flowfleetsvc.New(flow, management, logs, bus),
+		flowexec:    flowexecsvc.New(session, varpool, topicbus, file, logs, store, bus),
+		management:  management,
+		topology:    topology,
+		configfleet: configfleetsvc.New(management, logs, store, bus),
+		inventory:   inventorysvc.New(topology, management, logs, store, bus),
+		latency:     latencysvc.New(topology, management, logs, store, bus),
+		debug:       debugsvc.New(session, logs),
+		presets:     presetssvc.New(session, bus),
+		recorder:    recordersvc.New(topicbus, logs, store, bus),
+		scheduler:   schedulersvc.New(topicbus, varpool, logs, store, bus),
+		bridge:      bridgesvc.New(topicbus, varpool, logs, store, bus),
+		mqttbridge:  mqttbridgesvc.New(topicbus, logs, store, bus),
+		store:       store,
 	}
 	if store != nil {
 		current := store.CurrentProfile()
 		app.auth.SetKeysPath(store.NodeKeysPath(current))
 	}
+	app.applyTopicBusCodecs()
+	app.registerNodeInfoProviders()
+	app.auth.OnIdentity(app.flowexec.SetIdentity)
+	app.management.OnConfigChanged("localhub.", app.localhub.ReloadConfig)
+	app.management.OnConfigChanged("topicbus.recorder.", app.recorder.ReloadPrefs)
 	return app
 }
 
+// registerNodeInfoProviders adds client state to the NodeInfo this node
+// reports, for self-queries and for node_info requests from other nodes.
+func (a *App) registerNodeInfoProviders() {
+	if a.management == nil {
+		return
+	}
+	a.management.RegisterInfoProvider("session", func() map[string]string {
+		return map[string]string{
+			"connected": strconv.FormatBool(a.session.IsConnected()),
+			"conn_addr": a.session.LastAddr(),
+		}
+	})
+	a.management.RegisterInfoProvider("file", func() map[string]string {
+		return map[string]string{"file_sessions": strconv.Itoa(a.file.ActiveSessions())}
+	})
+	a.management.RegisterInfoProvider("topicbus", func() map[string]string {
+		return map[string]string{"topic_subscriptions": strconv.Itoa(a.topicbus.SubscriptionCount())}
+	})
+	a.management.RegisterInfoProvider("localhub", func() map[string]string {
+		run := a.localhub.Snapshot().Run
+		items := map[string]string{"localhub_running": strconv.FormatBool(run.Running)}
+		if run.Running {
+			items["localhub_pid"] = strconv.Itoa(run.PID)
+			items["localhub_addr"] = run.Addr
+		}
+		return items
+	})
+	a.management.RegisterInfoProvider("profile", func() map[string]string {
+		if a.store == nil {
+			return nil
+		}
+		return map[string]string{"profile": a.store.CurrentProfile()}
+	})
+}
+
 func (a *App) Bindings() []interface{} {
-	return []interface{}{a, a.logs, a.session, a.localhub, a.auth, a.varpool, a.topicbus, a.file, a.flow, a.management, a.debug, a.presets}
+	return []interface{}{a, a.logs, a.session, a.localhub, a.auth, a.varpool, a.topicbus, a.file, a.flow, a.flowfleet, a.flowexec, a.management, a.topology, a.configfleet, a.inventory, a.latency, a.debug, a.presets, a.recorder, a.scheduler, a.bridge, a.mqttbridge}
 }
 
 func (a *App) Startup(ctx context.Context) {
@@ -96,6 +174,33 @@ func (a *App) Startup(ctx context.Context) {
 func (a *App) Shutdown(ctx context.Context) {
 	_ = ctx
 	a.unbridgeEvents()
+	if a.inventory != nil {
+		a.inventory.Close()
+	}
+	if a.latency != nil {
+		a.latency.Close()
+	}
+	if a.management != nil {
+		a.management.Close()
+	}
+	if a.flowexec != nil {
+		a.flowexec.Close()
+	}
+	if a.flow != nil {
+		a.flow.Close()
+	}
+	if a.mqttbridge != nil {
+		a.mqttbridge.Close()
+	}
+	if a.bridge != nil {
+		a.bridge.Close()
+	}
+	if a.scheduler != nil {
+		a.scheduler.Close()
+	}
+	if a.recorder != nil {
+		a.recorder.Close()
+	}
 	if a.topicbus != nil {
 		a.topicbus.Close()
 	}
@@ -139,6 +244,20 @@ func (a *App) bridgeEvents() {
 	bind(presetssvc.EventTopicStressSender)
 	bind(presetssvc.EventTopicStressReceiver)
 	bind(topicbussvc.EventTopicBusEvent)
+	bind(topicbussvc.EventTopicBusStats)
+	bind(recordersvc.EventRecorderStatus)
+	bind(recordersvc.EventRecorderReplay)
+	bind(schedulersvc.EventSchedulerJob)
+	bind(bridgesvc.EventBridgeStatus)
+	bind(mqttbridgesvc.EventMQTTBridgeStatus)
+	bind(flowsvc.EventFlowRunProgress)
+	bind(flowfleetsvc.EventFlowFleetScan)
+	bind(flowexecsvc.EventFlowExecCall)
+	bind(topologysvc.EventTopologyChanged)
+	bind(configfleetsvc.EventConfigFleetProgress)
+	bind(inventorysvc.EventInventorySweep)
+	bind(latencysvc.EventLatencyProgress)
+	bind(mgmtsvc.EventManagementRemote)
 	bind(varpoolsvc.EventVarPoolChanged)
 	bind(varpoolsvc.EventVarPoolDeleted)
 }
@@ -192,5 +311,21 @@ func (a *App) SetCurrentProfile(name string) (storagesvc.ProfileState, error) {
 	if a.auth != nil {
 		a.auth.SetKeysPath(a.store.NodeKeysPath(current))
 	}
+	a.applyTopicBusCodecs()
+	if a.recorder != nil {
+		a.recorder.ReloadPrefs()
+	}
+	if a.scheduler != nil {
+		a.scheduler.ReloadJobs()
+	}
+	if a.bridge != nil {
+		a.bridge.ReloadRules()
+	}
+	if a.mqttbridge != nil {
+		a.mqttbridge.ReloadConfig()
+	}
+	if a.inventory != nil {
+		a.inventory.ReloadPrefs()
+	}
 	return a.store.State(), nil
 }
@@ -9,12 +9,16 @@ import (
 const (
 	topicBusSubsKey      = "topicbus.subs"
 	topicBusMaxEventsKey = "topicbus.max_events"
+	topicBusCodecsKey    = "topicbus.codecs"
 	defaultTopicBusMax   = 500
 )
 
 type TopicBusPrefs struct {
 	Topics    []string `json:"topics"`
 	MaxEvents int      `json:"maxEvents"`
+	// Codecs maps a topic or pattern to a payload codec name. A nil map leaves
+	// the saved mapping unchanged.
+	Codecs map[string]string `json:"codecs"`
 }
 
 func (a *App) TopicBusPrefs() (TopicBusPrefs, error) {
@@ -28,7 +32,8 @@ func (a *App) TopicBusPrefs() (TopicBusPrefs, error) {
 	if maxEvents <= 0 {
 		maxEvents = defaultTopicBusMax
 	}
-	return TopicBusPrefs{Topics: topics, MaxEvents: maxEvents}, nil
+	codecs := parseTopicBusCodecs(a.store.GetString(profile, topicBusCodecsKey, ""))
+	return TopicBusPrefs{Topics: topics, MaxEvents: maxEvents, Codecs: codecs}, nil
 }
 
 func (a *App) SaveTopicBusPrefs(prefs TopicBusPrefs) (TopicBusPrefs, error) {
@@ -45,13 +50,51 @@ func (a *App) SaveTopicBusPrefs(prefs TopicBusPrefs) (TopicBusPrefs, error) {
 		return TopicBusPrefs{}, err
 	}
 	profile := a.store.CurrentProfile()
+	codecs := prefs.Codecs
+	if codecs == nil {
+		codecs = parseTopicBusCodecs(a.store.GetString(profile, topicBusCodecsKey, ""))
+	} else {
+		if err := a.topicbus.SetTopicCodecs(codecs); err != nil {
+			return TopicBusPrefs{}, err
+		}
+		codecData, err := json.Marshal(codecs)
+		if err != nil {
+			return TopicBusPrefs{}, err
+		}
+		if err := a.store.SetString(profile, topicBusCodecsKey, string(codecData)); err != nil {
+			return TopicBusPrefs{}, err
+		}
+	}
 	if err := a.store.SetString(profile, topicBusSubsKey, string(data)); err != nil {
 		return TopicBusPrefs{}, err
 	}
 	if err := a.store.SetInt(profile, topicBusMaxEventsKey, maxEvents); err != nil {
 		return TopicBusPrefs{}, err
 	}
-	return TopicBusPrefs{Topics: normalized, MaxEvents: maxEvents}, nil
+	return TopicBusPrefs{Topics: normalized, MaxEvents: maxEvents, Codecs: codecs}, nil
+}
+
+// applyTopicBusCodecs loads the per-topic codec mapping of the current profile
+// into the TopicBus service.
+func (a *App) applyTopicBusCodecs() {
+	if a.store == nil || a.topicbus == nil {
+		return
+	}
+	codecs := parseTopicBusCodecs(a.store.GetString(a.store.CurrentProfile(), topicBusCodecsKey, ""))
+	if err := a.topicbus.SetTopicCodecs(codecs); err != nil && a.logs != nil {
+		a.logs.Appendf("warn", "topicbus codecs ignored: %v", err)
+		_ = a.topicbus.SetTopicCodecs(nil)
+	}
+}
+
+func parseTopicBusCodecs(raw string) map[string]string {
+	out := map[string]string{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return out
+	}
+	_ = json.Unmarshal([]byte(raw), &out)
+	return out
 }
 
 func parseTopicBusTopics(raw string) []string {
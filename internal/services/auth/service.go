@@ -28,6 +28,9 @@ type AuthService struct {
 	nodePriv *ecdsa.PrivateKey
 	nodePub  string
 	keysPath string
+
+	identityMu sync.Mutex
+	onIdentity func(nodeID, hubID uint32)
 }
 
 func New(session *sessionsvc.SessionService, logsSvc *logs.LogService) *AuthService {
@@ -49,6 +52,23 @@ func (s *AuthService) SetKeysPath(path string) {
 	s.keyMu.Unlock()
 }
 
+// OnIdentity registers fn to run with the node and hub IDs after every
+// successful register or login.
+func (s *AuthService) OnIdentity(fn func(nodeID, hubID uint32)) {
+	s.identityMu.Lock()
+	s.onIdentity = fn
+	s.identityMu.Unlock()
+}
+
+func (s *AuthService) notifyIdentity(resp auth.RespData) {
+	s.identityMu.Lock()
+	fn := s.onIdentity
+	s.identityMu.Unlock()
+	if fn != nil && resp.NodeID != 0 {
+		fn(resp.NodeID, resp.HubID)
+	}
+}
+
 func (s *AuthService) KeysPath() string {
 	s.keyMu.Lock()
 	defer s.keyMu.Unlock()
@@ -93,6 +113,7 @@ func (s *AuthService) Register(ctx context.Context, sourceID, targetID uint32, d
 		return auth.RespData{}, err
 	}
 	s.logs.Appendf("info", "auth register ok device=%s node=%d hub=%d role=%s", deviceID, resp.NodeID, resp.HubID, resp.Role)
+	s.notifyIdentity(resp)
 	return resp, nil
 }
 
@@ -124,6 +145,7 @@ func (s *AuthService) Login(ctx context.Context, sourceID, targetID uint32, devi
 		return auth.RespData{}, err
 	}
 	s.logs.Appendf("info", "auth login ok device=%s node=%d hub=%d role=%s", deviceID, resp.NodeID, resp.HubID, resp.Role)
+	s.notifyIdentity(resp)
 	return resp, nil
 }
 
@@ -0,0 +1,50 @@
+package bridge
+
+import "time"
+
+const EventBridgeStatus = "bridge.status"
+
+const (
+	DirectionTopicToVar = "topic_to_var"
+	DirectionVarToTopic = "var_to_topic"
+)
+
+// Rule maps TopicBus messages into VarPool variables (topic_to_var) or
+// VarPool changes into TopicBus messages (var_to_topic).
+//
+// topic_to_var: messages on Topic (a pattern) whose publish name equals Name
+// (any name when empty) are reduced with Path, a JSONPath such as
+// $.sensors[0].temp, and written to VarName owned by VarOwner.
+//
+// var_to_topic: changes of VarName owned by VarOwner (any owner when 0) are
+// published on Topic with publish name Name. Wrap publishes
+// {"name","owner","value"} instead of the bare value. Changes are only seen
+// for variables subscribed or polled through VarPool.
+type Rule struct {
+	ID         string `json:"id"`
+	Label      string `json:"label"`
+	Direction  string `json:"direction"`
+	Enabled    bool   `json:"enabled"`
+	SourceID   uint32 `json:"sourceId"`
+	TargetID   uint32 `json:"targetId"`
+	Topic      string `json:"topic"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	VarName    string `json:"varName"`
+	VarOwner   uint32 `json:"varOwner"`
+	Visibility string `json:"visibility"`
+	VarType    string `json:"varType"`
+	Wrap       bool   `json:"wrap"`
+}
+
+type RuleStatus struct {
+	ID        string    `json:"id"`
+	Enabled   bool      `json:"enabled"`
+	Forwarded int       `json:"forwarded"`
+	Unchanged int       `json:"unchanged"`
+	Looped    int       `json:"looped"`
+	Errors    int       `json:"errors"`
+	LastValue string    `json:"lastValue,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	LastAt    time.Time `json:"lastAt"`
+}
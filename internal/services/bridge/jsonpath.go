@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is one segment of a JSONPath: an object key or an array index.
+type pathStep struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// parsePath accepts the subset of JSONPath needed to pick one value:
+// $, .key, ['key'] / ["key"] and [n]. An empty path selects the whole payload.
+func parsePath(path string) ([]pathStep, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	var steps []pathStep
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			if end == 0 {
+				return nil, errors.New("empty key in path")
+			}
+			steps = append(steps, pathStep{key: path[:end]})
+			path = path[end:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, errors.New("unterminated [ in path")
+			}
+			inner := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid index %q", inner)
+			}
+			steps = append(steps, pathStep{index: n, isIdx: true})
+		default:
+			return nil, fmt.Errorf("unexpected %q in path", path[0])
+		}
+	}
+	return steps, nil
+}
+
+// extractPath returns the selected value as variable text: strings unquoted,
+// everything else as compact JSON.
+func extractPath(payload json.RawMessage, steps []pathStep) (string, error) {
+	cur := payload
+	for _, step := range steps {
+		if step.isIdx {
+			var arr []json.RawMessage
+			if err := json.Unmarshal(cur, &arr); err != nil {
+				return "", errors.New("path expects an array")
+			}
+			if step.index >= len(arr) {
+				return "", fmt.Errorf("index %d out of range", step.index)
+			}
+			cur = arr[step.index]
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(cur, &obj); err != nil || obj == nil {
+			return "", errors.New("path expects an object")
+		}
+		next, ok := obj[step.key]
+		if !ok {
+			return "", fmt.Errorf("key %q not found", step.key)
+		}
+		cur = next
+	}
+	var text string
+	if err := json.Unmarshal(cur, &text); err == nil {
+		return text, nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, cur); err != nil {
+		return "", errors.New("payload is not valid JSON")
+	}
+	return compact.String(), nil
+}
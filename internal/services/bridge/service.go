@@ -0,0 +1,565 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-proto/protocol/varstore"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	topicbussvc "github.com/yttydcs/myflowhub-win/internal/services/topicbus"
+	varpoolsvc "github.com/yttydcs/myflowhub-win/internal/services/varpool"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	cfgBridgeRules = "bridge.rules"
+
+	defaultBridgeTimeout = 8 * time.Second
+	defaultVisibility    = "public"
+	defaultPublishName   = "bridge"
+	// A message produced by the bridge that comes back within loopWindow is
+	// recognised as its own echo and not forwarded again.
+	loopWindow     = 5 * time.Second
+	statusEmitTick = 300 * time.Millisecond
+	// maxQueuedJobs bounds the writes waiting behind a slow rule; the oldest
+	// one is dropped when it is exceeded.
+	maxQueuedJobs = 256
+)
+
+type BridgeService struct {
+	topicbus *topicbussvc.TopicBusService
+	varpool  *varpoolsvc.VarPoolService
+	logs     *logs.LogService
+	store    *storage.Store
+	bus      eventbus.IBus
+
+	mu        sync.Mutex
+	rules     []Rule
+	paths     map[string][]pathStep
+	status    map[string]*RuleStatus
+	produced  map[string]time.Time
+	queues    map[string][]func()
+	lastEmit  time.Time
+	busTokens []busToken
+}
+
+type busToken struct {
+	name  string
+	token string
+}
+
+func New(topicbus *topicbussvc.TopicBusService, varpool *varpoolsvc.VarPoolService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *BridgeService {
+	svc := &BridgeService{topicbus: topicbus, varpool: varpool, logs: logsSvc, store: store, bus: bus}
+	svc.ReloadRules()
+	svc.bindBus()
+	return svc
+}
+
+func (s *BridgeService) Close() {
+	s.unbindBus()
+}
+
+func (s *BridgeService) Rules() ([]Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Rule(nil), s.rules...), nil
+}
+
+// SaveRule creates a rule (empty ID) or replaces an existing one.
+func (s *BridgeService) SaveRule(rule Rule) (Rule, error) {
+	normalized, steps, err := normalizeRule(rule)
+	if err != nil {
+		return Rule{}, err
+	}
+	if normalized.ID == "" {
+		if normalized.ID, err = newRuleID(); err != nil {
+			return Rule{}, err
+		}
+	}
+	s.mu.Lock()
+	replaced := false
+	for i := range s.rules {
+		if s.rules[i].ID == normalized.ID {
+			s.rules[i] = normalized
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.rules = append(s.rules, normalized)
+	}
+	s.paths[normalized.ID] = steps
+	s.statusLocked(normalized.ID).Enabled = normalized.Enabled
+	err = s.persistLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return Rule{}, err
+	}
+	s.emitStatus(true)
+	return normalized, nil
+}
+
+func (s *BridgeService) DeleteRule(id string) error {
+	id = strings.TrimSpace(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.rules {
+		if s.rules[i].ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			delete(s.paths, id)
+			delete(s.status, id)
+			return s.persistLocked()
+		}
+	}
+	return errors.New("rule not found")
+}
+
+func (s *BridgeService) SetRuleEnabled(id string, enabled bool) (Rule, error) {
+	id = strings.TrimSpace(id)
+	s.mu.Lock()
+	for i := range s.rules {
+		if s.rules[i].ID != id {
+			continue
+		}
+		s.rules[i].Enabled = enabled
+		s.statusLocked(id).Enabled = enabled
+		rule := s.rules[i]
+		err := s.persistLocked()
+		s.mu.Unlock()
+		if err != nil {
+			return Rule{}, err
+		}
+		if s.logs != nil {
+			s.logs.Appendf("info", "bridge rule %s enabled=%t", id, enabled)
+		}
+		s.emitStatus(true)
+		return rule, nil
+	}
+	s.mu.Unlock()
+	return Rule{}, errors.New("rule not found")
+}
+
+func (s *BridgeService) Status() ([]RuleStatus, error) {
+	return s.statusSnapshot(), nil
+}
+
+// ReloadRules re-reads the rules after a profile switch. Counters restart.
+func (s *BridgeService) ReloadRules() {
+	rules := s.loadRules()
+	s.mu.Lock()
+	s.rules = nil
+	s.paths = make(map[string][]pathStep, len(rules))
+	s.status = make(map[string]*RuleStatus, len(rules))
+	s.produced = make(map[string]time.Time)
+	for _, rule := range rules {
+		normalized, steps, err := normalizeRule(rule)
+		if err != nil || normalized.ID == "" {
+			if s.logs != nil {
+				s.logs.Appendf("warn", "bridge rule %q ignored: %v", rule.ID, err)
+			}
+			continue
+		}
+		s.rules = append(s.rules, normalized)
+		s.paths[normalized.ID] = steps
+		s.statusLocked(normalized.ID).Enabled = normalized.Enabled
+	}
+	s.mu.Unlock()
+	s.emitStatus(true)
+}
+
+func (s *BridgeService) bindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	addToken := func(name string, handler func(evt any)) {
+		token := s.bus.Subscribe(name, func(_ context.Context, evt eventbus.Event) {
+			if handler == nil {
+				return
+			}
+			handler(evt.Data)
+		})
+		if token != "" {
+			s.busTokens = append(s.busTokens, busToken{name: name, token: token})
+		}
+	}
+	addToken(topicbussvc.EventTopicBusEvent, func(data any) {
+		evt, ok := data.(topicbussvc.TopicBusEvent)
+		if !ok {
+			return
+		}
+		s.handleTopic(evt)
+	})
+	addToken(varpoolsvc.EventVarPoolChanged, func(data any) {
+		resp, ok := data.(varstore.VarResp)
+		if !ok {
+			return
+		}
+		s.handleVar(resp)
+	})
+}
+
+func (s *BridgeService) unbindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	for _, entry := range s.busTokens {
+		if entry.token == "" {
+			continue
+		}
+		s.bus.Unsubscribe(entry.name, entry.token)
+	}
+	s.busTokens = nil
+}
+
+type topicJob struct {
+	rule  Rule
+	value string
+}
+
+func (s *BridgeService) handleTopic(evt topicbussvc.TopicBusEvent) {
+	payload := evt.Decoded
+	if len(payload) == 0 {
+		payload = evt.Payload
+	}
+	s.mu.Lock()
+	if s.consumeProducedLocked(topicKey(evt.Topic, evt.Name, evt.Payload)) {
+		s.countLoopedLocked(DirectionTopicToVar, evt.Topic)
+		s.mu.Unlock()
+		return
+	}
+	var jobs []topicJob
+	for _, rule := range s.rules {
+		if !rule.Enabled || rule.Direction != DirectionTopicToVar {
+			continue
+		}
+		if rule.Name != "" && rule.Name != evt.Name {
+			continue
+		}
+		if !topicbussvc.MatchTopic(rule.Topic, evt.Topic) {
+			continue
+		}
+		st := s.statusLocked(rule.ID)
+		value, err := extractPath(payload, s.paths[rule.ID])
+		if err != nil {
+			st.Errors++
+			st.LastError = err.Error()
+			st.LastAt = time.Now()
+			continue
+		}
+		if st.Forwarded > 0 && st.LastValue == value {
+			st.Unchanged++
+			continue
+		}
+		jobs = append(jobs, topicJob{rule: rule, value: value})
+	}
+	s.mu.Unlock()
+	for _, job := range jobs {
+		s.enqueue(job.rule.ID, func() { s.applyTopicRule(job.rule, job.value) })
+	}
+	s.emitStatus(false)
+}
+
+func (s *BridgeService) applyTopicRule(rule Rule, value string) {
+	if s.varpool == nil {
+		s.recordResult(rule.ID, value, errors.New("varpool not available"))
+		return
+	}
+	owner := rule.VarOwner
+	if owner == 0 {
+		owner = rule.SourceID
+	}
+	s.mu.Lock()
+	s.markProducedLocked(varKey(owner, rule.VarName, value))
+	s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultBridgeTimeout)
+	defer cancel()
+	_, err := s.varpool.Set(ctx, rule.SourceID, rule.TargetID, varstore.SetReq{
+		Name:       rule.VarName,
+		Value:      value,
+		Visibility: rule.Visibility,
+		Type:       rule.VarType,
+		Owner:      rule.VarOwner,
+	})
+	s.recordResult(rule.ID, value, err)
+}
+
+func (s *BridgeService) handleVar(resp varstore.VarResp) {
+	s.mu.Lock()
+	if s.consumeProducedLocked(varKey(resp.Owner, resp.Name, resp.Value)) {
+		s.countLoopedLocked(DirectionVarToTopic, resp.Name)
+		s.mu.Unlock()
+		return
+	}
+	var rules []Rule
+	for _, rule := range s.rules {
+		if !rule.Enabled || rule.Direction != DirectionVarToTopic {
+			continue
+		}
+		if rule.VarName != resp.Name || (rule.VarOwner != 0 && rule.VarOwner != resp.Owner) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	s.mu.Unlock()
+	for _, rule := range rules {
+		s.enqueue(rule.ID, func() { s.applyVarRule(rule, resp) })
+	}
+}
+
+func (s *BridgeService) applyVarRule(rule Rule, resp varstore.VarResp) {
+	if s.topicbus == nil {
+		s.recordResult(rule.ID, resp.Value, errors.New("topicbus not available"))
+		return
+	}
+	// The echo arrives in wire form, so the key is taken after the topic codec.
+	payload, err := s.topicbus.EncodePayload(rule.Topic, string(varPayload(rule, resp)))
+	if err != nil {
+		s.recordResult(rule.ID, resp.Value, err)
+		return
+	}
+	s.mu.Lock()
+	s.markProducedLocked(topicKey(rule.Topic, rule.Name, payload))
+	s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultBridgeTimeout)
+	defer cancel()
+	err = s.topicbus.PublishRaw(ctx, rule.SourceID, rule.TargetID, rule.Topic, rule.Name, payload)
+	s.recordResult(rule.ID, resp.Value, err)
+}
+
+// varPayload renders a variable as a message: JSON values pass through, other
+// text becomes a JSON string.
+func varPayload(rule Rule, resp varstore.VarResp) json.RawMessage {
+	value := json.RawMessage(resp.Value)
+	if !json.Valid(value) || strings.TrimSpace(resp.Value) == "" {
+		value, _ = json.Marshal(resp.Value)
+	}
+	if !rule.Wrap {
+		return value
+	}
+	out, _ := json.Marshal(map[string]any{"name": resp.Name, "owner": resp.Owner, "value": value})
+	return out
+}
+
+// enqueue runs job after the earlier jobs of the same rule, so updates are
+// forwarded in the order they arrived. A worker runs per rule while it has
+// jobs queued.
+func (s *BridgeService) enqueue(ruleID string, job func()) {
+	s.mu.Lock()
+	if s.queues == nil {
+		s.queues = make(map[string][]func())
+	}
+	queue, running := s.queues[ruleID]
+	if len(queue) >= maxQueuedJobs {
+		queue = queue[1:]
+		st := s.statusLocked(ruleID)
+		st.Errors++
+		st.LastError = "queue full, oldest update dropped"
+	}
+	s.queues[ruleID] = append(queue, job)
+	s.mu.Unlock()
+	if !running {
+		go s.drainQueue(ruleID)
+	}
+}
+
+func (s *BridgeService) drainQueue(ruleID string) {
+	for {
+		s.mu.Lock()
+		queue := s.queues[ruleID]
+		if len(queue) == 0 {
+			delete(s.queues, ruleID)
+			s.mu.Unlock()
+			return
+		}
+		job := queue[0]
+		s.queues[ruleID] = queue[1:]
+		s.mu.Unlock()
+		job()
+	}
+}
+
+func (s *BridgeService) recordResult(id, value string, err error) {
+	s.mu.Lock()
+	st := s.statusLocked(id)
+	st.LastAt = time.Now()
+	if err != nil {
+		st.Errors++
+		st.LastError = err.Error()
+	} else {
+		st.Forwarded++
+		st.LastValue = value
+		st.LastError = ""
+	}
+	s.mu.Unlock()
+	if err != nil && s.logs != nil {
+		s.logs.Appendf("warn", "bridge rule %s failed: %v", id, err)
+	}
+	s.emitStatus(err != nil)
+}
+
+func (s *BridgeService) markProducedLocked(key string) {
+	now := time.Now()
+	for k, at := range s.produced {
+		if now.Sub(at) > loopWindow {
+			delete(s.produced, k)
+		}
+	}
+	s.produced[key] = now
+}
+
+func (s *BridgeService) consumeProducedLocked(key string) bool {
+	at, ok := s.produced[key]
+	if !ok {
+		return false
+	}
+	delete(s.produced, key)
+	return time.Since(at) <= loopWindow
+}
+
+// countLoopedLocked charges a suppressed echo to the rules that would have
+// forwarded it.
+func (s *BridgeService) countLoopedLocked(direction, subject string) {
+	for _, rule := range s.rules {
+		if rule.Direction != direction || !rule.Enabled {
+			continue
+		}
+		if (direction == DirectionTopicToVar && topicbussvc.MatchTopic(rule.Topic, subject)) ||
+			(direction == DirectionVarToTopic && rule.VarName == subject) {
+			s.statusLocked(rule.ID).Looped++
+		}
+	}
+}
+
+func (s *BridgeService) statusLocked(id string) *RuleStatus {
+	st := s.status[id]
+	if st == nil {
+		st = &RuleStatus{ID: id}
+		s.status[id] = st
+	}
+	return st
+}
+
+func (s *BridgeService) statusSnapshot() []RuleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]RuleStatus, 0, len(s.rules))
+	for _, rule := range s.rules {
+		out = append(out, *s.statusLocked(rule.ID))
+	}
+	return out
+}
+
+func (s *BridgeService) emitStatus(force bool) {
+	if s == nil || s.bus == nil {
+		return
+	}
+	s.mu.Lock()
+	if !force && !s.lastEmit.IsZero() && time.Since(s.lastEmit) < statusEmitTick {
+		s.mu.Unlock()
+		return
+	}
+	s.lastEmit = time.Now()
+	s.mu.Unlock()
+	_ = s.bus.Publish(context.Background(), EventBridgeStatus, s.statusSnapshot(), nil)
+}
+
+func (s *BridgeService) persistLocked() error {
+	if s.store == nil {
+		return errors.New("storage not initialized")
+	}
+	data, err := json.Marshal(s.rules)
+	if err != nil {
+		return err
+	}
+	return s.store.SetString(s.store.CurrentProfile(), cfgBridgeRules, string(data))
+}
+
+func (s *BridgeService) loadRules() []Rule {
+	if s == nil || s.store == nil {
+		return nil
+	}
+	raw := strings.TrimSpace(s.store.GetString(s.store.CurrentProfile(), cfgBridgeRules, ""))
+	if raw == "" {
+		return nil
+	}
+	var rules []Rule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "bridge rules ignored: %v", err)
+		}
+		return nil
+	}
+	return rules
+}
+
+func normalizeRule(rule Rule) (Rule, []pathStep, error) {
+	rule.ID = strings.TrimSpace(rule.ID)
+	rule.Label = strings.TrimSpace(rule.Label)
+	rule.Direction = strings.TrimSpace(rule.Direction)
+	rule.Topic = strings.TrimSpace(rule.Topic)
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Path = strings.TrimSpace(rule.Path)
+	rule.VarName = strings.TrimSpace(rule.VarName)
+	rule.Visibility = strings.TrimSpace(rule.Visibility)
+	rule.VarType = strings.TrimSpace(rule.VarType)
+	if rule.Topic == "" {
+		return Rule{}, nil, errors.New("topic is required")
+	}
+	if rule.VarName == "" {
+		return Rule{}, nil, errors.New("variable name is required")
+	}
+	var steps []pathStep
+	switch rule.Direction {
+	case DirectionTopicToVar:
+		if err := topicbussvc.ValidatePattern(rule.Topic); err != nil {
+			return Rule{}, nil, fmt.Errorf("topic: %w", err)
+		}
+		var err error
+		if steps, err = parsePath(rule.Path); err != nil {
+			return Rule{}, nil, fmt.Errorf("path: %w", err)
+		}
+		if rule.Visibility == "" {
+			rule.Visibility = defaultVisibility
+		}
+	case DirectionVarToTopic:
+		if topicbussvc.IsPattern(rule.Topic) {
+			return Rule{}, nil, errors.New("topic must not contain wildcards")
+		}
+		if rule.Name == "" {
+			rule.Name = defaultPublishName
+		}
+	default:
+		return Rule{}, nil, fmt.Errorf("unknown direction %q", rule.Direction)
+	}
+	return rule, steps, nil
+}
+
+func topicKey(topic, name string, payload json.RawMessage) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, payload); err == nil {
+		payload = compact.Bytes()
+	}
+	return "topic|" + topic + "|" + name + "|" + string(payload)
+}
+
+func varKey(owner uint32, name, value string) string {
+	return "var|" + strconv.FormatUint(uint64(owner), 10) + "|" + name + "|" + value
+}
+
+func newRuleID() (string, error) {
+	var buf [6]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return "rule-" + hex.EncodeToString(buf[:]), nil
+}
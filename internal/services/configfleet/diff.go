@@ -0,0 +1,208 @@
+package configfleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DesiredFormat  = "myflowhub-config"
+	DesiredVersion = 1
+)
+
+// DiffSnapshots compares two snapshots key by key. Keys only in the right
+// snapshot are "added", keys only in the left are "removed".
+func (s *ConfigFleetService) DiffSnapshots(leftID, rightID string) (ConfigDiff, error) {
+	left, err := s.LoadSnapshot(leftID)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	right, err := s.LoadSnapshot(rightID)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	diff := DiffValues(left.Values, right.Values)
+	diff.Left = snapshotLabel(left)
+	diff.Right = snapshotLabel(right)
+	return diff, nil
+}
+
+// DiffDesired compares a snapshot against the desired-state file at path.
+// Only keys named by the file are checked: the config protocol cannot delete
+// keys, so extra keys on the node are not drift.
+func (s *ConfigFleetService) DiffDesired(snapshotID, path string) (ConfigDiff, error) {
+	snap, err := s.LoadSnapshot(snapshotID)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	desired, err := LoadDesired(path)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	want := desired.ValuesFor(snap.NodeID)
+	diff := ConfigDiff{Left: snapshotLabel(snap), Right: path, Changes: []ConfigDiffEntry{}}
+	for _, key := range sortedKeys(want) {
+		have, ok := snap.Values[key]
+		switch {
+		case !ok:
+			diff.Changes = append(diff.Changes, ConfigDiffEntry{Key: key, Status: DiffMissing, Right: want[key]})
+		case have != want[key]:
+			diff.Changes = append(diff.Changes, ConfigDiffEntry{Key: key, Status: DiffChanged, Left: have, Right: want[key]})
+		default:
+			diff.Same++
+		}
+	}
+	return diff, nil
+}
+
+// DiffValues compares two key/value sets.
+func DiffValues(left, right map[string]string) ConfigDiff {
+	diff := ConfigDiff{Changes: []ConfigDiffEntry{}}
+	keys := make(map[string]struct{}, len(left)+len(right))
+	for key := range left {
+		keys[key] = struct{}{}
+	}
+	for key := range right {
+		keys[key] = struct{}{}
+	}
+	ordered := make([]string, 0, len(keys))
+	for key := range keys {
+		ordered = append(ordered, key)
+	}
+	sort.Strings(ordered)
+	for _, key := range ordered {
+		l, inLeft := left[key]
+		r, inRight := right[key]
+		switch {
+		case !inLeft:
+			diff.Changes = append(diff.Changes, ConfigDiffEntry{Key: key, Status: DiffAdded, Right: r})
+		case !inRight:
+			diff.Changes = append(diff.Changes, ConfigDiffEntry{Key: key, Status: DiffRemoved, Left: l})
+		case l != r:
+			diff.Changes = append(diff.Changes, ConfigDiffEntry{Key: key, Status: DiffChanged, Left: l, Right: r})
+		default:
+			diff.Same++
+		}
+	}
+	return diff
+}
+
+// LoadDesired reads and validates a desired-state file.
+func LoadDesired(path string) (DesiredConfig, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return DesiredConfig{}, errors.New("path is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DesiredConfig{}, err
+	}
+	return ParseDesired(data)
+}
+
+func ParseDesired(data []byte) (DesiredConfig, error) {
+	var desired DesiredConfig
+	if err := json.Unmarshal(data, &desired); err != nil {
+		return DesiredConfig{}, fmt.Errorf("desired state: %w", err)
+	}
+	if desired.Format != "" && desired.Format != DesiredFormat {
+		return DesiredConfig{}, fmt.Errorf("desired state: unexpected format %q", desired.Format)
+	}
+	if desired.Version > DesiredVersion {
+		return DesiredConfig{}, fmt.Errorf("desired state: unsupported version %d", desired.Version)
+	}
+	if err := validateValues(desired.Values); err != nil {
+		return DesiredConfig{}, fmt.Errorf("desired state values: %w", err)
+	}
+	for node, values := range desired.Nodes {
+		if _, err := parseNodeID(node); err != nil {
+			return DesiredConfig{}, fmt.Errorf("desired state nodes: %w", err)
+		}
+		if err := validateValues(values); err != nil {
+			return DesiredConfig{}, fmt.Errorf("desired state node %s: %w", node, err)
+		}
+	}
+	if len(desired.Values) == 0 && len(desired.Nodes) == 0 {
+		return DesiredConfig{}, errors.New("desired state is empty")
+	}
+	return desired, nil
+}
+
+// ValuesFor merges the shared values with the overrides for nodeID.
+func (d DesiredConfig) ValuesFor(nodeID uint32) map[string]string {
+	return mergeValues(d.Values, d.Nodes, nodeID)
+}
+
+// NodeIDs returns the nodes that have overrides, in ascending order.
+func (d DesiredConfig) NodeIDs() []uint32 {
+	return overrideNodes(d.Nodes)
+}
+
+func mergeValues(shared map[string]string, perNode map[string]map[string]string, nodeID uint32) map[string]string {
+	out := make(map[string]string, len(shared))
+	for key, value := range shared {
+		out[key] = value
+	}
+	for node, values := range perNode {
+		id, err := parseNodeID(node)
+		if err != nil || id != nodeID {
+			continue
+		}
+		for key, value := range values {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+func overrideNodes(perNode map[string]map[string]string) []uint32 {
+	out := make([]uint32, 0, len(perNode))
+	for node := range perNode {
+		if id, err := parseNodeID(node); err == nil {
+			out = append(out, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func validateValues(values map[string]string) error {
+	for key := range values {
+		if strings.TrimSpace(key) == "" {
+			return errors.New("empty key")
+		}
+		if strings.TrimSpace(key) != key {
+			return fmt.Errorf("key %q has surrounding spaces", key)
+		}
+	}
+	return nil
+}
+
+func parseNodeID(raw string) (uint32, error) {
+	id, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid node id %q", raw)
+	}
+	return uint32(id), nil
+}
+
+func snapshotLabel(snap ConfigSnapshot) string {
+	if snap.Label != "" {
+		return fmt.Sprintf("node %d (%s)", snap.NodeID, snap.Label)
+	}
+	return fmt.Sprintf("node %d %s %s", snap.NodeID, snap.Kind, snap.ID)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,121 @@
+package configfleet
+
+const EventConfigFleetProgress = "configfleet.progress"
+
+const (
+	SnapshotKindManual = "snapshot"
+	SnapshotKindBackup = "backup"
+)
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+	DiffMissing = "missing"
+)
+
+const (
+	KeyPlanned   = "planned"
+	KeyChanged   = "changed"
+	KeyUnchanged = "unchanged"
+	KeyFailed    = "failed"
+)
+
+// ConfigSnapshot is every key of one node at one point in time. KeyErrors
+// lists keys that were listed but could not be read.
+type ConfigSnapshot struct {
+	ID        string            `json:"id"`
+	NodeID    uint32            `json:"nodeId"`
+	Kind      string            `json:"kind"`
+	Label     string            `json:"label,omitempty"`
+	TakenAt   int64             `json:"takenAt"`
+	Values    map[string]string `json:"values"`
+	KeyErrors map[string]string `json:"keyErrors,omitempty"`
+}
+
+type SnapshotInfo struct {
+	ID      string `json:"id"`
+	NodeID  uint32 `json:"nodeId"`
+	Kind    string `json:"kind"`
+	Label   string `json:"label,omitempty"`
+	TakenAt int64  `json:"takenAt"`
+	Keys    int    `json:"keys"`
+}
+
+type NodeError struct {
+	NodeID uint32 `json:"nodeId"`
+	Error  string `json:"error"`
+}
+
+type SnapshotResult struct {
+	Snapshots []ConfigSnapshot `json:"snapshots"`
+	Failed    []NodeError      `json:"failed"`
+}
+
+type ConfigDiffEntry struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Left   string `json:"left,omitempty"`
+	Right  string `json:"right,omitempty"`
+}
+
+type ConfigDiff struct {
+	Left    string            `json:"left"`
+	Right   string            `json:"right"`
+	Same    int               `json:"same"`
+	Changes []ConfigDiffEntry `json:"changes"`
+}
+
+// DesiredConfig is a desired-state file. Values apply to every node and
+// Nodes holds per-node overrides keyed by node ID.
+type DesiredConfig struct {
+	Format  string                       `json:"format"`
+	Version int                          `json:"version"`
+	Values  map[string]string            `json:"values"`
+	Nodes   map[string]map[string]string `json:"nodes,omitempty"`
+}
+
+// ChangeSet sets Values on every node in Nodes, plus NodeValues overrides
+// keyed by node ID. A backup snapshot of each node is taken before its first
+// write; DryRun only reads current values and reports the plan.
+type ChangeSet struct {
+	Nodes       []uint32                     `json:"nodes"`
+	Values      map[string]string            `json:"values"`
+	NodeValues  map[string]map[string]string `json:"nodeValues,omitempty"`
+	Concurrency int                          `json:"concurrency"`
+	DryRun      bool                         `json:"dryRun"`
+}
+
+type KeyResult struct {
+	Key     string `json:"key"`
+	Status  string `json:"status"`
+	Before  string `json:"before,omitempty"`
+	After   string `json:"after"`
+	Existed bool   `json:"existed"`
+	Error   string `json:"error,omitempty"`
+}
+
+type NodeApplyResult struct {
+	NodeID     uint32      `json:"nodeId"`
+	OK         bool        `json:"ok"`
+	Error      string      `json:"error,omitempty"`
+	BackupID   string      `json:"backupId,omitempty"`
+	Keys       []KeyResult `json:"keys"`
+	DurationMs int64       `json:"durationMs"`
+}
+
+type ApplyReport struct {
+	DryRun     bool              `json:"dryRun"`
+	OK         int               `json:"ok"`
+	Failed     int               `json:"failed"`
+	StartedAt  int64             `json:"startedAt"`
+	DurationMs int64             `json:"durationMs"`
+	Nodes      []NodeApplyResult `json:"nodes"`
+}
+
+type ProgressEvent struct {
+	Op     string `json:"op"`
+	NodeID uint32 `json:"nodeId"`
+	Done   int    `json:"done"`
+	Total  int    `json:"total"`
+}
@@ -0,0 +1,348 @@
+package configfleet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	mgmtsvc "github.com/yttydcs/myflowhub-win/internal/services/management"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	defaultCallTimeout  = 8 * time.Second
+	defaultFleetTimeout = 2 * time.Minute
+	defaultConcurrency  = 4
+	maxConcurrency      = 16
+)
+
+// ConfigFleetService snapshots, diffs and applies config across many nodes
+// on top of the single-key management calls.
+type ConfigFleetService struct {
+	management *mgmtsvc.ManagementService
+	logs       *logs.LogService
+	store      *storage.Store
+	bus        eventbus.IBus
+
+	mu sync.Mutex
+}
+
+func New(management *mgmtsvc.ManagementService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *ConfigFleetService {
+	return &ConfigFleetService{management: management, logs: logsSvc, store: store, bus: bus}
+}
+
+// Snapshot reads every key of each node and stores one snapshot per node.
+// Nodes that cannot be listed are reported in Failed.
+func (s *ConfigFleetService) Snapshot(ctx context.Context, sourceID uint32, nodes []uint32, concurrency int, label string) (SnapshotResult, error) {
+	if s.management == nil {
+		return SnapshotResult{}, errors.New("management service not initialized")
+	}
+	nodes = uniqueNodes(nodes)
+	if len(nodes) == 0 {
+		return SnapshotResult{}, errors.New("nodes are required")
+	}
+	label = strings.TrimSpace(label)
+	snaps := make([]*ConfigSnapshot, len(nodes))
+	errs := make([]error, len(nodes))
+	progress := s.progress("snapshot", len(nodes))
+	fleet.ForEach(ctx, len(nodes), clampConcurrency(concurrency), func(i int) {
+		snap, err := s.takeSnapshot(ctx, sourceID, nodes[i], SnapshotKindManual, label)
+		if err == nil {
+			err = s.saveSnapshot(snap)
+		}
+		snaps[i], errs[i] = &snap, err
+		progress(nodes[i])
+	})
+
+	result := SnapshotResult{Snapshots: []ConfigSnapshot{}, Failed: []NodeError{}}
+	for i, node := range nodes {
+		switch {
+		case snaps[i] == nil:
+			result.Failed = append(result.Failed, NodeError{NodeID: node, Error: "not attempted"})
+		case errs[i] != nil:
+			result.Failed = append(result.Failed, NodeError{NodeID: node, Error: errs[i].Error()})
+		default:
+			result.Snapshots = append(result.Snapshots, *snaps[i])
+		}
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "config snapshot: %d ok, %d failed", len(result.Snapshots), len(result.Failed))
+	}
+	return result, ctx.Err()
+}
+
+func (s *ConfigFleetService) SnapshotSimple(sourceID uint32, nodes []uint32, concurrency int, label string) (SnapshotResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFleetTimeout)
+	defer cancel()
+	return s.Snapshot(ctx, sourceID, nodes, concurrency, label)
+}
+
+// Apply writes a change set node by node. Each node is backed up first and
+// left untouched if the backup fails; a failed key does not stop the other
+// keys of the same node.
+func (s *ConfigFleetService) Apply(ctx context.Context, sourceID uint32, cs ChangeSet) (ApplyReport, error) {
+	if s.management == nil {
+		return ApplyReport{}, errors.New("management service not initialized")
+	}
+	if err := validateValues(cs.Values); err != nil {
+		return ApplyReport{}, err
+	}
+	for node, values := range cs.NodeValues {
+		if _, err := parseNodeID(node); err != nil {
+			return ApplyReport{}, err
+		}
+		if err := validateValues(values); err != nil {
+			return ApplyReport{}, fmt.Errorf("node %s: %w", node, err)
+		}
+	}
+	nodes := uniqueNodes(cs.Nodes)
+	if len(nodes) == 0 {
+		nodes = overrideNodes(cs.NodeValues)
+	}
+	if len(nodes) == 0 {
+		return ApplyReport{}, errors.New("nodes are required")
+	}
+
+	started := time.Now()
+	report := ApplyReport{DryRun: cs.DryRun, StartedAt: started.UnixMilli(), Nodes: make([]NodeApplyResult, len(nodes))}
+	for i, node := range nodes {
+		report.Nodes[i] = NodeApplyResult{NodeID: node, Error: "not attempted", Keys: []KeyResult{}}
+	}
+	op := "apply"
+	if cs.DryRun {
+		op = "plan"
+	}
+	progress := s.progress(op, len(nodes))
+	fleet.ForEach(ctx, len(nodes), clampConcurrency(cs.Concurrency), func(i int) {
+		values := mergeValues(cs.Values, cs.NodeValues, nodes[i])
+		report.Nodes[i] = s.applyNode(ctx, sourceID, nodes[i], values, cs.DryRun)
+		progress(nodes[i])
+	})
+	for _, res := range report.Nodes {
+		if res.OK {
+			report.OK++
+		} else {
+			report.Failed++
+		}
+	}
+	report.DurationMs = time.Since(started).Milliseconds()
+	if s.logs != nil {
+		s.logs.Appendf("info", "config %s: %d ok, %d failed (%dms)", op, report.OK, report.Failed, report.DurationMs)
+	}
+	return report, ctx.Err()
+}
+
+func (s *ConfigFleetService) ApplySimple(sourceID uint32, cs ChangeSet) (ApplyReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFleetTimeout)
+	defer cancel()
+	return s.Apply(ctx, sourceID, cs)
+}
+
+// ApplyDesired applies the desired-state file at path. With no nodes given it
+// targets the nodes that have overrides in the file.
+func (s *ConfigFleetService) ApplyDesired(ctx context.Context, sourceID uint32, path string, nodes []uint32, concurrency int, dryRun bool) (ApplyReport, error) {
+	desired, err := LoadDesired(path)
+	if err != nil {
+		return ApplyReport{}, err
+	}
+	return s.Apply(ctx, sourceID, ChangeSet{Nodes: nodes, Values: desired.Values, NodeValues: desired.Nodes, Concurrency: concurrency, DryRun: dryRun})
+}
+
+func (s *ConfigFleetService) ApplyDesiredSimple(sourceID uint32, path string, nodes []uint32, concurrency int, dryRun bool) (ApplyReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFleetTimeout)
+	defer cancel()
+	return s.ApplyDesired(ctx, sourceID, path, nodes, concurrency, dryRun)
+}
+
+// Restore writes a stored snapshot back to its node. Keys added since the
+// snapshot are left alone because the config protocol cannot delete them.
+func (s *ConfigFleetService) Restore(ctx context.Context, sourceID uint32, snapshotID string, dryRun bool) (ApplyReport, error) {
+	snap, err := s.LoadSnapshot(snapshotID)
+	if err != nil {
+		return ApplyReport{}, err
+	}
+	return s.Apply(ctx, sourceID, ChangeSet{Nodes: []uint32{snap.NodeID}, Values: snap.Values, Concurrency: 1, DryRun: dryRun})
+}
+
+func (s *ConfigFleetService) RestoreSimple(sourceID uint32, snapshotID string, dryRun bool) (ApplyReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFleetTimeout)
+	defer cancel()
+	return s.Restore(ctx, sourceID, snapshotID, dryRun)
+}
+
+func (s *ConfigFleetService) applyNode(ctx context.Context, sourceID, node uint32, values map[string]string, dryRun bool) NodeApplyResult {
+	started := time.Now()
+	res := NodeApplyResult{NodeID: node, Keys: []KeyResult{}}
+	defer func() { res.DurationMs = time.Since(started).Milliseconds() }()
+
+	// The backup doubles as the read of current values. A dry run skips it
+	// and reads only the keys it is about to report on.
+	var current map[string]string
+	var readErrs map[string]string
+	if dryRun {
+		current = make(map[string]string, len(values))
+		readErrs = make(map[string]string)
+		for _, key := range sortedKeys(values) {
+			value, found, err := s.readKey(ctx, sourceID, node, key)
+			switch {
+			case err != nil:
+				readErrs[key] = err.Error()
+			case found:
+				current[key] = value
+			}
+		}
+	} else {
+		backup, err := s.takeSnapshot(ctx, sourceID, node, SnapshotKindBackup, "before apply")
+		if err == nil {
+			err = s.saveSnapshot(backup)
+		}
+		if err != nil {
+			res.Error = fmt.Sprintf("backup failed: %v", err)
+			return res
+		}
+		res.BackupID = backup.ID
+		current, readErrs = backup.Values, backup.KeyErrors
+	}
+
+	failed := 0
+	for _, key := range sortedKeys(values) {
+		want := values[key]
+		kr := KeyResult{Key: key, After: want}
+		before, existed := current[key]
+		kr.Before, kr.Existed = before, existed
+		switch {
+		case readErrs[key] != "":
+			kr.Status, kr.Error = KeyFailed, "read current value: "+readErrs[key]
+		case existed && before == want:
+			kr.Status = KeyUnchanged
+		case dryRun:
+			kr.Status = KeyPlanned
+		default:
+			callCtx, cancel := context.WithTimeout(ctx, defaultCallTimeout)
+			_, err := s.management.ConfigSet(callCtx, sourceID, node, key, want)
+			cancel()
+			if err != nil {
+				kr.Status, kr.Error = KeyFailed, err.Error()
+			} else {
+				kr.Status = KeyChanged
+			}
+		}
+		if kr.Status == KeyFailed {
+			failed++
+		}
+		res.Keys = append(res.Keys, kr)
+	}
+	res.OK = failed == 0
+	if failed > 0 {
+		res.Error = fmt.Sprintf("%d of %d keys failed", failed, len(values))
+	}
+	return res
+}
+
+func (s *ConfigFleetService) takeSnapshot(ctx context.Context, sourceID, node uint32, kind, label string) (ConfigSnapshot, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultCallTimeout)
+	list, err := s.management.ConfigList(callCtx, sourceID, node)
+	cancel()
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	id, err := newSnapshotID()
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	snap := ConfigSnapshot{ID: id, NodeID: node, Kind: kind, Label: label, TakenAt: time.Now().UnixMilli(), Values: make(map[string]string, len(list.Keys))}
+	keys := append([]string(nil), list.Keys...)
+	sort.Strings(keys)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		value, found, err := s.readKey(ctx, sourceID, node, key)
+		if err != nil {
+			if snap.KeyErrors == nil {
+				snap.KeyErrors = make(map[string]string)
+			}
+			snap.KeyErrors[key] = err.Error()
+			continue
+		}
+		if found {
+			snap.Values[key] = value
+		}
+	}
+	if ctx.Err() != nil {
+		return ConfigSnapshot{}, ctx.Err()
+	}
+	return snap, nil
+}
+
+// readKey reports found=false when the node answered with code 404, which is
+// how a missing key comes back over the config protocol.
+func (s *ConfigFleetService) readKey(ctx context.Context, sourceID, node uint32, key string) (string, bool, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultCallTimeout)
+	defer cancel()
+	resp, err := s.management.ConfigGet(callCtx, sourceID, node, key)
+	if err != nil {
+		if mgmtsvc.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return resp.Value, true, nil
+}
+
+func (s *ConfigFleetService) progress(op string, total int) func(node uint32) {
+	var mu sync.Mutex
+	done := 0
+	return func(node uint32) {
+		mu.Lock()
+		done++
+		evt := ProgressEvent{Op: op, NodeID: node, Done: done, Total: total}
+		mu.Unlock()
+		if s.bus != nil {
+			_ = s.bus.Publish(context.Background(), EventConfigFleetProgress, evt, nil)
+		}
+	}
+}
+
+func uniqueNodes(nodes []uint32) []uint32 {
+	seen := make(map[uint32]bool, len(nodes))
+	out := make([]uint32, 0, len(nodes))
+	for _, node := range nodes {
+		if node == 0 || seen[node] {
+			continue
+		}
+		seen[node] = true
+		out = append(out, node)
+	}
+	return out
+}
+
+func clampConcurrency(n int) int {
+	if n <= 0 {
+		return defaultConcurrency
+	}
+	if n > maxConcurrency {
+		return maxConcurrency
+	}
+	return n
+}
+
+// newSnapshotID is time-ordered so snapshot files sort naturally on disk.
+func newSnapshotID() (string, error) {
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(time.Now().UnixMilli(), 16) + hex.EncodeToString(buf[:]), nil
+}
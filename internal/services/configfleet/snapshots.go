@@ -0,0 +1,182 @@
+package configfleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	snapshotsDirName  = "config_snapshots"
+	maxBackupsPerNode = 20
+)
+
+// Snapshots lists stored snapshots and backups, newest first. A zero nodeID
+// lists every node.
+func (s *ConfigFleetService) Snapshots(nodeID uint32) ([]SnapshotInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.loadAllLocked()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SnapshotInfo, 0, len(all))
+	for _, snap := range all {
+		if nodeID != 0 && snap.NodeID != nodeID {
+			continue
+		}
+		out = append(out, SnapshotInfo{ID: snap.ID, NodeID: snap.NodeID, Kind: snap.Kind, Label: snap.Label, TakenAt: snap.TakenAt, Keys: len(snap.Values)})
+	}
+	return out, nil
+}
+
+func (s *ConfigFleetService) LoadSnapshot(id string) (ConfigSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked(id)
+}
+
+func (s *ConfigFleetService) DeleteSnapshot(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.snapshotPath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("snapshot not found")
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ConfigFleetService) saveSnapshot(snap ConfigSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.snapshotPath(snap.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	if snap.Kind == SnapshotKindBackup {
+		s.pruneBackupsLocked(snap.NodeID)
+	}
+	return nil
+}
+
+// pruneBackupsLocked keeps the newest maxBackupsPerNode automatic backups of
+// a node. Manual snapshots are never pruned.
+func (s *ConfigFleetService) pruneBackupsLocked(nodeID uint32) {
+	all, err := s.loadAllLocked()
+	if err != nil {
+		return
+	}
+	kept := 0
+	for _, snap := range all {
+		if snap.NodeID != nodeID || snap.Kind != SnapshotKindBackup {
+			continue
+		}
+		kept++
+		if kept <= maxBackupsPerNode {
+			continue
+		}
+		if path, err := s.snapshotPath(snap.ID); err == nil {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+func (s *ConfigFleetService) loadLocked(id string) (ConfigSnapshot, error) {
+	path, err := s.snapshotPath(id)
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ConfigSnapshot{}, errors.New("snapshot not found")
+		}
+		return ConfigSnapshot{}, err
+	}
+	var snap ConfigSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return ConfigSnapshot{}, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return snap, nil
+}
+
+func (s *ConfigFleetService) loadAllLocked() ([]ConfigSnapshot, error) {
+	dir, err := s.snapshotsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []ConfigSnapshot{}, nil
+		}
+		return nil, err
+	}
+	out := make([]ConfigSnapshot, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		snap, err := s.loadLocked(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		out = append(out, snap)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TakenAt != out[j].TakenAt {
+			return out[i].TakenAt > out[j].TakenAt
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (s *ConfigFleetService) snapshotsDir() (string, error) {
+	if s.store == nil {
+		return "", errors.New("storage not initialized")
+	}
+	dir := s.store.DataDir(s.store.CurrentProfile(), snapshotsDirName)
+	if dir == "" {
+		return "", errors.New("storage not initialized")
+	}
+	return dir, nil
+}
+
+func (s *ConfigFleetService) snapshotPath(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return "", errors.New("snapshot id is required")
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return "", errors.New("invalid snapshot id")
+		}
+	}
+	dir, err := s.snapshotsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
@@ -7,13 +7,13 @@ import (
 )
 
 const (
-	cfgFileBaseDir          = "file.base_dir"
-	cfgFileMaxSizeBytes     = "file.max_size_bytes"
-	cfgFileMaxConcurrent    = "file.max_concurrent"
-	cfgFileChunkBytes       = "file.chunk_bytes"
-	cfgFileIncompleteTTLSec = "file.incomplete_ttl_sec"
-	cfgFileWantSHA256       = "file.want_sha256"
-	cfgFileAutoAccept       = "file.auto_accept"
+	CfgFileBaseDir          = "file.base_dir"
+	CfgFileMaxSizeBytes     = "file.max_size_bytes"
+	CfgFileMaxConcurrent    = "file.max_concurrent"
+	CfgFileChunkBytes       = "file.chunk_bytes"
+	CfgFileIncompleteTTLSec = "file.incomplete_ttl_sec"
+	CfgFileWantSHA256       = "file.want_sha256"
+	CfgFileAutoAccept       = "file.auto_accept"
 
 	cfgFileBrowserNodes = "file.browser.nodes"
 )
@@ -83,25 +83,25 @@ func (s *FileService) SavePrefs(prefs FilePrefs) (FilePrefs, error) {
 		return FilePrefs{}, err
 	}
 	profile := s.store.CurrentProfile()
-	if err := s.store.SetString(profile, cfgFileBaseDir, normalized.BaseDir); err != nil {
+	if err := s.store.SetString(profile, CfgFileBaseDir, normalized.BaseDir); err != nil {
 		return FilePrefs{}, err
 	}
-	if err := s.store.SetInt(profile, cfgFileMaxSizeBytes, int(normalized.MaxSizeBytes)); err != nil {
+	if err := s.store.SetInt(profile, CfgFileMaxSizeBytes, int(normalized.MaxSizeBytes)); err != nil {
 		return FilePrefs{}, err
 	}
-	if err := s.store.SetInt(profile, cfgFileMaxConcurrent, normalized.MaxConcurrent); err != nil {
+	if err := s.store.SetInt(profile, CfgFileMaxConcurrent, normalized.MaxConcurrent); err != nil {
 		return FilePrefs{}, err
 	}
-	if err := s.store.SetInt(profile, cfgFileChunkBytes, normalized.ChunkBytes); err != nil {
+	if err := s.store.SetInt(profile, CfgFileChunkBytes, normalized.ChunkBytes); err != nil {
 		return FilePrefs{}, err
 	}
-	if err := s.store.SetInt(profile, cfgFileIncompleteTTLSec, int(normalized.IncompleteTTLSec)); err != nil {
+	if err := s.store.SetInt(profile, CfgFileIncompleteTTLSec, int(normalized.IncompleteTTLSec)); err != nil {
 		return FilePrefs{}, err
 	}
-	if err := s.store.SetBool(profile, cfgFileWantSHA256, normalized.WantSHA256); err != nil {
+	if err := s.store.SetBool(profile, CfgFileWantSHA256, normalized.WantSHA256); err != nil {
 		return FilePrefs{}, err
 	}
-	if err := s.store.SetBool(profile, cfgFileAutoAccept, normalized.AutoAccept); err != nil {
+	if err := s.store.SetBool(profile, CfgFileAutoAccept, normalized.AutoAccept); err != nil {
 		return FilePrefs{}, err
 	}
 	return normalized, nil
@@ -130,13 +130,13 @@ func (s *FileService) loadFilePrefs() FilePrefs {
 		return defaultFilePrefs()
 	}
 	profile := s.store.CurrentProfile()
-	baseDir := strings.TrimSpace(s.store.GetString(profile, cfgFileBaseDir, defaultFilePrefs().BaseDir))
-	maxSize := s.store.GetInt(profile, cfgFileMaxSizeBytes, int(defaultFilePrefs().MaxSizeBytes))
-	maxConcurrent := s.store.GetInt(profile, cfgFileMaxConcurrent, defaultFilePrefs().MaxConcurrent)
-	chunkBytes := s.store.GetInt(profile, cfgFileChunkBytes, defaultFilePrefs().ChunkBytes)
-	ttlSec := s.store.GetInt(profile, cfgFileIncompleteTTLSec, int(defaultFilePrefs().IncompleteTTLSec))
-	wantSHA := s.store.GetBool(profile, cfgFileWantSHA256, defaultFilePrefs().WantSHA256)
-	autoAccept := s.store.GetBool(profile, cfgFileAutoAccept, defaultFilePrefs().AutoAccept)
+	baseDir := strings.TrimSpace(s.store.GetString(profile, CfgFileBaseDir, defaultFilePrefs().BaseDir))
+	maxSize := s.store.GetInt(profile, CfgFileMaxSizeBytes, int(defaultFilePrefs().MaxSizeBytes))
+	maxConcurrent := s.store.GetInt(profile, CfgFileMaxConcurrent, defaultFilePrefs().MaxConcurrent)
+	chunkBytes := s.store.GetInt(profile, CfgFileChunkBytes, defaultFilePrefs().ChunkBytes)
+	ttlSec := s.store.GetInt(profile, CfgFileIncompleteTTLSec, int(defaultFilePrefs().IncompleteTTLSec))
+	wantSHA := s.store.GetBool(profile, CfgFileWantSHA256, defaultFilePrefs().WantSHA256)
+	autoAccept := s.store.GetBool(profile, CfgFileAutoAccept, defaultFilePrefs().AutoAccept)
 	if maxSize < 0 {
 		maxSize = int(defaultFilePrefs().MaxSizeBytes)
 	}
@@ -78,3 +78,18 @@ func (s *FileService) localReadText(dir, name string, maxBytes int) (text string
 	}
 	return string(buf), truncated, size, nil
 }
+
+// ReadLocalText reads a text file under BaseDir with the same limits as a
+// remote read_text request. It never touches the network.
+func (s *FileService) ReadLocalText(dir, name string, maxBytes int) (FileTextEvent, error) {
+	dir = strings.ReplaceAll(strings.TrimSpace(dir), "\\", "/")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return FileTextEvent{}, errors.New("name is required")
+	}
+	text, truncated, size, err := s.localReadText(dir, name, maxBytes)
+	if err != nil {
+		return FileTextEvent{}, err
+	}
+	return FileTextEvent{NodeID: s.localNodeFallback(0), Dir: dir, Name: name, Code: 1, Msg: "ok", Size: size, Text: text, Truncated: truncated}, nil
+}
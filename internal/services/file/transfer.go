@@ -1675,6 +1675,11 @@ func (s *FileService) sendWriteResp(sourceID, targetID uint32, data protocol.Wri
 	return s.sendCtrl(context.Background(), sourceID, targetID, payload, "write_resp", data.Op)
 }
 
+// ActiveSessions is the number of transfers currently sending or receiving.
+func (s *FileService) ActiveSessions() int {
+	return s.fileTotalSessions()
+}
+
 func (s *FileService) fileTotalSessions() int {
 	if s == nil || s.state == nil {
 		return 0
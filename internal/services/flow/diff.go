@@ -0,0 +1,213 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+// FieldChange is one changed value. From and To hold JSON text; an empty
+// string means the field was absent on that side.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type NodeDiff struct {
+	ID      string        `json:"id"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// FlowDiff describes how a flow definition changed from one version to
+// another. Spec changes are reported per leaf, e.g. spec.args.count.
+type FlowDiff struct {
+	FlowID          string        `json:"flowId"`
+	FromVersion     string        `json:"fromVersion,omitempty"`
+	ToVersion       string        `json:"toVersion,omitempty"`
+	Changed         bool          `json:"changed"`
+	FlowChanges     []FieldChange `json:"flowChanges"`
+	NodesAdded      []flow.Node   `json:"nodesAdded"`
+	NodesRemoved    []flow.Node   `json:"nodesRemoved"`
+	NodesChanged    []NodeDiff    `json:"nodesChanged"`
+	EdgesAdded      []flow.Edge   `json:"edgesAdded"`
+	EdgesRemoved    []flow.Edge   `json:"edgesRemoved"`
+	ScheduleChanged bool          `json:"scheduleChanged"`
+}
+
+// DiffFlows compares two flow definitions. Routing fields are ignored.
+func DiffFlows(from, to flow.SetReq) FlowDiff {
+	diff := FlowDiff{
+		FlowID:       to.FlowID,
+		FlowChanges:  []FieldChange{},
+		NodesAdded:   []flow.Node{},
+		NodesRemoved: []flow.Node{},
+		NodesChanged: []NodeDiff{},
+		EdgesAdded:   []flow.Edge{},
+		EdgesRemoved: []flow.Edge{},
+	}
+	if diff.FlowID == "" {
+		diff.FlowID = from.FlowID
+	}
+	addFlow := func(field string, a, b any) {
+		if c, ok := compareValues(field, a, b); ok {
+			diff.FlowChanges = append(diff.FlowChanges, c)
+		}
+	}
+	addFlow("name", from.Name, to.Name)
+	before := len(diff.FlowChanges)
+	addFlow("trigger.type", from.Trigger.Type, to.Trigger.Type)
+	addFlow("trigger.every_ms", from.Trigger.EveryMs, to.Trigger.EveryMs)
+	diff.ScheduleChanged = len(diff.FlowChanges) > before
+
+	oldNodes := make(map[string]flow.Node, len(from.Graph.Nodes))
+	for _, node := range from.Graph.Nodes {
+		oldNodes[node.ID] = node
+	}
+	newIDs := make(map[string]bool, len(to.Graph.Nodes))
+	for _, node := range to.Graph.Nodes {
+		newIDs[node.ID] = true
+		old, ok := oldNodes[node.ID]
+		if !ok {
+			diff.NodesAdded = append(diff.NodesAdded, node)
+			continue
+		}
+		if changes := diffNode(old, node); len(changes) > 0 {
+			diff.NodesChanged = append(diff.NodesChanged, NodeDiff{ID: node.ID, Changes: changes})
+		}
+	}
+	for _, node := range from.Graph.Nodes {
+		if !newIDs[node.ID] {
+			diff.NodesRemoved = append(diff.NodesRemoved, node)
+		}
+	}
+
+	oldEdges := edgeSet(from.Graph.Edges)
+	newEdges := edgeSet(to.Graph.Edges)
+	for _, edge := range to.Graph.Edges {
+		if !oldEdges[edge] {
+			diff.EdgesAdded = append(diff.EdgesAdded, edge)
+			oldEdges[edge] = true
+		}
+	}
+	for _, edge := range from.Graph.Edges {
+		if !newEdges[edge] {
+			diff.EdgesRemoved = append(diff.EdgesRemoved, edge)
+			newEdges[edge] = true
+		}
+	}
+
+	diff.Changed = len(diff.FlowChanges) > 0 || len(diff.NodesAdded) > 0 || len(diff.NodesRemoved) > 0 ||
+		len(diff.NodesChanged) > 0 || len(diff.EdgesAdded) > 0 || len(diff.EdgesRemoved) > 0
+	return diff
+}
+
+func diffNode(a, b flow.Node) []FieldChange {
+	var out []FieldChange
+	add := func(field string, x, y any) {
+		if c, ok := compareValues(field, x, y); ok {
+			out = append(out, c)
+		}
+	}
+	add("kind", a.Kind, b.Kind)
+	add("allow_fail", a.AllowFail, b.AllowFail)
+	add("retry", a.Retry, b.Retry)
+	add("timeout_ms", a.TimeoutMs, b.TimeoutMs)
+
+	oldLeaves := map[string]string{}
+	newLeaves := map[string]string{}
+	flattenJSON("spec", a.Spec, oldLeaves)
+	flattenJSON("spec", b.Spec, newLeaves)
+	seen := map[string]bool{}
+	for _, key := range sortedKeys(oldLeaves) {
+		seen[key] = true
+		if oldLeaves[key] != newLeaves[key] {
+			out = append(out, FieldChange{Field: key, From: oldLeaves[key], To: newLeaves[key]})
+		}
+	}
+	for _, key := range sortedKeys(newLeaves) {
+		if !seen[key] {
+			out = append(out, FieldChange{Field: key, To: newLeaves[key]})
+		}
+	}
+	return out
+}
+
+func compareValues(field string, a, b any) (FieldChange, bool) {
+	from := jsonText(a)
+	to := jsonText(b)
+	if from == to {
+		return FieldChange{}, false
+	}
+	return FieldChange{Field: field, From: from, To: to}, true
+}
+
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
+// flattenJSON maps each leaf of raw to its dotted path. Arrays use [i]; empty
+// objects and arrays are leaves themselves.
+func flattenJSON(prefix string, raw json.RawMessage, out map[string]string) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		out[prefix] = string(raw)
+		return
+	}
+	flattenValue(prefix, v, out)
+}
+
+func flattenValue(prefix string, v any, out map[string]string) {
+	switch t := v.(type) {
+	case map[string]any:
+		if len(t) == 0 {
+			out[prefix] = "{}"
+			return
+		}
+		for key, child := range t {
+			flattenValue(prefix+"."+key, child, out)
+		}
+	case []any:
+		if len(t) == 0 {
+			out[prefix] = "[]"
+			return
+		}
+		for i, child := range t {
+			flattenValue(prefix+"["+strconv.Itoa(i)+"]", child, out)
+		}
+	default:
+		out[prefix] = jsonText(t)
+		if t == nil {
+			out[prefix] = "null"
+		}
+	}
+}
+
+func edgeSet(edges []flow.Edge) map[flow.Edge]bool {
+	out := make(map[flow.Edge]bool, len(edges))
+	for _, edge := range edges {
+		out[edge] = true
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,49 @@
+package flow
+
+const EventFlowRunProgress = "flow.run.progress"
+
+// RunTransition is one observed status change. NodeID is empty for the run
+// itself. Times are when the watcher saw the change, so they are only as
+// precise as the poll interval.
+type RunTransition struct {
+	At     int64  `json:"at"`
+	NodeID string `json:"nodeId,omitempty"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Code   int    `json:"code,omitempty"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+type NodeTimeline struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+	Attempts   int    `json:"attempts"`
+	StartedAt  int64  `json:"startedAt"`
+	FinishedAt int64  `json:"finishedAt"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type RunTimeline struct {
+	ExecutorNode uint32          `json:"executorNode"`
+	FlowID       string          `json:"flowId"`
+	RunID        string          `json:"runId"`
+	Status       string          `json:"status"`
+	Watching     bool            `json:"watching"`
+	Done         bool            `json:"done"`
+	Error        string          `json:"error,omitempty"`
+	StartedAt    int64           `json:"startedAt"`
+	FinishedAt   int64           `json:"finishedAt"`
+	DurationMs   int64           `json:"durationMs"`
+	Polls        int             `json:"polls"`
+	Nodes        []NodeTimeline  `json:"nodes"`
+	Transitions  []RunTransition `json:"transitions"`
+}
+
+// RunProgressEvent is published on EventFlowRunProgress whenever a watched
+// run or one of its nodes changes status, and once when watching stops.
+type RunProgressEvent struct {
+	Changes  []RunTransition `json:"changes"`
+	Timeline RunTimeline     `json:"timeline"`
+}
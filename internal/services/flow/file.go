@@ -0,0 +1,194 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+const (
+	FlowFileFormat  = "myflowhub-flow"
+	FlowFileVersion = 1
+
+	FileFormatJSON = "json"
+	FileFormatYAML = "yaml"
+)
+
+// FlowFile is the on-disk representation of a flow definition. Routing
+// fields (req_id, origin/executor node) are deliberately left out so a file
+// can be imported onto any executor.
+type FlowFile struct {
+	Format     string       `json:"format"`
+	Version    int          `json:"version"`
+	ExportedAt string       `json:"exported_at,omitempty"`
+	FlowID     string       `json:"flow_id"`
+	Name       string       `json:"name,omitempty"`
+	Trigger    flow.Trigger `json:"trigger"`
+	Graph      flow.Graph   `json:"graph"`
+}
+
+// ExportFile fetches a flow with Get and writes it to path. The format is
+// picked from the extension: .yaml/.yml writes YAML, anything else JSON.
+func (s *FlowService) ExportFile(ctx context.Context, sourceID, targetID uint32, req flow.GetReq, path string) (FlowFile, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return FlowFile{}, errors.New("path is required")
+	}
+	resp, err := s.Get(ctx, sourceID, targetID, req)
+	if err != nil {
+		return FlowFile{}, err
+	}
+	file := FlowFile{
+		Format:     FlowFileFormat,
+		Version:    FlowFileVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		FlowID:     resp.FlowID,
+		Name:       resp.Name,
+		Trigger:    resp.Trigger,
+		Graph:      resp.Graph,
+	}
+	if strings.TrimSpace(file.FlowID) == "" {
+		file.FlowID = req.FlowID
+	}
+	data, err := EncodeFlowFile(file, formatFromPath(path))
+	if err != nil {
+		return FlowFile{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return FlowFile{}, err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return FlowFile{}, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "flow exported flow_id=%s path=%s", file.FlowID, path)
+	}
+	return file, nil
+}
+
+func (s *FlowService) ExportFileSimple(sourceID, targetID uint32, req flow.GetReq, path string) (FlowFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFlowTimeout)
+	defer cancel()
+	return s.ExportFile(ctx, sourceID, targetID, req, path)
+}
+
+// ImportFile reads and validates a flow file. The returned request carries
+// the flow definition only; the caller fills in req_id and routing before
+// calling Set. A *ValidationError is returned when the definition is invalid.
+func (s *FlowService) ImportFile(path string) (flow.SetReq, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return flow.SetReq{}, errors.New("path is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return flow.SetReq{}, err
+	}
+	req, err := ParseFlowFile(data, formatFromPath(path))
+	if err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "flow import %s rejected: %v", path, err)
+		}
+		return flow.SetReq{}, err
+	}
+	return req, nil
+}
+
+// ImportText is ImportFile for content the UI already holds in memory.
+func (s *FlowService) ImportText(content, format string) (flow.SetReq, error) {
+	return ParseFlowFile([]byte(content), format)
+}
+
+// EncodeFlowFile renders file as JSON or YAML.
+func EncodeFlowFile(file FlowFile, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch normalizeFileFormat(format) {
+	case FileFormatYAML:
+		out, err := jsonToYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		header := fmt.Sprintf("# %s v%d\n", FlowFileFormat, FlowFileVersion)
+		return append([]byte(header), out...), nil
+	default:
+		return append(data, '\n'), nil
+	}
+}
+
+// ParseFlowFile decodes a JSON or YAML flow file and validates it. An empty
+// format sniffs the content: a leading '{' is JSON, anything else YAML.
+func ParseFlowFile(data []byte, format string) (flow.SetReq, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	format = normalizeFileFormat(format)
+	if format == "" {
+		format = FileFormatYAML
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			format = FileFormatJSON
+		}
+	}
+	raw := data
+	if format == FileFormatYAML {
+		converted, err := yamlToJSON(data)
+		if err != nil {
+			return flow.SetReq{}, err
+		}
+		raw = converted
+	}
+	var file FlowFile
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return flow.SetReq{}, fmt.Errorf("decode flow file: %w", err)
+	}
+	// Files without a header are accepted as version 1.
+	if file.Format != "" && file.Format != FlowFileFormat {
+		return flow.SetReq{}, fmt.Errorf("unsupported file format %q", file.Format)
+	}
+	if file.Version == 0 {
+		file.Version = FlowFileVersion
+	}
+	if file.Version != FlowFileVersion {
+		return flow.SetReq{}, fmt.Errorf("unsupported flow file version %d (supported: %d)", file.Version, FlowFileVersion)
+	}
+	req := flow.SetReq{
+		FlowID:  strings.TrimSpace(file.FlowID),
+		Name:    file.Name,
+		Trigger: file.Trigger,
+		Graph:   file.Graph,
+	}
+	if issues := validateSetReq(req); len(issues) > 0 {
+		return flow.SetReq{}, &ValidationError{Issues: issues}
+	}
+	return req, nil
+}
+
+func formatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FileFormatYAML
+	default:
+		return FileFormatJSON
+	}
+}
+
+func normalizeFileFormat(format string) string {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "yaml", "yml":
+		return FileFormatYAML
+	case "json":
+		return FileFormatJSON
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,536 @@
+package flow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+const (
+	historyDirName  = "flow_history"
+	historyFileName = "runs.jsonl"
+	// The history file is compacted to the newest maxHistoryRecords runs once
+	// it grows past maxHistoryFileBytes.
+	maxHistoryRecords   = 5000
+	maxHistoryFileBytes = 8 << 20
+	// Run start times remembered from Run until the run is seen finished.
+	maxPendingRuns = 1000
+
+	// A timeline from WatchRun carries node timings; a bare Status response
+	// does not, so it never replaces a timeline record.
+	recordFromStatus   = 1
+	recordFromTimeline = 2
+)
+
+// RunRecord is one finished run. Durations are zero when the run was only
+// seen through Status without being watched.
+type RunRecord struct {
+	ExecutorNode uint32         `json:"executorNode"`
+	FlowID       string         `json:"flowId"`
+	RunID        string         `json:"runId"`
+	Status       string         `json:"status"`
+	Succeeded    bool           `json:"succeeded"`
+	StartedAt    int64          `json:"startedAt"`
+	FinishedAt   int64          `json:"finishedAt"`
+	DurationMs   int64          `json:"durationMs"`
+	Nodes        []NodeTimeline `json:"nodes"`
+	Quality      int            `json:"quality"`
+}
+
+type NodeRunStats struct {
+	ID       string  `json:"id"`
+	Runs     int     `json:"runs"`
+	Failures int     `json:"failures"`
+	FailRate float64 `json:"failRate"`
+	Timed    int     `json:"timed"`
+	P50Ms    int64   `json:"p50Ms"`
+	P95Ms    int64   `json:"p95Ms"`
+	MaxMs    int64   `json:"maxMs"`
+}
+
+type FlowRunStats struct {
+	ExecutorNode uint32         `json:"executorNode"`
+	FlowID       string         `json:"flowId"`
+	Runs         int            `json:"runs"`
+	Succeeded    int            `json:"succeeded"`
+	Failed       int            `json:"failed"`
+	SuccessRate  float64        `json:"successRate"`
+	Timed        int            `json:"timed"`
+	P50Ms        int64          `json:"p50Ms"`
+	P95Ms        int64          `json:"p95Ms"`
+	LastRunAt    int64          `json:"lastRunAt"`
+	LastStatus   string         `json:"lastStatus"`
+	Nodes        []NodeRunStats `json:"nodes"`
+}
+
+// FlowRunStats aggregates the stored runs of one flow.
+func (s *FlowService) FlowRunStats(executorNode uint32, flowID string) (FlowRunStats, error) {
+	flowID = strings.TrimSpace(flowID)
+	if flowID == "" {
+		return FlowRunStats{}, errors.New("flow_id is required")
+	}
+	records, err := s.loadHistory()
+	if err != nil {
+		return FlowRunStats{}, err
+	}
+	var runs []RunRecord
+	for _, rec := range records {
+		if rec.ExecutorNode == executorNode && rec.FlowID == flowID {
+			runs = append(runs, rec)
+		}
+	}
+	return aggregateRuns(executorNode, flowID, runs), nil
+}
+
+// FlowRunSummaries aggregates every flow in the history, worst success rate
+// first.
+func (s *FlowService) FlowRunSummaries() ([]FlowRunStats, error) {
+	records, err := s.loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	type flowKey struct {
+		executor uint32
+		flowID   string
+	}
+	groups := make(map[flowKey][]RunRecord)
+	for _, rec := range records {
+		key := flowKey{rec.ExecutorNode, rec.FlowID}
+		groups[key] = append(groups[key], rec)
+	}
+	out := make([]FlowRunStats, 0, len(groups))
+	for key, runs := range groups {
+		out = append(out, aggregateRuns(key.executor, key.flowID, runs))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SuccessRate != out[j].SuccessRate {
+			return out[i].SuccessRate < out[j].SuccessRate
+		}
+		if out[i].Failed != out[j].Failed {
+			return out[i].Failed > out[j].Failed
+		}
+		return out[i].FlowID < out[j].FlowID
+	})
+	return out, nil
+}
+
+// RecentRuns returns up to limit finished runs, newest first. An empty flowID
+// matches every flow on the executor; executorNode 0 matches every executor.
+func (s *FlowService) RecentRuns(executorNode uint32, flowID string, limit int) ([]RunRecord, error) {
+	records, err := s.loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	records = filterRuns(records, executorNode, strings.TrimSpace(flowID))
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// ExportRunHistoryCSV writes matching runs to path, one row per node (or one
+// row for runs without node results), and returns the number of runs written.
+func (s *FlowService) ExportRunHistoryCSV(path string, executorNode uint32, flowID string) (int, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return 0, errors.New("path is required")
+	}
+	records, err := s.loadHistory()
+	if err != nil {
+		return 0, err
+	}
+	records = filterRuns(records, executorNode, strings.TrimSpace(flowID))
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{
+		"executor_node", "flow_id", "run_id", "status", "started_at", "finished_at", "duration_ms",
+		"node_id", "node_status", "node_code", "node_msg", "node_attempts", "node_duration_ms",
+	})
+	for _, rec := range records {
+		base := []string{
+			strconv.FormatUint(uint64(rec.ExecutorNode), 10), rec.FlowID, rec.RunID, rec.Status,
+			formatMillis(rec.StartedAt), formatMillis(rec.FinishedAt), strconv.FormatInt(rec.DurationMs, 10),
+		}
+		if len(rec.Nodes) == 0 {
+			_ = w.Write(append(base, "", "", "", "", "", ""))
+			continue
+		}
+		for _, node := range rec.Nodes {
+			row := append(append([]string(nil), base...),
+				node.ID, node.Status, strconv.Itoa(node.Code), node.Msg,
+				strconv.Itoa(node.Attempts), strconv.FormatInt(node.DurationMs, 10))
+			_ = w.Write(row)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return 0, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "flow run history exported runs=%d path=%s", len(records), path)
+	}
+	return len(records), nil
+}
+
+// ClearRunHistory deletes all stored runs of the current profile.
+func (s *FlowService) ClearRunHistory() error {
+	path, err := s.historyPath()
+	if err != nil {
+		return err
+	}
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	s.historySeen = nil
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// markRunStarted remembers when Run started a run so a later Status can
+// report its duration.
+func (s *FlowService) markRunStarted(executor uint32, flowID, runID string) {
+	if strings.TrimSpace(runID) == "" {
+		return
+	}
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	if s.runStarts == nil {
+		s.runStarts = make(map[string]int64)
+	}
+	if len(s.runStarts) >= maxPendingRuns {
+		var oldestKey string
+		var oldest int64
+		for key, at := range s.runStarts {
+			if oldestKey == "" || at < oldest {
+				oldestKey, oldest = key, at
+			}
+		}
+		delete(s.runStarts, oldestKey)
+	}
+	s.runStarts[watchKey(executor, flowID, runID)] = time.Now().UnixMilli()
+}
+
+// recordStatus stores a finished run seen through Status. Runs being watched
+// are recorded from their timeline instead.
+func (s *FlowService) recordStatus(executor uint32, flowID string, resp flow.StatusResp) {
+	runID := strings.TrimSpace(resp.RunID)
+	if runID == "" || !isTerminalStatus(resp.Status) {
+		return
+	}
+	key := watchKey(executor, flowID, runID)
+	s.watchMu.Lock()
+	w, watched := s.watches[key]
+	watched = watched && w.timeline.Watching
+	s.watchMu.Unlock()
+	if watched {
+		return
+	}
+	now := time.Now().UnixMilli()
+	rec := RunRecord{
+		ExecutorNode: executor,
+		FlowID:       flowID,
+		RunID:        runID,
+		Status:       resp.Status,
+		FinishedAt:   now,
+		Nodes:        make([]NodeTimeline, 0, len(resp.Nodes)),
+		Quality:      recordFromStatus,
+	}
+	for _, ns := range resp.Nodes {
+		rec.Nodes = append(rec.Nodes, NodeTimeline{ID: ns.ID, Status: ns.Status, Code: ns.Code, Msg: ns.Msg})
+	}
+	s.historyMu.Lock()
+	if started, ok := s.runStarts[key]; ok {
+		rec.StartedAt = started
+		rec.DurationMs = now - started
+	}
+	s.historyMu.Unlock()
+	s.recordRun(rec)
+}
+
+func (s *FlowService) recordTimeline(tl RunTimeline) {
+	if !tl.Done {
+		return
+	}
+	s.recordRun(RunRecord{
+		ExecutorNode: tl.ExecutorNode,
+		FlowID:       tl.FlowID,
+		RunID:        tl.RunID,
+		Status:       tl.Status,
+		StartedAt:    tl.StartedAt,
+		FinishedAt:   tl.FinishedAt,
+		DurationMs:   tl.DurationMs,
+		Nodes:        tl.Nodes,
+		Quality:      recordFromTimeline,
+	})
+}
+
+func (s *FlowService) recordRun(rec RunRecord) {
+	if s.store == nil {
+		return
+	}
+	rec.Succeeded = isSuccessStatus(rec.Status)
+	path, err := s.historyPath()
+	if err != nil {
+		return
+	}
+	key := watchKey(rec.ExecutorNode, rec.FlowID, rec.RunID)
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	delete(s.runStarts, key)
+	if s.historySeen == nil || s.historyFile != path {
+		seen := make(map[string]int)
+		records, err := readHistoryFile(path)
+		if err != nil {
+			s.logHistoryError(err)
+			return
+		}
+		for _, r := range records {
+			seen[watchKey(r.ExecutorNode, r.FlowID, r.RunID)] = r.Quality
+		}
+		s.historySeen = seen
+		s.historyFile = path
+	}
+	if s.historySeen[key] >= rec.Quality {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		s.logHistoryError(err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		s.logHistoryError(err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		s.logHistoryError(err)
+		return
+	}
+	_, err = f.Write(append(line, '\n'))
+	_ = f.Close()
+	if err != nil {
+		s.logHistoryError(err)
+		return
+	}
+	s.historySeen[key] = rec.Quality
+	if info, err := os.Stat(path); err == nil && info.Size() > maxHistoryFileBytes {
+		if err := compactHistoryFile(path); err != nil {
+			s.logHistoryError(err)
+		}
+		s.historySeen = nil
+	}
+}
+
+func (s *FlowService) logHistoryError(err error) {
+	if s.logs != nil {
+		s.logs.Appendf("warn", "flow run history failed: %v", err)
+	}
+}
+
+// loadHistory returns stored runs newest first, one per run.
+func (s *FlowService) loadHistory() ([]RunRecord, error) {
+	path, err := s.historyPath()
+	if err != nil {
+		return nil, err
+	}
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	return readHistoryFile(path)
+}
+
+func (s *FlowService) historyPath() (string, error) {
+	if s.store == nil {
+		return "", errors.New("storage not initialized")
+	}
+	dir := s.store.DataDir(s.store.CurrentProfile(), historyDirName)
+	if dir == "" {
+		return "", errors.New("storage not initialized")
+	}
+	return filepath.Join(dir, historyFileName), nil
+}
+
+// readHistoryFile reads the append-only history. A later line for the same
+// run replaces the earlier one; unreadable lines are skipped.
+func readHistoryFile(path string) ([]RunRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RunRecord{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	index := make(map[string]int)
+	var records []RunRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var rec RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.RunID == "" {
+			continue
+		}
+		key := watchKey(rec.ExecutorNode, rec.FlowID, rec.RunID)
+		if i, ok := index[key]; ok {
+			records[i] = rec
+			continue
+		}
+		index[key] = len(records)
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].FinishedAt > records[j].FinishedAt })
+	return records, nil
+}
+
+func compactHistoryFile(path string) error {
+	records, err := readHistoryFile(path)
+	if err != nil {
+		return err
+	}
+	if len(records) > maxHistoryRecords {
+		records = records[:maxHistoryRecords]
+	}
+	var buf bytes.Buffer
+	for i := len(records) - 1; i >= 0; i-- {
+		line, err := json.Marshal(records[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func filterRuns(records []RunRecord, executorNode uint32, flowID string) []RunRecord {
+	out := make([]RunRecord, 0, len(records))
+	for _, rec := range records {
+		if executorNode != 0 && rec.ExecutorNode != executorNode {
+			continue
+		}
+		if flowID != "" && rec.FlowID != flowID {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func aggregateRuns(executor uint32, flowID string, runs []RunRecord) FlowRunStats {
+	stats := FlowRunStats{ExecutorNode: executor, FlowID: flowID, Runs: len(runs), Nodes: []NodeRunStats{}}
+	var durations []int64
+	nodeDurations := make(map[string][]int64)
+	nodeStats := make(map[string]*NodeRunStats)
+	var nodeOrder []string
+	for _, rec := range runs {
+		if rec.Succeeded {
+			stats.Succeeded++
+		} else {
+			stats.Failed++
+		}
+		if rec.FinishedAt > stats.LastRunAt {
+			stats.LastRunAt = rec.FinishedAt
+			stats.LastStatus = rec.Status
+		}
+		if rec.DurationMs > 0 {
+			durations = append(durations, rec.DurationMs)
+		}
+		for _, node := range rec.Nodes {
+			ns, ok := nodeStats[node.ID]
+			if !ok {
+				ns = &NodeRunStats{ID: node.ID}
+				nodeStats[node.ID] = ns
+				nodeOrder = append(nodeOrder, node.ID)
+			}
+			ns.Runs++
+			if isFailedStatus(node.Status) {
+				ns.Failures++
+			}
+			if node.DurationMs > 0 {
+				nodeDurations[node.ID] = append(nodeDurations[node.ID], node.DurationMs)
+			}
+		}
+	}
+	if stats.Runs > 0 {
+		stats.SuccessRate = float64(stats.Succeeded) / float64(stats.Runs)
+	}
+	stats.Timed = len(durations)
+	stats.P50Ms, stats.P95Ms, _ = percentiles(durations)
+	for _, id := range nodeOrder {
+		ns := nodeStats[id]
+		if ns.Runs > 0 {
+			ns.FailRate = float64(ns.Failures) / float64(ns.Runs)
+		}
+		ns.Timed = len(nodeDurations[id])
+		ns.P50Ms, ns.P95Ms, ns.MaxMs = percentiles(nodeDurations[id])
+		stats.Nodes = append(stats.Nodes, *ns)
+	}
+	sort.SliceStable(stats.Nodes, func(i, j int) bool { return stats.Nodes[i].Failures > stats.Nodes[j].Failures })
+	return stats
+}
+
+// percentiles returns the nearest-rank p50 and p95 and the maximum.
+func percentiles(values []int64) (p50, p95, max int64) {
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p int) int64 {
+		i := (p*len(sorted)+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return rank(50), rank(95), sorted[len(sorted)-1]
+}
+
+func isSuccessStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "succeeded", "success", "ok":
+		return true
+	}
+	return false
+}
+
+func isFailedStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "failed", "error", "timeout":
+		return true
+	}
+	return false
+}
+
+func formatMillis(ms int64) string {
+	if ms <= 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+}
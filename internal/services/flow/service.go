@@ -6,12 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/yttydcs/myflowhub-core/eventbus"
 	"github.com/yttydcs/myflowhub-proto/protocol/flow"
 	"github.com/yttydcs/myflowhub-win/internal/services/logs"
 	sessionsvc "github.com/yttydcs/myflowhub-win/internal/services/session"
 	"github.com/yttydcs/myflowhub-win/internal/services/transport"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
 )
 
 const defaultFlowTimeout = 8 * time.Second
@@ -19,13 +22,31 @@ const defaultFlowTimeout = 8 * time.Second
 type FlowService struct {
 	session *sessionsvc.SessionService
 	logs    *logs.LogService
+	store   *storage.Store
+	bus     eventbus.IBus
+
+	versionsMu sync.Mutex
+
+	watchMu sync.Mutex
+	watches map[string]*runWatch
+
+	historyMu   sync.Mutex
+	historyFile string
+	historySeen map[string]int
+	runStarts   map[string]int64
+
+	templatesMu sync.Mutex
 }
 
-func New(session *sessionsvc.SessionService, logsSvc *logs.LogService) *FlowService {
-	return &FlowService{session: session, logs: logsSvc}
+func New(session *sessionsvc.SessionService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *FlowService {
+	return &FlowService{session: session, logs: logsSvc, store: store, bus: bus, watches: make(map[string]*runWatch)}
 }
 
 func (s *FlowService) Set(ctx context.Context, sourceID, targetID uint32, req flow.SetReq) (flow.SetResp, error) {
+	return s.set(ctx, sourceID, targetID, req, VersionSourceSet)
+}
+
+func (s *FlowService) set(ctx context.Context, sourceID, targetID uint32, req flow.SetReq, source string) (flow.SetResp, error) {
 	if strings.TrimSpace(req.ReqID) == "" {
 		return flow.SetResp{}, errors.New("req_id is required")
 	}
@@ -40,6 +61,7 @@ func (s *FlowService) Set(ctx context.Context, sourceID, targetID uint32, req fl
 	if err := s.sendAndAwait(ctx, sourceID, targetID, payload, flow.ActionSet, flow.ActionSetResp, &resp, req.FlowID); err != nil {
 		return flow.SetResp{}, err
 	}
+	s.recordVersion(executorFor(req.ExecutorNode, targetID), req.FlowID, req.Name, req.Trigger, req.Graph, source)
 	return resp, nil
 }
 
@@ -64,6 +86,7 @@ func (s *FlowService) Run(ctx context.Context, sourceID, targetID uint32, req fl
 	if err := s.sendAndAwait(ctx, sourceID, targetID, payload, flow.ActionRun, flow.ActionRunResp, &resp, req.FlowID); err != nil {
 		return flow.RunResp{}, err
 	}
+	s.markRunStarted(executorFor(req.ExecutorNode, targetID), req.FlowID, resp.RunID)
 	return resp, nil
 }
 
@@ -88,6 +111,7 @@ func (s *FlowService) Status(ctx context.Context, sourceID, targetID uint32, req
 	if err := s.sendAndAwait(ctx, sourceID, targetID, payload, flow.ActionStatus, flow.ActionStatusResp, &resp, req.FlowID); err != nil {
 		return flow.StatusResp{}, err
 	}
+	s.recordStatus(executorFor(req.ExecutorNode, targetID), req.FlowID, resp)
 	return resp, nil
 }
 
@@ -133,6 +157,12 @@ func (s *FlowService) Get(ctx context.Context, sourceID, targetID uint32, req fl
 	if err := s.sendAndAwait(ctx, sourceID, targetID, payload, flow.ActionGet, flow.ActionGetResp, &resp, req.FlowID); err != nil {
 		return flow.GetResp{}, err
 	}
+	flowID := resp.FlowID
+	if strings.TrimSpace(flowID) == "" {
+		flowID = req.FlowID
+	}
+	executor := executorFor(resp.ExecutorNode, executorFor(req.ExecutorNode, targetID))
+	s.recordVersion(executor, flowID, resp.Name, resp.Trigger, resp.Graph, VersionSourceGet)
 	return resp, nil
 }
 
@@ -0,0 +1,385 @@
+package flow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+// Defaults the flow editor writes for new nodes; the simulator assumes them
+// when a node leaves retry or timeout_ms unset.
+const (
+	defaultNodeRetry     = 1
+	defaultNodeTimeoutMs = 3000
+	defaultSimDelayMs    = 100
+)
+
+const (
+	SimOutcomeSucceed = "succeed"
+	SimOutcomeFail    = "fail"
+)
+
+// SimMock scripts one node. Each attempt takes DelayMs; it times out when
+// DelayMs exceeds the node's timeout_ms. FailAttempts makes the first N
+// attempts fail before Outcome applies, to model flaky nodes.
+type SimMock struct {
+	Outcome      string `json:"outcome"`
+	DelayMs      int    `json:"delayMs"` // 0 uses SimOptions.DefaultDelayMs
+	FailAttempts int    `json:"failAttempts"`
+	Msg          string `json:"msg"`
+}
+
+type SimOptions struct {
+	Mocks          map[string]SimMock `json:"mocks"`
+	DefaultDelayMs int                `json:"defaultDelayMs"`
+	// MaxParallel limits concurrently running nodes; 0 means unlimited.
+	MaxParallel    int `json:"maxParallel"`
+	RetryBackoffMs int `json:"retryBackoffMs"`
+}
+
+type SimStep struct {
+	AtMs    int64  `json:"atMs"`
+	NodeID  string `json:"nodeId"`
+	Attempt int    `json:"attempt,omitempty"`
+	Event   string `json:"event"`
+	Msg     string `json:"msg,omitempty"`
+}
+
+type SimNodeResult struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	StartMs   int64  `json:"startMs"`
+	EndMs     int64  `json:"endMs"`
+	AllowFail bool   `json:"allowFail"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type SimResult struct {
+	FlowID       string          `json:"flowId"`
+	Status       string          `json:"status"`
+	TotalMs      int64           `json:"totalMs"`
+	WorstCaseMs  int64           `json:"worstCaseMs"`
+	CriticalPath []string        `json:"criticalPath"`
+	Nodes        []SimNodeResult `json:"nodes"`
+	Trace        []SimStep       `json:"trace"`
+	Warnings     []string        `json:"warnings"`
+}
+
+// SimulateFlow predicts how the executor would run req: a node starts when
+// all of its upstream nodes have finished, a failed node without allow_fail
+// skips everything downstream of it, and retry counts extra attempts. Nothing
+// is sent. An invalid definition returns a *ValidationError.
+func (s *FlowService) SimulateFlow(req flow.SetReq, opts SimOptions) (SimResult, error) {
+	if issues := validateSetReq(req); len(issues) > 0 {
+		return SimResult{}, &ValidationError{Issues: issues}
+	}
+	for id, mock := range opts.Mocks {
+		switch strings.ToLower(strings.TrimSpace(mock.Outcome)) {
+		case "", SimOutcomeSucceed, SimOutcomeFail:
+		default:
+			return SimResult{}, fmt.Errorf("mock %s: outcome must be %q or %q", id, SimOutcomeSucceed, SimOutcomeFail)
+		}
+		if mock.DelayMs < 0 || mock.FailAttempts < 0 {
+			return SimResult{}, fmt.Errorf("mock %s: delayMs and failAttempts must not be negative", id)
+		}
+	}
+	if opts.DefaultDelayMs <= 0 {
+		opts.DefaultDelayMs = defaultSimDelayMs
+	}
+	if opts.RetryBackoffMs < 0 {
+		opts.RetryBackoffMs = 0
+	}
+	return newSimulation(req, opts).run(), nil
+}
+
+type simNode struct {
+	node      flow.Node
+	index     int
+	upstream  []string
+	down      []string
+	pending   int
+	blocked   string
+	result    SimNodeResult
+	endAt     int64
+	succeeded bool
+}
+
+type simulation struct {
+	req   flow.SetReq
+	opts  SimOptions
+	nodes map[string]*simNode
+	order []*simNode
+	trace []SimStep
+	now   int64
+}
+
+func newSimulation(req flow.SetReq, opts SimOptions) *simulation {
+	sim := &simulation{req: req, opts: opts, nodes: make(map[string]*simNode, len(req.Graph.Nodes))}
+	for i, node := range req.Graph.Nodes {
+		n := &simNode{node: node, index: i, result: SimNodeResult{ID: node.ID, Status: "pending", AllowFail: node.AllowFail}}
+		sim.nodes[node.ID] = n
+		sim.order = append(sim.order, n)
+	}
+	for _, edge := range req.Graph.Edges {
+		from, to := sim.nodes[edge.From], sim.nodes[edge.To]
+		from.down = append(from.down, edge.To)
+		to.upstream = append(to.upstream, edge.From)
+		to.pending++
+	}
+	return sim
+}
+
+func (sim *simulation) run() SimResult {
+	var ready, running []*simNode
+	for _, n := range sim.order {
+		if n.pending == 0 {
+			ready = append(ready, n)
+		}
+	}
+	for len(ready) > 0 || len(running) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool { return ready[i].index < ready[j].index })
+		for len(ready) > 0 && (sim.opts.MaxParallel <= 0 || len(running) < sim.opts.MaxParallel) {
+			n := ready[0]
+			ready = ready[1:]
+			sim.start(n)
+			running = append(running, n)
+		}
+		// Finish every node that ends at the earliest end time together.
+		sort.SliceStable(running, func(i, j int) bool {
+			if running[i].endAt != running[j].endAt {
+				return running[i].endAt < running[j].endAt
+			}
+			return running[i].index < running[j].index
+		})
+		if len(running) == 0 {
+			break
+		}
+		sim.now = running[0].endAt
+		for len(running) > 0 && running[0].endAt == sim.now {
+			n := running[0]
+			running = running[1:]
+			ready = append(ready, sim.release(n)...)
+		}
+	}
+
+	result := SimResult{
+		FlowID:   sim.req.FlowID,
+		Status:   "succeeded",
+		Nodes:    make([]SimNodeResult, 0, len(sim.order)),
+		Warnings: []string{},
+	}
+	for _, n := range sim.order {
+		result.Nodes = append(result.Nodes, n.result)
+		if n.result.Status == "failed" && !n.node.AllowFail {
+			result.Status = "failed"
+		}
+		if n.result.EndMs > result.TotalMs {
+			result.TotalMs = n.result.EndMs
+		}
+	}
+	sort.SliceStable(sim.trace, func(i, j int) bool { return sim.trace[i].AtMs < sim.trace[j].AtMs })
+	result.Trace = sim.trace
+	result.CriticalPath = sim.criticalPath()
+	result.WorstCaseMs = sim.worstCase()
+	result.Warnings = sim.warnings(result)
+	return result
+}
+
+// start plays all attempts of a node at once; the node finishes at endAt.
+func (sim *simulation) start(n *simNode) {
+	mock, ok := sim.opts.Mocks[n.node.ID]
+	if !ok {
+		mock = SimMock{Outcome: SimOutcomeSucceed, DelayMs: sim.opts.DefaultDelayMs}
+	}
+	if mock.DelayMs == 0 {
+		mock.DelayMs = sim.opts.DefaultDelayMs
+	}
+	outcome := strings.ToLower(strings.TrimSpace(mock.Outcome))
+	timeout := int64(nodeTimeoutMs(n.node))
+	attempts := nodeRetry(n.node) + 1
+
+	n.result.Status = "running"
+	n.result.StartMs = sim.now
+	at := sim.now
+	for attempt := 1; attempt <= attempts; attempt++ {
+		sim.step(at, n.node.ID, attempt, "start", "")
+		n.result.Attempts = attempt
+		delay := int64(mock.DelayMs)
+		switch {
+		case delay > timeout:
+			at += timeout
+			sim.step(at, n.node.ID, attempt, "timeout", fmt.Sprintf("exceeded timeout_ms=%d", timeout))
+		case attempt <= mock.FailAttempts || outcome == SimOutcomeFail:
+			at += delay
+			sim.step(at, n.node.ID, attempt, "fail", mock.Msg)
+		default:
+			at += delay
+			sim.step(at, n.node.ID, attempt, "succeed", mock.Msg)
+			n.succeeded = true
+		}
+		if n.succeeded {
+			break
+		}
+		if attempt < attempts {
+			at += int64(sim.opts.RetryBackoffMs)
+		}
+	}
+	n.endAt = at
+	n.result.EndMs = at
+	if n.succeeded {
+		n.result.Status = "succeeded"
+		return
+	}
+	n.result.Status = "failed"
+	n.result.Reason = fmt.Sprintf("failed after %d attempt(s)", n.result.Attempts)
+}
+
+// release marks downstream nodes of a finished node and returns the ones that
+// became ready. Downstream nodes of a hard failure are skipped transitively.
+func (sim *simulation) release(n *simNode) []*simNode {
+	var ready []*simNode
+	for _, id := range n.down {
+		d := sim.nodes[id]
+		d.pending--
+		if d.blocked == "" {
+			switch {
+			case n.result.Status == "skipped":
+				d.blocked = fmt.Sprintf("upstream %s was skipped", n.node.ID)
+			case n.result.Status == "failed" && !n.node.AllowFail:
+				d.blocked = fmt.Sprintf("upstream %s failed", n.node.ID)
+			}
+		}
+		if d.pending > 0 {
+			continue
+		}
+		if d.blocked != "" {
+			d.result.Status = "skipped"
+			d.result.Reason = d.blocked
+			d.result.StartMs = sim.now
+			d.result.EndMs = sim.now
+			sim.step(sim.now, d.node.ID, 0, "skip", d.blocked)
+			ready = append(ready, sim.release(d)...)
+			continue
+		}
+		ready = append(ready, d)
+	}
+	return ready
+}
+
+func (sim *simulation) step(at int64, nodeID string, attempt int, event, msg string) {
+	sim.trace = append(sim.trace, SimStep{AtMs: at, NodeID: nodeID, Attempt: attempt, Event: event, Msg: msg})
+}
+
+// criticalPath follows, from the last node to finish, the upstream node that
+// finished last.
+func (sim *simulation) criticalPath() []string {
+	var last *simNode
+	for _, n := range sim.order {
+		if n.result.Status == "skipped" {
+			continue
+		}
+		if last == nil || n.result.EndMs > last.result.EndMs {
+			last = n
+		}
+	}
+	var path []string
+	for last != nil {
+		path = append(path, last.node.ID)
+		var next *simNode
+		for _, id := range last.upstream {
+			up := sim.nodes[id]
+			if next == nil || up.result.EndMs > next.result.EndMs {
+				next = up
+			}
+		}
+		last = next
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	if path == nil {
+		return []string{}
+	}
+	return path
+}
+
+// worstCase is the longest path when every attempt of every node runs to its
+// timeout, ignoring backoff.
+func (sim *simulation) worstCase() int64 {
+	memo := make(map[string]int64, len(sim.order))
+	var longest func(n *simNode) int64
+	longest = func(n *simNode) int64 {
+		if v, ok := memo[n.node.ID]; ok {
+			return v
+		}
+		var before int64
+		for _, id := range n.upstream {
+			if v := longest(sim.nodes[id]); v > before {
+				before = v
+			}
+		}
+		v := before + int64(nodeTimeoutMs(n.node))*int64(nodeRetry(n.node)+1)
+		memo[n.node.ID] = v
+		return v
+	}
+	var worst int64
+	for _, n := range sim.order {
+		if v := longest(n); v > worst {
+			worst = v
+		}
+	}
+	return worst
+}
+
+func (sim *simulation) warnings(result SimResult) []string {
+	out := []string{}
+	for _, n := range sim.order {
+		id := n.node.ID
+		switch n.result.Status {
+		case "skipped":
+			out = append(out, fmt.Sprintf("node %s never runs in this scenario (%s)", id, n.result.Reason))
+		case "failed":
+			if n.node.AllowFail {
+				out = append(out, fmt.Sprintf("node %s fails but allow_fail lets downstream nodes run", id))
+			}
+		}
+		if n.node.AllowFail && len(n.down) == 0 {
+			out = append(out, fmt.Sprintf("node %s has allow_fail but no downstream nodes", id))
+		}
+		mock, ok := sim.opts.Mocks[id]
+		if !ok {
+			continue
+		}
+		retry := nodeRetry(n.node)
+		if int64(mock.DelayMs) > int64(nodeTimeoutMs(n.node)) && retry > 0 {
+			out = append(out, fmt.Sprintf("node %s always times out; its %d retries only add %dms", id, retry, int64(retry)*int64(nodeTimeoutMs(n.node))))
+		}
+		if mock.FailAttempts > retry && !strings.EqualFold(mock.Outcome, SimOutcomeFail) {
+			out = append(out, fmt.Sprintf("node %s needs %d retries to recover but has retry=%d", id, mock.FailAttempts, retry))
+		}
+	}
+	every := int64(sim.req.Trigger.EveryMs)
+	if every > 0 && result.TotalMs > every {
+		out = append(out, fmt.Sprintf("predicted run time %dms exceeds trigger every_ms=%d", result.TotalMs, every))
+	} else if every > 0 && result.WorstCaseMs > every {
+		out = append(out, fmt.Sprintf("worst-case run time %dms exceeds trigger every_ms=%d", result.WorstCaseMs, every))
+	}
+	return out
+}
+
+func nodeRetry(node flow.Node) int {
+	if node.Retry == nil {
+		return defaultNodeRetry
+	}
+	return *node.Retry
+}
+
+func nodeTimeoutMs(node flow.Node) int {
+	if node.TimeoutMs == nil {
+		return defaultNodeTimeoutMs
+	}
+	return *node.TimeoutMs
+}
@@ -0,0 +1,619 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+const (
+	cfgFlowTemplates         = "flow.templates"
+	cfgFlowTemplateInstances = "flow.template_instances"
+
+	templateDeployConcurrency = 4
+
+	ParamTypeString = "string"
+	ParamTypeNumber = "number"
+	ParamTypeInt    = "int"
+	ParamTypeBool   = "bool"
+)
+
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+type TemplateParam struct {
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Type     string `json:"type"`
+	Default  string `json:"default"`
+	Required bool   `json:"required"`
+}
+
+// FlowTemplate is a flow file (JSON or YAML, see FlowFile) whose string
+// values may contain {{param}} placeholders. A string that is exactly one
+// placeholder takes the parameter's type, so "{{interval}}" can fill
+// every_ms. Revision grows whenever the definition or parameters change;
+// instances deployed from an older revision are stale.
+type FlowTemplate struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Params      []TemplateParam `json:"params"`
+	Definition  string          `json:"definition"`
+	Revision    int             `json:"revision"`
+	UpdatedAt   int64           `json:"updatedAt"`
+}
+
+// TemplateTarget is one executor to deploy a template to.
+type TemplateTarget struct {
+	ExecutorNode uint32            `json:"executorNode"`
+	Params       map[string]string `json:"params"`
+}
+
+// TemplateInstance tracks a flow deployed from a template so it can be
+// re-rolled when the template changes.
+type TemplateInstance struct {
+	ID           string            `json:"id"`
+	TemplateID   string            `json:"templateId"`
+	Revision     int               `json:"revision"`
+	SourceID     uint32            `json:"sourceId"`
+	TargetID     uint32            `json:"targetId"`
+	ExecutorNode uint32            `json:"executorNode"`
+	FlowID       string            `json:"flowId"`
+	Params       map[string]string `json:"params"`
+	DeployedAt   int64             `json:"deployedAt"`
+	LastError    string            `json:"lastError,omitempty"`
+	Stale        bool              `json:"stale"`
+}
+
+type DeployResult struct {
+	ExecutorNode uint32 `json:"executorNode"`
+	FlowID       string `json:"flowId"`
+	InstanceID   string `json:"instanceId"`
+	OK           bool   `json:"ok"`
+	Error        string `json:"error,omitempty"`
+}
+
+func (s *FlowService) FlowTemplates() ([]FlowTemplate, error) {
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	return s.loadTemplatesLocked()
+}
+
+// SaveFlowTemplate creates or updates a template. The definition is checked
+// by instantiating it with each parameter's default (or a placeholder value).
+func (s *FlowService) SaveFlowTemplate(tpl FlowTemplate) (FlowTemplate, error) {
+	normalized, err := normalizeTemplate(tpl)
+	if err != nil {
+		return FlowTemplate{}, err
+	}
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	list, err := s.loadTemplatesLocked()
+	if err != nil {
+		return FlowTemplate{}, err
+	}
+	normalized.UpdatedAt = time.Now().UnixMilli()
+	found := false
+	for i := range list {
+		if list[i].ID != normalized.ID {
+			continue
+		}
+		normalized.Revision = list[i].Revision
+		if list[i].Definition != normalized.Definition || !sameParams(list[i].Params, normalized.Params) {
+			normalized.Revision++
+		}
+		list[i] = normalized
+		found = true
+		break
+	}
+	if !found {
+		if normalized.ID == "" {
+			id, err := newReqID()
+			if err != nil {
+				return FlowTemplate{}, err
+			}
+			normalized.ID = "tpl-" + id[:12]
+		}
+		normalized.Revision = 1
+		list = append(list, normalized)
+	}
+	if err := s.saveJSONLocked(cfgFlowTemplates, list); err != nil {
+		return FlowTemplate{}, err
+	}
+	return normalized, nil
+}
+
+// DeleteFlowTemplate removes a template and forgets its instances. Deployed
+// flows are left on their executors.
+func (s *FlowService) DeleteFlowTemplate(id string) error {
+	id = strings.TrimSpace(id)
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	list, err := s.loadTemplatesLocked()
+	if err != nil {
+		return err
+	}
+	out := list[:0]
+	for _, tpl := range list {
+		if tpl.ID != id {
+			out = append(out, tpl)
+		}
+	}
+	if len(out) == len(list) {
+		return fmt.Errorf("template %s not found", id)
+	}
+	instances, err := s.loadInstancesLocked()
+	if err != nil {
+		return err
+	}
+	kept := instances[:0]
+	for _, inst := range instances {
+		if inst.TemplateID != id {
+			kept = append(kept, inst)
+		}
+	}
+	if err := s.saveJSONLocked(cfgFlowTemplates, out); err != nil {
+		return err
+	}
+	return s.saveJSONLocked(cfgFlowTemplateInstances, kept)
+}
+
+// InstantiateTemplate renders a template with params into a validated
+// request. ReqID and routing are left for the caller.
+func (s *FlowService) InstantiateTemplate(templateID string, params map[string]string) (flow.SetReq, error) {
+	tpl, err := s.template(templateID)
+	if err != nil {
+		return flow.SetReq{}, err
+	}
+	return instantiate(tpl, params)
+}
+
+// TemplateInstances lists tracked instances of a template; an empty id lists
+// all of them.
+func (s *FlowService) TemplateInstances(templateID string) ([]TemplateInstance, error) {
+	templateID = strings.TrimSpace(templateID)
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	templates, err := s.loadTemplatesLocked()
+	if err != nil {
+		return nil, err
+	}
+	revisions := make(map[string]int, len(templates))
+	for _, tpl := range templates {
+		revisions[tpl.ID] = tpl.Revision
+	}
+	instances, err := s.loadInstancesLocked()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]TemplateInstance, 0, len(instances))
+	for _, inst := range instances {
+		if templateID != "" && inst.TemplateID != templateID {
+			continue
+		}
+		inst.Stale = inst.Revision < revisions[inst.TemplateID] || inst.LastError != ""
+		out = append(out, inst)
+	}
+	return out, nil
+}
+
+// DeployTemplate instantiates a template for each target and sends it with
+// Set, a few at a time. Each target gets its own result; the error is only
+// for problems that stop the whole deployment.
+func (s *FlowService) DeployTemplate(ctx context.Context, sourceID, targetID uint32, templateID string, targets []TemplateTarget) ([]DeployResult, error) {
+	tpl, err := s.template(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+	jobs := make([]TemplateInstance, 0, len(targets))
+	for _, t := range targets {
+		jobs = append(jobs, TemplateInstance{
+			TemplateID:   tpl.ID,
+			SourceID:     sourceID,
+			TargetID:     targetID,
+			ExecutorNode: t.ExecutorNode,
+			Params:       t.Params,
+		})
+	}
+	return s.deployInstances(ctx, tpl, jobs), nil
+}
+
+func (s *FlowService) DeployTemplateSimple(sourceID, targetID uint32, templateID string, targets []TemplateTarget) ([]DeployResult, error) {
+	return s.DeployTemplate(context.Background(), sourceID, targetID, templateID, targets)
+}
+
+// RerollTemplate re-deploys the current template revision to its tracked
+// instances with their saved parameters and routing. With onlyStale, only
+// outdated or previously failed instances are sent.
+func (s *FlowService) RerollTemplate(ctx context.Context, templateID string, onlyStale bool) ([]DeployResult, error) {
+	tpl, err := s.template(templateID)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := s.TemplateInstances(tpl.ID)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]TemplateInstance, 0, len(instances))
+	for _, inst := range instances {
+		if onlyStale && !inst.Stale {
+			continue
+		}
+		jobs = append(jobs, inst)
+	}
+	if len(jobs) == 0 {
+		return []DeployResult{}, nil
+	}
+	return s.deployInstances(ctx, tpl, jobs), nil
+}
+
+func (s *FlowService) RerollTemplateSimple(templateID string, onlyStale bool) ([]DeployResult, error) {
+	return s.RerollTemplate(context.Background(), templateID, onlyStale)
+}
+
+func (s *FlowService) deployInstances(ctx context.Context, tpl FlowTemplate, jobs []TemplateInstance) []DeployResult {
+	results := make([]DeployResult, len(jobs))
+	deployed := make([]TemplateInstance, len(jobs))
+	sem := make(chan struct{}, templateDeployConcurrency)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			deployed[i], results[i] = s.deployInstance(ctx, tpl, jobs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, r := range results {
+		if r.OK {
+			ok++
+		}
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "flow template %s rev %d deployed ok=%d failed=%d", tpl.ID, tpl.Revision, ok, len(results)-ok)
+	}
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	instances, err := s.loadInstancesLocked()
+	if err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "flow template instances not saved: %v", err)
+		}
+		return results
+	}
+	for _, inst := range deployed {
+		if inst.FlowID == "" {
+			continue
+		}
+		replaced := false
+		for i := range instances {
+			if instances[i].ID == inst.ID {
+				instances[i] = inst
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			instances = append(instances, inst)
+		}
+	}
+	if err := s.saveJSONLocked(cfgFlowTemplateInstances, instances); err != nil && s.logs != nil {
+		s.logs.Appendf("warn", "flow template instances not saved: %v", err)
+	}
+	return results
+}
+
+func (s *FlowService) deployInstance(ctx context.Context, tpl FlowTemplate, inst TemplateInstance) (TemplateInstance, DeployResult) {
+	result := DeployResult{ExecutorNode: inst.ExecutorNode}
+	req, err := instantiate(tpl, inst.Params)
+	if err != nil {
+		result.Error = err.Error()
+		result.InstanceID = inst.ID
+		inst.LastError = err.Error()
+		return inst, result
+	}
+	result.FlowID = req.FlowID
+	if inst.ID == "" {
+		inst.ID = fmt.Sprintf("%s|%d|%s", tpl.ID, inst.ExecutorNode, req.FlowID)
+	}
+	inst.FlowID = req.FlowID
+	result.InstanceID = inst.ID
+
+	reqID, err := newReqID()
+	if err == nil {
+		req.ReqID = reqID
+		req.OriginNode = inst.SourceID
+		req.ExecutorNode = inst.ExecutorNode
+		callCtx, cancel := context.WithTimeout(ctx, defaultFlowTimeout)
+		_, err = s.Set(callCtx, inst.SourceID, inst.TargetID, req)
+		cancel()
+	}
+	if err != nil {
+		result.Error = err.Error()
+		inst.LastError = err.Error()
+		return inst, result
+	}
+	result.OK = true
+	inst.Revision = tpl.Revision
+	inst.DeployedAt = time.Now().UnixMilli()
+	inst.LastError = ""
+	inst.Stale = false
+	return inst, result
+}
+
+func (s *FlowService) template(id string) (FlowTemplate, error) {
+	id = strings.TrimSpace(id)
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	list, err := s.loadTemplatesLocked()
+	if err != nil {
+		return FlowTemplate{}, err
+	}
+	for _, tpl := range list {
+		if tpl.ID == id {
+			return tpl, nil
+		}
+	}
+	return FlowTemplate{}, fmt.Errorf("template %s not found", id)
+}
+
+func (s *FlowService) loadTemplatesLocked() ([]FlowTemplate, error) {
+	out := []FlowTemplate{}
+	if err := s.loadJSONLocked(cfgFlowTemplates, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *FlowService) loadInstancesLocked() ([]TemplateInstance, error) {
+	out := []TemplateInstance{}
+	if err := s.loadJSONLocked(cfgFlowTemplateInstances, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *FlowService) loadJSONLocked(key string, out any) error {
+	if s.store == nil {
+		return errors.New("storage not initialized")
+	}
+	raw := strings.TrimSpace(s.store.GetString(s.store.CurrentProfile(), key, ""))
+	if raw == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), out); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FlowService) saveJSONLocked(key string, v any) error {
+	if s.store == nil {
+		return errors.New("storage not initialized")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.store.SetString(s.store.CurrentProfile(), key, string(data))
+}
+
+func normalizeTemplate(tpl FlowTemplate) (FlowTemplate, error) {
+	tpl.ID = strings.TrimSpace(tpl.ID)
+	tpl.Name = strings.TrimSpace(tpl.Name)
+	if tpl.Name == "" {
+		return FlowTemplate{}, errors.New("template name is required")
+	}
+	if strings.TrimSpace(tpl.Definition) == "" {
+		return FlowTemplate{}, errors.New("template definition is required")
+	}
+	declared := make(map[string]bool, len(tpl.Params))
+	for i := range tpl.Params {
+		p := &tpl.Params[i]
+		p.Name = strings.TrimSpace(p.Name)
+		p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+		if p.Type == "" {
+			p.Type = ParamTypeString
+		}
+		if !templatePlaceholder.MatchString("{{" + p.Name + "}}") {
+			return FlowTemplate{}, fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if declared[p.Name] {
+			return FlowTemplate{}, fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		declared[p.Name] = true
+		switch p.Type {
+		case ParamTypeString, ParamTypeNumber, ParamTypeInt, ParamTypeBool:
+		default:
+			return FlowTemplate{}, fmt.Errorf("parameter %s: unknown type %q", p.Name, p.Type)
+		}
+		if p.Default != "" {
+			if _, err := convertParam(*p, p.Default); err != nil {
+				return FlowTemplate{}, fmt.Errorf("parameter %s default: %w", p.Name, err)
+			}
+		}
+	}
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(tpl.Definition, -1) {
+		if !declared[m[1]] {
+			return FlowTemplate{}, fmt.Errorf("placeholder {{%s}} is not a declared parameter", m[1])
+		}
+	}
+	if _, err := parseTemplateDefinition(tpl.Definition); err != nil {
+		return FlowTemplate{}, err
+	}
+	// Check the shape with stand-in values; real values are validated again
+	// on every instantiation.
+	sample := make(map[string]string, len(tpl.Params))
+	for _, p := range tpl.Params {
+		sample[p.Name] = sampleParamValue(p)
+	}
+	if _, err := instantiate(tpl, sample); err != nil {
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			return FlowTemplate{}, err
+		}
+	}
+	return tpl, nil
+}
+
+func instantiate(tpl FlowTemplate, params map[string]string) (flow.SetReq, error) {
+	values := make(map[string]any, len(tpl.Params))
+	declared := make(map[string]bool, len(tpl.Params))
+	for _, p := range tpl.Params {
+		declared[p.Name] = true
+		raw, ok := params[p.Name]
+		if !ok || raw == "" {
+			raw = p.Default
+		}
+		if raw == "" {
+			if p.Required {
+				return flow.SetReq{}, fmt.Errorf("parameter %s is required", p.Name)
+			}
+			if p.Type != ParamTypeString {
+				return flow.SetReq{}, fmt.Errorf("parameter %s has no value", p.Name)
+			}
+		}
+		v, err := convertParam(p, raw)
+		if err != nil {
+			return flow.SetReq{}, fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		values[p.Name] = v
+	}
+	for name := range params {
+		if !declared[name] {
+			return flow.SetReq{}, fmt.Errorf("unknown parameter %s", name)
+		}
+	}
+	tree, err := parseTemplateDefinition(tpl.Definition)
+	if err != nil {
+		return flow.SetReq{}, err
+	}
+	data, err := json.Marshal(substituteParams(tree, values))
+	if err != nil {
+		return flow.SetReq{}, err
+	}
+	return ParseFlowFile(data, FileFormatJSON)
+}
+
+func parseTemplateDefinition(def string) (any, error) {
+	data := []byte(def)
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		converted, err := yamlToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, fmt.Errorf("template definition: %w", err)
+	}
+	return tree, nil
+}
+
+// substituteParams replaces placeholders inside string values. A string that
+// is a single placeholder becomes the typed value itself.
+func substituteParams(v any, values map[string]any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			t[k] = substituteParams(child, values)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			t[i] = substituteParams(child, values)
+		}
+		return t
+	case string:
+		if m := templatePlaceholder.FindStringSubmatch(t); m != nil && m[0] == strings.TrimSpace(t) {
+			return values[m[1]]
+		}
+		return templatePlaceholder.ReplaceAllStringFunc(t, func(match string) string {
+			name := templatePlaceholder.FindStringSubmatch(match)[1]
+			return fmt.Sprint(values[name])
+		})
+	default:
+		return v
+	}
+}
+
+func convertParam(p TemplateParam, raw string) (any, error) {
+	raw = strings.TrimSpace(raw)
+	switch p.Type {
+	case ParamTypeNumber:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), nil
+	case ParamTypeInt:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return n, nil
+	case ParamTypeBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return b, nil
+	default:
+		return raw, nil
+	}
+}
+
+func sampleParamValue(p TemplateParam) string {
+	if p.Default != "" {
+		return p.Default
+	}
+	switch p.Type {
+	case ParamTypeNumber, ParamTypeInt:
+		return "1"
+	case ParamTypeBool:
+		return "false"
+	default:
+		return p.Name
+	}
+}
+
+func sameParams(a, b []TemplateParam) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	key := func(list []TemplateParam) []string {
+		out := make([]string, 0, len(list))
+		for _, p := range list {
+			out = append(out, fmt.Sprintf("%s|%s|%s|%t", p.Name, p.Type, p.Default, p.Required))
+		}
+		sort.Strings(out)
+		return out
+	}
+	ka, kb := key(a), key(b)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
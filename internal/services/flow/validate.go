@@ -0,0 +1,210 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+const (
+	NodeKindLocal = "local"
+	NodeKindExec  = "exec"
+
+	TriggerInterval = "interval"
+
+	maxNodeRetry     = 10
+	minNodeTimeoutMs = 1
+	maxNodeTimeoutMs = 3600000
+	maxFlowNodes     = 500
+)
+
+// ValidationIssue points at one problem in a flow definition. Path uses the
+// JSON field names, e.g. graph.nodes[2].timeout_ms.
+type ValidationIssue struct {
+	Path string `json:"path"`
+	Msg  string `json:"msg"`
+}
+
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		parts = append(parts, issue.Path+": "+issue.Msg)
+	}
+	return "flow invalid: " + strings.Join(parts, "; ")
+}
+
+// ValidateFlow checks a flow definition without sending it and returns every
+// issue found; an empty list means the flow is valid.
+func (s *FlowService) ValidateFlow(req flow.SetReq) ([]ValidationIssue, error) {
+	return validateSetReq(req), nil
+}
+
+func validateSetReq(req flow.SetReq) []ValidationIssue {
+	var issues []ValidationIssue
+	add := func(path, format string, args ...any) {
+		issues = append(issues, ValidationIssue{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(req.FlowID) == "" {
+		add("flow_id", "is required")
+	}
+	switch req.Trigger.Type {
+	case TriggerInterval:
+		if req.Trigger.EveryMs == 0 {
+			add("trigger.every_ms", "must be positive for interval triggers")
+		}
+	case "":
+		add("trigger.type", "is required")
+	default:
+		add("trigger.type", "unknown trigger type %q", req.Trigger.Type)
+	}
+
+	nodes := req.Graph.Nodes
+	if len(nodes) == 0 {
+		add("graph.nodes", "at least one node is required")
+	}
+	if len(nodes) > maxFlowNodes {
+		add("graph.nodes", "at most %d nodes are allowed", maxFlowNodes)
+	}
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		path := fmt.Sprintf("graph.nodes[%d]", i)
+		id := node.ID
+		switch {
+		case strings.TrimSpace(id) == "":
+			add(path+".id", "is required")
+		case strings.TrimSpace(id) != id:
+			add(path+".id", "must not have leading or trailing spaces")
+		default:
+			if first, dup := index[id]; dup {
+				add(path+".id", "duplicate id %q (first used by graph.nodes[%d])", id, first)
+			} else {
+				index[id] = i
+			}
+		}
+		switch node.Kind {
+		case NodeKindLocal, NodeKindExec:
+		case "":
+			add(path+".kind", "is required")
+		default:
+			add(path+".kind", "must be %q or %q, got %q", NodeKindLocal, NodeKindExec, node.Kind)
+		}
+		if node.Retry != nil && (*node.Retry < 0 || *node.Retry > maxNodeRetry) {
+			add(path+".retry", "must be between 0 and %d, got %d", maxNodeRetry, *node.Retry)
+		}
+		if node.TimeoutMs != nil && (*node.TimeoutMs < minNodeTimeoutMs || *node.TimeoutMs > maxNodeTimeoutMs) {
+			add(path+".timeout_ms", "must be between %d and %d, got %d", minNodeTimeoutMs, maxNodeTimeoutMs, *node.TimeoutMs)
+		}
+		issues = append(issues, validateSpec(path+".spec", node)...)
+	}
+
+	for i, edge := range req.Graph.Edges {
+		path := fmt.Sprintf("graph.edges[%d]", i)
+		if _, ok := index[edge.From]; !ok {
+			add(path+".from", "references unknown node %q", edge.From)
+		}
+		if _, ok := index[edge.To]; !ok {
+			add(path+".to", "references unknown node %q", edge.To)
+		}
+	}
+	if cycle := findCycle(nodes, req.Graph.Edges, index); len(cycle) > 0 {
+		add("graph.edges", "cycle detected: %s", strings.Join(cycle, " -> "))
+	}
+	return issues
+}
+
+type nodeSpec struct {
+	Method string          `json:"method"`
+	Target json.RawMessage `json:"target"`
+	Args   json.RawMessage `json:"args"`
+}
+
+func validateSpec(path string, node flow.Node) []ValidationIssue {
+	var issues []ValidationIssue
+	if len(node.Spec) == 0 {
+		return []ValidationIssue{{Path: path, Msg: "is required"}}
+	}
+	var spec nodeSpec
+	if err := json.Unmarshal(node.Spec, &spec); err != nil {
+		return []ValidationIssue{{Path: path, Msg: "must be a JSON object"}}
+	}
+	if strings.TrimSpace(spec.Method) == "" {
+		issues = append(issues, ValidationIssue{Path: path + ".method", Msg: "is required"})
+	}
+	if node.Kind == NodeKindExec {
+		var target uint64
+		if len(spec.Target) == 0 || json.Unmarshal(spec.Target, &target) != nil || target == 0 {
+			issues = append(issues, ValidationIssue{Path: path + ".target", Msg: "exec nodes need a positive target node id"})
+		}
+	}
+	if len(spec.Args) > 0 && !json.Valid(spec.Args) {
+		issues = append(issues, ValidationIssue{Path: path + ".args", Msg: "must be valid JSON"})
+	}
+	return issues
+}
+
+// findCycle returns the node ids of one cycle (first id repeated at the end),
+// or nil when the graph is a DAG. Edges to unknown nodes are ignored.
+func findCycle(nodes []flow.Node, edges []flow.Edge, index map[string]int) []string {
+	adj := make(map[string][]string, len(index))
+	for _, edge := range edges {
+		if _, ok := index[edge.From]; !ok {
+			continue
+		}
+		if _, ok := index[edge.To]; !ok {
+			continue
+		}
+		adj[edge.From] = append(adj[edge.From], edge.To)
+	}
+	for id := range adj {
+		sort.Strings(adj[id])
+	}
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(index))
+	var stack []string
+	var cycle []string
+	var visit func(id string) bool
+	visit = func(id string) bool {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, next := range adj[id] {
+			switch state[next] {
+			case visiting:
+				for i, v := range stack {
+					if v == next {
+						cycle = append(append([]string(nil), stack[i:]...), next)
+						break
+					}
+				}
+				return true
+			case unvisited:
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return false
+	}
+	for _, node := range nodes {
+		if _, ok := index[node.ID]; !ok || state[node.ID] != unvisited {
+			continue
+		}
+		if visit(node.ID) {
+			return cycle
+		}
+	}
+	return nil
+}
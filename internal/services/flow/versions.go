@@ -0,0 +1,333 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+const (
+	versionsDirName = "flow_versions"
+	// Oldest versions beyond this are dropped per flow.
+	maxFlowVersions = 200
+
+	VersionSourceSet      = "set"
+	VersionSourceGet      = "get"
+	VersionSourceRollback = "rollback"
+)
+
+// FlowVersion is one stored snapshot of a flow definition. Consecutive
+// snapshots with the same hash are collapsed into one.
+type FlowVersion struct {
+	ID           string       `json:"id"`
+	ExecutorNode uint32       `json:"executorNode"`
+	FlowID       string       `json:"flowId"`
+	Hash         string       `json:"hash"`
+	Source       string       `json:"source"`
+	CreatedAt    int64        `json:"createdAt"`
+	Name         string       `json:"name"`
+	Trigger      flow.Trigger `json:"trigger"`
+	Graph        flow.Graph   `json:"graph"`
+}
+
+// FlowVersionInfo is a FlowVersion without the definition, for listings.
+type FlowVersionInfo struct {
+	ID           string `json:"id"`
+	ExecutorNode uint32 `json:"executorNode"`
+	FlowID       string `json:"flowId"`
+	Hash         string `json:"hash"`
+	Source       string `json:"source"`
+	CreatedAt    int64  `json:"createdAt"`
+	Name         string `json:"name"`
+	EveryMs      uint64 `json:"everyMs"`
+	Nodes        int    `json:"nodes"`
+	Edges        int    `json:"edges"`
+}
+
+type versionFile struct {
+	ExecutorNode uint32        `json:"executorNode"`
+	FlowID       string        `json:"flowId"`
+	Versions     []FlowVersion `json:"versions"`
+}
+
+// FlowVersions lists stored versions of a flow, newest first.
+func (s *FlowService) FlowVersions(executorNode uint32, flowID string) ([]FlowVersionInfo, error) {
+	file, err := s.loadVersions(executorNode, flowID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]FlowVersionInfo, 0, len(file.Versions))
+	for i := len(file.Versions) - 1; i >= 0; i-- {
+		v := file.Versions[i]
+		out = append(out, FlowVersionInfo{
+			ID:           v.ID,
+			ExecutorNode: v.ExecutorNode,
+			FlowID:       v.FlowID,
+			Hash:         v.Hash,
+			Source:       v.Source,
+			CreatedAt:    v.CreatedAt,
+			Name:         v.Name,
+			EveryMs:      v.Trigger.EveryMs,
+			Nodes:        len(v.Graph.Nodes),
+			Edges:        len(v.Graph.Edges),
+		})
+	}
+	return out, nil
+}
+
+// FlowVersion returns a single stored version with its definition.
+func (s *FlowService) FlowVersion(executorNode uint32, flowID, versionID string) (FlowVersion, error) {
+	file, err := s.loadVersions(executorNode, flowID)
+	if err != nil {
+		return FlowVersion{}, err
+	}
+	return findVersion(file, versionID)
+}
+
+// DiffFlowVersions compares two stored versions of the same flow.
+func (s *FlowService) DiffFlowVersions(executorNode uint32, flowID, fromID, toID string) (FlowDiff, error) {
+	file, err := s.loadVersions(executorNode, flowID)
+	if err != nil {
+		return FlowDiff{}, err
+	}
+	from, err := findVersion(file, fromID)
+	if err != nil {
+		return FlowDiff{}, err
+	}
+	to, err := findVersion(file, toID)
+	if err != nil {
+		return FlowDiff{}, err
+	}
+	diff := DiffFlows(
+		flow.SetReq{FlowID: from.FlowID, Name: from.Name, Trigger: from.Trigger, Graph: from.Graph},
+		flow.SetReq{FlowID: to.FlowID, Name: to.Name, Trigger: to.Trigger, Graph: to.Graph},
+	)
+	diff.FromVersion = from.ID
+	diff.ToVersion = to.ID
+	return diff, nil
+}
+
+// RollbackFlow re-sends a stored version to its executor with Set.
+func (s *FlowService) RollbackFlow(ctx context.Context, sourceID, targetID, executorNode uint32, flowID, versionID string) (flow.SetResp, error) {
+	version, err := s.FlowVersion(executorNode, flowID, versionID)
+	if err != nil {
+		return flow.SetResp{}, err
+	}
+	reqID, err := newReqID()
+	if err != nil {
+		return flow.SetResp{}, err
+	}
+	req := flow.SetReq{
+		ReqID:        reqID,
+		OriginNode:   sourceID,
+		ExecutorNode: executorNode,
+		FlowID:       version.FlowID,
+		Name:         version.Name,
+		Trigger:      version.Trigger,
+		Graph:        version.Graph,
+	}
+	resp, err := s.set(ctx, sourceID, targetID, req, VersionSourceRollback)
+	if err != nil {
+		return flow.SetResp{}, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "flow rolled back flow_id=%s version=%s", version.FlowID, version.ID)
+	}
+	return resp, nil
+}
+
+func (s *FlowService) RollbackFlowSimple(sourceID, targetID, executorNode uint32, flowID, versionID string) (flow.SetResp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFlowTimeout)
+	defer cancel()
+	return s.RollbackFlow(ctx, sourceID, targetID, executorNode, flowID, versionID)
+}
+
+// recordVersion stores a snapshot unless it matches the latest one. Failures
+// are logged and never fail the request that produced the snapshot.
+func (s *FlowService) recordVersion(executorNode uint32, flowID, name string, trigger flow.Trigger, graph flow.Graph, source string) {
+	if s.store == nil || strings.TrimSpace(flowID) == "" {
+		return
+	}
+	hash, err := flowHash(name, trigger, graph)
+	if err != nil {
+		s.logVersionError(flowID, err)
+		return
+	}
+	s.versionsMu.Lock()
+	defer s.versionsMu.Unlock()
+	file, err := s.loadVersionsLocked(executorNode, flowID)
+	if err != nil {
+		s.logVersionError(flowID, err)
+		return
+	}
+	if n := len(file.Versions); n > 0 && file.Versions[n-1].Hash == hash {
+		return
+	}
+	id, err := newReqID()
+	if err != nil {
+		s.logVersionError(flowID, err)
+		return
+	}
+	file.Versions = append(file.Versions, FlowVersion{
+		ID:           "v-" + id[:12],
+		ExecutorNode: executorNode,
+		FlowID:       flowID,
+		Hash:         hash,
+		Source:       source,
+		CreatedAt:    time.Now().UnixMilli(),
+		Name:         name,
+		Trigger:      trigger,
+		Graph:        graph,
+	})
+	if len(file.Versions) > maxFlowVersions {
+		file.Versions = append([]FlowVersion(nil), file.Versions[len(file.Versions)-maxFlowVersions:]...)
+	}
+	if err := s.saveVersionsLocked(file); err != nil {
+		s.logVersionError(flowID, err)
+	}
+}
+
+func (s *FlowService) logVersionError(flowID string, err error) {
+	if s.logs != nil {
+		s.logs.Appendf("warn", "flow version store failed flow_id=%s: %v", flowID, err)
+	}
+}
+
+func (s *FlowService) loadVersions(executorNode uint32, flowID string) (versionFile, error) {
+	if strings.TrimSpace(flowID) == "" {
+		return versionFile{}, errors.New("flow_id is required")
+	}
+	s.versionsMu.Lock()
+	defer s.versionsMu.Unlock()
+	return s.loadVersionsLocked(executorNode, flowID)
+}
+
+func (s *FlowService) loadVersionsLocked(executorNode uint32, flowID string) (versionFile, error) {
+	path, err := s.versionsPath(executorNode, flowID)
+	if err != nil {
+		return versionFile{}, err
+	}
+	empty := versionFile{ExecutorNode: executorNode, FlowID: flowID}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return empty, nil
+		}
+		return versionFile{}, err
+	}
+	var file versionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return versionFile{}, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	if file.FlowID != flowID || file.ExecutorNode != executorNode {
+		// Hash collision on the file name; treat as no history.
+		return empty, nil
+	}
+	return file, nil
+}
+
+func (s *FlowService) saveVersionsLocked(file versionFile) error {
+	path, err := s.versionsPath(file.ExecutorNode, file.FlowID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FlowService) versionsPath(executorNode uint32, flowID string) (string, error) {
+	if s.store == nil {
+		return "", errors.New("storage not initialized")
+	}
+	dir := s.store.DataDir(s.store.CurrentProfile(), versionsDirName)
+	if dir == "" {
+		return "", errors.New("storage not initialized")
+	}
+	sum := sha256.Sum256([]byte(flowID))
+	return filepath.Join(dir, fmt.Sprintf("%d-%s.json", executorNode, hex.EncodeToString(sum[:8]))), nil
+}
+
+func findVersion(file versionFile, versionID string) (FlowVersion, error) {
+	versionID = strings.TrimSpace(versionID)
+	for _, v := range file.Versions {
+		if v.ID == versionID {
+			return v, nil
+		}
+	}
+	return FlowVersion{}, fmt.Errorf("version %q not found for flow %s", versionID, file.FlowID)
+}
+
+// flowHash hashes the canonical JSON of a definition. Specs are re-encoded so
+// key order and whitespace do not produce spurious versions.
+func flowHash(name string, trigger flow.Trigger, graph flow.Graph) (string, error) {
+	nodes := make([]flow.Node, len(graph.Nodes))
+	for i, node := range graph.Nodes {
+		spec, err := canonicalJSON(node.Spec)
+		if err != nil {
+			return "", fmt.Errorf("node %s spec: %w", node.ID, err)
+		}
+		node.Spec = spec
+		nodes[i] = node
+	}
+	data, err := json.Marshal(struct {
+		Name    string       `json:"name"`
+		Trigger flow.Trigger `json:"trigger"`
+		Graph   flow.Graph   `json:"graph"`
+	}{name, trigger, flow.Graph{Nodes: nodes, Edges: graph.Edges}})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func canonicalJSON(raw json.RawMessage) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// executorFor picks the node a flow is stored under: the explicit executor,
+// else the node the request was addressed to.
+func executorFor(executorNode, targetID uint32) uint32 {
+	if executorNode != 0 {
+		return executorNode
+	}
+	return targetID
+}
+
+func newReqID() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
@@ -0,0 +1,387 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+)
+
+// The hub does not push run status, so watching polls Status: fast while
+// things change, backing off while the run is quiet.
+const (
+	minWatchInterval   = 250 * time.Millisecond
+	maxWatchInterval   = 5 * time.Second
+	maxWatchDuration   = time.Hour
+	maxWatchPollErrors = 5
+	// Finished timelines kept in memory for RunTimelines.
+	maxKeptTimelines = 50
+)
+
+type runWatch struct {
+	timeline RunTimeline
+	cancel   context.CancelFunc
+}
+
+// WatchRun follows a run until it reaches a terminal status and returns the
+// timeline after the first poll. An empty runID watches the latest run.
+// Watching an already watched run returns its current timeline.
+func (s *FlowService) WatchRun(sourceID, targetID, executorNode uint32, flowID, runID string) (RunTimeline, error) {
+	flowID = strings.TrimSpace(flowID)
+	if flowID == "" {
+		return RunTimeline{}, errors.New("flow_id is required")
+	}
+	runID = strings.TrimSpace(runID)
+	executor := executorFor(executorNode, targetID)
+	if runID != "" {
+		if tl, ok := s.activeTimeline(executor, flowID, runID); ok {
+			return tl, nil
+		}
+	}
+
+	first, err := s.pollStatus(context.Background(), sourceID, targetID, executorNode, flowID, runID)
+	if err != nil {
+		return RunTimeline{}, err
+	}
+	if strings.TrimSpace(first.RunID) != "" {
+		runID = strings.TrimSpace(first.RunID)
+	}
+	if runID == "" {
+		return RunTimeline{}, fmt.Errorf("flow %s has no run to watch", flowID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxWatchDuration)
+	key := watchKey(executor, flowID, runID)
+	s.watchMu.Lock()
+	if s.watches == nil {
+		s.watches = make(map[string]*runWatch)
+	}
+	if w, ok := s.watches[key]; ok && w.timeline.Watching {
+		tl := copyTimeline(w.timeline)
+		s.watchMu.Unlock()
+		cancel()
+		return tl, nil
+	}
+	w := &runWatch{
+		timeline: RunTimeline{
+			ExecutorNode: executor,
+			FlowID:       flowID,
+			RunID:        runID,
+			Watching:     true,
+			Nodes:        []NodeTimeline{},
+			Transitions:  []RunTransition{},
+		},
+		cancel: cancel,
+	}
+	s.watches[key] = w
+	changes := applyStatus(&w.timeline, first, time.Now())
+	tl := copyTimeline(w.timeline)
+	s.watchMu.Unlock()
+
+	if s.logs != nil {
+		s.logs.Appendf("info", "flow watch started flow_id=%s run_id=%s", flowID, runID)
+	}
+	s.emitProgress(changes, tl)
+	if tl.Done {
+		s.finishWatch(key, nil)
+		cancel()
+		return s.timelineByKey(key), nil
+	}
+	go s.watchLoop(ctx, key, sourceID, targetID, executorNode)
+	return tl, nil
+}
+
+// StopWatchRun stops watching a run. The timeline is kept. targetID and
+// executorNode resolve the executor the same way as in WatchRun.
+func (s *FlowService) StopWatchRun(targetID, executorNode uint32, flowID, runID string) error {
+	key := watchKey(executorFor(executorNode, targetID), strings.TrimSpace(flowID), strings.TrimSpace(runID))
+	s.watchMu.Lock()
+	w, ok := s.watches[key]
+	s.watchMu.Unlock()
+	if !ok {
+		return fmt.Errorf("run %s of flow %s is not watched", runID, flowID)
+	}
+	w.cancel()
+	return nil
+}
+
+// RunTimeline returns the recorded timeline of a watched run.
+func (s *FlowService) RunTimeline(targetID, executorNode uint32, flowID, runID string) (RunTimeline, error) {
+	key := watchKey(executorFor(executorNode, targetID), strings.TrimSpace(flowID), strings.TrimSpace(runID))
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	w, ok := s.watches[key]
+	if !ok {
+		return RunTimeline{}, fmt.Errorf("no timeline for run %s of flow %s", runID, flowID)
+	}
+	return copyTimeline(w.timeline), nil
+}
+
+// RunTimelines lists active and recently finished watched runs, newest first.
+func (s *FlowService) RunTimelines() []RunTimeline {
+	s.watchMu.Lock()
+	out := make([]RunTimeline, 0, len(s.watches))
+	for _, w := range s.watches {
+		out = append(out, copyTimeline(w.timeline))
+	}
+	s.watchMu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt > out[j].StartedAt })
+	return out
+}
+
+// Close stops all run watchers.
+func (s *FlowService) Close() {
+	s.watchMu.Lock()
+	for _, w := range s.watches {
+		w.cancel()
+	}
+	s.watchMu.Unlock()
+}
+
+func (s *FlowService) watchLoop(ctx context.Context, key string, sourceID, targetID, executorNode uint32) {
+	s.watchMu.Lock()
+	flowID := s.watches[key].timeline.FlowID
+	runID := s.watches[key].timeline.RunID
+	s.watchMu.Unlock()
+
+	interval := minWatchInterval
+	failures := 0
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			var err error
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("watch gave up after %s", maxWatchDuration)
+			}
+			s.finishWatch(key, err)
+			return
+		case <-timer.C:
+		}
+
+		resp, err := s.pollStatus(ctx, sourceID, targetID, executorNode, flowID, runID)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			failures++
+			if failures >= maxWatchPollErrors {
+				s.finishWatch(key, fmt.Errorf("status poll failed %d times: %w", failures, err))
+				return
+			}
+			interval = nextWatchInterval(interval)
+			timer.Reset(interval)
+			continue
+		}
+		failures = 0
+
+		s.watchMu.Lock()
+		w := s.watches[key]
+		changes := applyStatus(&w.timeline, resp, time.Now())
+		tl := copyTimeline(w.timeline)
+		s.watchMu.Unlock()
+
+		if len(changes) > 0 {
+			s.emitProgress(changes, tl)
+			interval = minWatchInterval
+		} else {
+			interval = nextWatchInterval(interval)
+		}
+		if tl.Done {
+			s.finishWatch(key, nil)
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+func (s *FlowService) pollStatus(ctx context.Context, sourceID, targetID, executorNode uint32, flowID, runID string) (flow.StatusResp, error) {
+	reqID, err := newReqID()
+	if err != nil {
+		return flow.StatusResp{}, err
+	}
+	pollCtx, cancel := context.WithTimeout(ctx, defaultFlowTimeout)
+	defer cancel()
+	return s.Status(pollCtx, sourceID, targetID, flow.StatusReq{
+		ReqID:        reqID,
+		OriginNode:   sourceID,
+		ExecutorNode: executorNode,
+		FlowID:       flowID,
+		RunID:        runID,
+	})
+}
+
+// finishWatch marks a watch stopped, emits the final timeline once and
+// prunes old finished timelines.
+func (s *FlowService) finishWatch(key string, err error) {
+	s.watchMu.Lock()
+	w, ok := s.watches[key]
+	if !ok || !w.timeline.Watching {
+		s.watchMu.Unlock()
+		return
+	}
+	w.cancel()
+	w.timeline.Watching = false
+	if err != nil {
+		w.timeline.Error = err.Error()
+	}
+	tl := copyTimeline(w.timeline)
+	s.pruneTimelinesLocked()
+	s.watchMu.Unlock()
+	s.recordTimeline(tl)
+
+	if s.logs != nil {
+		switch {
+		case err != nil:
+			s.logs.Appendf("warn", "flow watch stopped flow_id=%s run_id=%s: %v", tl.FlowID, tl.RunID, err)
+		case tl.Done:
+			s.logs.Appendf("info", "flow run finished flow_id=%s run_id=%s status=%s duration=%dms", tl.FlowID, tl.RunID, tl.Status, tl.DurationMs)
+		default:
+			s.logs.Appendf("info", "flow watch stopped flow_id=%s run_id=%s", tl.FlowID, tl.RunID)
+		}
+	}
+	s.emitProgress(nil, tl)
+}
+
+func (s *FlowService) pruneTimelinesLocked() {
+	var finished []string
+	for key, w := range s.watches {
+		if !w.timeline.Watching {
+			finished = append(finished, key)
+		}
+	}
+	if len(finished) <= maxKeptTimelines {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return s.watches[finished[i]].timeline.StartedAt < s.watches[finished[j]].timeline.StartedAt
+	})
+	for _, key := range finished[:len(finished)-maxKeptTimelines] {
+		delete(s.watches, key)
+	}
+}
+
+func (s *FlowService) activeTimeline(executor uint32, flowID, runID string) (RunTimeline, bool) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	w, ok := s.watches[watchKey(executor, flowID, runID)]
+	if !ok || !w.timeline.Watching {
+		return RunTimeline{}, false
+	}
+	return copyTimeline(w.timeline), true
+}
+
+func (s *FlowService) timelineByKey(key string) RunTimeline {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if w, ok := s.watches[key]; ok {
+		return copyTimeline(w.timeline)
+	}
+	return RunTimeline{}
+}
+
+func (s *FlowService) emitProgress(changes []RunTransition, tl RunTimeline) {
+	if s.bus == nil {
+		return
+	}
+	if changes == nil {
+		changes = []RunTransition{}
+	}
+	_ = s.bus.Publish(context.Background(), EventFlowRunProgress, RunProgressEvent{Changes: changes, Timeline: tl}, nil)
+}
+
+// applyStatus folds one Status response into the timeline and returns the
+// transitions it caused.
+func applyStatus(tl *RunTimeline, resp flow.StatusResp, now time.Time) []RunTransition {
+	ms := now.UnixMilli()
+	tl.Polls++
+	if tl.StartedAt == 0 {
+		tl.StartedAt = ms
+	}
+	var changes []RunTransition
+	if resp.Status != "" && resp.Status != tl.Status {
+		changes = append(changes, RunTransition{At: ms, From: tl.Status, To: resp.Status})
+		tl.Status = resp.Status
+	}
+
+	index := make(map[string]int, len(tl.Nodes))
+	for i, node := range tl.Nodes {
+		index[node.ID] = i
+	}
+	for _, ns := range resp.Nodes {
+		i, ok := index[ns.ID]
+		if !ok {
+			tl.Nodes = append(tl.Nodes, NodeTimeline{ID: ns.ID})
+			i = len(tl.Nodes) - 1
+			index[ns.ID] = i
+		}
+		node := &tl.Nodes[i]
+		if ns.Status == node.Status {
+			node.Code, node.Msg = ns.Code, ns.Msg
+			continue
+		}
+		changes = append(changes, RunTransition{At: ms, NodeID: ns.ID, From: node.Status, To: ns.Status, Code: ns.Code, Msg: ns.Msg})
+		node.Status, node.Code, node.Msg = ns.Status, ns.Code, ns.Msg
+		switch {
+		case isRunningStatus(ns.Status):
+			node.Attempts++
+			if node.StartedAt == 0 {
+				node.StartedAt = ms
+			}
+			node.FinishedAt = 0
+		case isTerminalStatus(ns.Status):
+			if node.StartedAt == 0 {
+				// Finished between two polls; the real start is unknown.
+				node.StartedAt = ms
+			}
+			if node.Attempts == 0 {
+				node.Attempts = 1
+			}
+			node.FinishedAt = ms
+			node.DurationMs = node.FinishedAt - node.StartedAt
+		}
+	}
+
+	tl.Transitions = append(tl.Transitions, changes...)
+	if isTerminalStatus(tl.Status) && !tl.Done {
+		tl.Done = true
+		tl.FinishedAt = ms
+		tl.DurationMs = tl.FinishedAt - tl.StartedAt
+	}
+	return changes
+}
+
+func isRunningStatus(status string) bool {
+	return strings.EqualFold(status, "running")
+}
+
+func isTerminalStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "succeeded", "success", "ok", "failed", "error", "skipped", "canceled", "cancelled", "timeout":
+		return true
+	}
+	return false
+}
+
+func nextWatchInterval(d time.Duration) time.Duration {
+	d = d * 3 / 2
+	if d > maxWatchInterval {
+		return maxWatchInterval
+	}
+	return d
+}
+
+func copyTimeline(tl RunTimeline) RunTimeline {
+	tl.Nodes = append([]NodeTimeline{}, tl.Nodes...)
+	tl.Transitions = append([]RunTransition{}, tl.Transitions...)
+	return tl
+}
+
+func watchKey(executor uint32, flowID, runID string) string {
+	return fmt.Sprintf("%d|%s|%s", executor, flowID, runID)
+}
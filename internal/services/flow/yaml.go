@@ -0,0 +1,570 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A small YAML subset sufficient for flow files: block mappings and
+// sequences, plain/single/double quoted scalars, literal (|) and folded (>)
+// block scalars, comments, and JSON-style flow collections. Anchors, tags and
+// multi-line plain scalars are not supported.
+
+type orderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+var (
+	yamlNumber  = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+	yamlPlainOK = regexp.MustCompile(`^[A-Za-z0-9_./()-][A-Za-z0-9 _./()@-]*$`)
+)
+
+// jsonToYAML re-renders JSON as block YAML, keeping object key order.
+func jsonToYAML(raw []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := emitYAML(&buf, v, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := &orderedMap{values: map[string]any{}}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				val, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				if _, dup := m.values[key]; !dup {
+					m.keys = append(m.keys, key)
+				}
+				m.values[key] = val
+			}
+			_, err := dec.Token()
+			return m, err
+		case '[':
+			out := []any{}
+			for dec.More() {
+				val, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, val)
+			}
+			_, err := dec.Token()
+			return out, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	default:
+		return tok, nil
+	}
+}
+
+func emitYAML(buf *bytes.Buffer, v any, indent int) error {
+	pad := strings.Repeat(" ", indent)
+	switch t := v.(type) {
+	case *orderedMap:
+		if len(t.keys) == 0 {
+			buf.WriteString(pad + "{}\n")
+			return nil
+		}
+		for _, key := range t.keys {
+			buf.WriteString(pad + yamlScalar(key) + ":")
+			if err := emitChild(buf, t.values[key], indent); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if len(t) == 0 {
+			buf.WriteString(pad + "[]\n")
+			return nil
+		}
+		for _, item := range t {
+			if isYAMLScalar(item) || isEmptyCollection(item) {
+				buf.WriteString(pad + "-")
+				if err := emitChild(buf, item, indent); err != nil {
+					return err
+				}
+				continue
+			}
+			// Render the child one level deeper, then fold its first line
+			// into the "- " marker.
+			var child bytes.Buffer
+			if err := emitYAML(&child, item, indent+2); err != nil {
+				return err
+			}
+			buf.WriteString(pad + "- ")
+			buf.Write(child.Bytes()[indent+2:])
+		}
+	default:
+		buf.WriteString(pad + yamlScalar(v) + "\n")
+	}
+	return nil
+}
+
+func emitChild(buf *bytes.Buffer, v any, indent int) error {
+	switch t := v.(type) {
+	case *orderedMap:
+		if len(t.keys) == 0 {
+			buf.WriteString(" {}\n")
+			return nil
+		}
+		buf.WriteString("\n")
+		return emitYAML(buf, v, indent+2)
+	case []any:
+		if len(t) == 0 {
+			buf.WriteString(" []\n")
+			return nil
+		}
+		buf.WriteString("\n")
+		return emitYAML(buf, v, indent+2)
+	default:
+		buf.WriteString(" " + yamlScalar(v) + "\n")
+		return nil
+	}
+}
+
+func isYAMLScalar(v any) bool {
+	switch v.(type) {
+	case *orderedMap, []any:
+		return false
+	}
+	return true
+}
+
+func isEmptyCollection(v any) bool {
+	switch t := v.(type) {
+	case *orderedMap:
+		return len(t.keys) == 0
+	case []any:
+		return len(t) == 0
+	}
+	return false
+}
+
+func yamlScalar(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	case string:
+		if yamlPlainOK.MatchString(t) && strings.TrimSpace(t) == t && !yamlAmbiguous(t) {
+			return t
+		}
+		var out bytes.Buffer
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(t)
+		return strings.TrimSuffix(out.String(), "\n")
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// yamlAmbiguous reports plain strings that YAML would read as another type.
+func yamlAmbiguous(s string) bool {
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return true
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, ".") {
+		return true
+	}
+	return yamlNumber.MatchString(s)
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlToJSON parses the supported YAML subset and returns equivalent JSON.
+func yamlToJSON(src []byte) ([]byte, error) {
+	lines, err := splitYAMLLines(string(src))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("yaml: document is empty")
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf(p.lines[p.pos], "unexpected indentation")
+	}
+	return json.Marshal(v)
+}
+
+func splitYAMLLines(src string) ([]yamlLine, error) {
+	var out []yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(raw, "---") || strings.HasPrefix(raw, "...") || strings.HasPrefix(raw, "%") {
+			if i == 0 || strings.TrimSpace(raw) == "---" || strings.TrimSpace(raw) == "..." {
+				continue
+			}
+		}
+		trimmed := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", i+1)
+		}
+		out = append(out, yamlLine{num: i + 1, indent: len(raw) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	return out, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(line yamlLine, format string, args ...any) error {
+	return fmt.Errorf("yaml line %d: %s", line.num, fmt.Sprintf(format, args...))
+}
+
+// skipBlank advances past empty and comment-only lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		text := p.lines[p.pos].text
+		if text != "" && !strings.HasPrefix(text, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *yamlParser) block(indent int) (any, error) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	line := p.lines[p.pos]
+	if line.indent != indent {
+		return nil, p.errorf(line, "unexpected indentation")
+	}
+	if isSeqItem(line.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok, err := splitKey(line.text); err != nil {
+		return nil, p.errorf(line, "%v", err)
+	} else if ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return parseScalar(stripComment(line.text), line, p)
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	out := []any{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return out, nil
+		}
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			return out, nil
+		}
+		if line.indent > indent || !isSeqItem(line.text) {
+			if line.indent == indent {
+				return out, nil
+			}
+			return nil, p.errorf(line, "unexpected indentation in sequence")
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			p.pos++
+			p.skipBlank()
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				out = append(out, nil)
+				continue
+			}
+			v, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			continue
+		}
+		// Treat the item content as a line of its own at its column, so a
+		// mapping can continue on the following lines.
+		offset := len(line.text) - len(rest)
+		p.lines[p.pos] = yamlLine{num: line.num, indent: indent + offset, text: rest}
+		v, err := p.block(indent + offset)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	out := map[string]any{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return out, nil
+		}
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			return out, nil
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line, "unexpected indentation in mapping")
+		}
+		if isSeqItem(line.text) {
+			return out, nil
+		}
+		key, rest, ok, err := splitKey(line.text)
+		if err != nil {
+			return nil, p.errorf(line, "%v", err)
+		}
+		if !ok {
+			return nil, p.errorf(line, "expected \"key: value\"")
+		}
+		if _, dup := out[key]; dup {
+			return nil, p.errorf(line, "duplicate key %q", key)
+		}
+		p.pos++
+		rest = stripComment(rest)
+		switch {
+		case rest == "":
+			p.skipBlank()
+			if p.pos < len(p.lines) {
+				next := p.lines[p.pos]
+				if next.indent > indent || (next.indent == indent && isSeqItem(next.text)) {
+					v, err := p.block(next.indent)
+					if err != nil {
+						return nil, err
+					}
+					out[key] = v
+					continue
+				}
+			}
+			out[key] = nil
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+			out[key] = p.blockScalar(rest, indent)
+		default:
+			v, err := parseScalar(rest, line, p)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+		}
+	}
+}
+
+// blockScalar reads a | or > scalar whose lines are indented past indent.
+func (p *yamlParser) blockScalar(header string, indent int) string {
+	folded := strings.HasPrefix(header, ">")
+	chomp := ""
+	if strings.Contains(header, "-") {
+		chomp = "-"
+	} else if strings.Contains(header, "+") {
+		chomp = "+"
+	}
+	var lines []string
+	contentIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.text != "" && line.indent <= indent {
+			break
+		}
+		if line.text != "" && contentIndent < 0 {
+			contentIndent = line.indent
+		}
+		text := ""
+		if line.text != "" {
+			text = strings.Repeat(" ", line.indent-contentIndent) + line.text
+		}
+		lines = append(lines, text)
+		p.pos++
+	}
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	var out string
+	if folded {
+		var b strings.Builder
+		for i, l := range lines {
+			if i > 0 {
+				if l == "" || lines[i-1] == "" {
+					b.WriteString("\n")
+				} else {
+					b.WriteString(" ")
+				}
+			}
+			b.WriteString(l)
+		}
+		out = b.String()
+	} else {
+		out = strings.Join(lines, "\n")
+	}
+	switch chomp {
+	case "-":
+		return out
+	case "+":
+		return out + "\n" + strings.Repeat("\n", trailing)
+	default:
+		if out == "" {
+			return ""
+		}
+		return out + "\n"
+	}
+}
+
+// splitKey splits "key: value" (or "key:") outside quotes.
+func splitKey(text string) (string, string, bool, error) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false, nil
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false, errors.New("unterminated quoted key")
+		}
+		after := text[end+1:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		key, err := unquote(text[:end+1])
+		if err != nil {
+			return "", "", false, err
+		}
+		return key, strings.TrimSpace(strings.TrimPrefix(after, ":")), true, nil
+	}
+	idx := strings.Index(text, ": ")
+	if strings.HasSuffix(text, ":") && (idx < 0 || idx == len(text)-1) {
+		idx = len(text) - 1
+	}
+	if idx <= 0 || strings.HasPrefix(text, "#") {
+		return "", "", false, nil
+	}
+	return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+1:]), true, nil
+}
+
+func closingQuote(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case q == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(text string) (string, error) {
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	var out string
+	if err := json.Unmarshal([]byte(text), &out); err != nil {
+		return "", fmt.Errorf("invalid double-quoted string %s", text)
+	}
+	return out, nil
+}
+
+// stripComment drops a trailing " #" comment outside quotes.
+func stripComment(text string) string {
+	if text == "" {
+		return text
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		if end := closingQuote(text); end >= 0 {
+			rest := text[end+1:]
+			if idx := strings.Index(rest, " #"); idx >= 0 {
+				rest = rest[:idx]
+			}
+			return strings.TrimSpace(text[:end+1] + rest)
+		}
+		return text
+	}
+	if strings.HasPrefix(text, "#") {
+		return ""
+	}
+	if idx := strings.Index(text, " #"); idx >= 0 {
+		return strings.TrimSpace(text[:idx])
+	}
+	return text
+}
+
+func parseScalar(text string, line yamlLine, p *yamlParser) (any, error) {
+	switch {
+	case text == "":
+		return nil, nil
+	case text[0] == '"' || text[0] == '\'':
+		end := closingQuote(text)
+		if end != len(text)-1 {
+			return nil, p.errorf(line, "multi-line or malformed quoted scalar")
+		}
+		s, err := unquote(text)
+		if err != nil {
+			return nil, p.errorf(line, "%v", err)
+		}
+		return s, nil
+	case text[0] == '[' || text[0] == '{':
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, p.errorf(line, "flow collections must be valid JSON: %v", err)
+		}
+		return v, nil
+	case text[0] == '&' || text[0] == '*' || text[0] == '!':
+		return nil, p.errorf(line, "anchors, aliases and tags are not supported")
+	}
+	switch strings.ToLower(text) {
+	case "null", "~":
+		return nil, nil
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	}
+	if yamlNumber.MatchString(text) {
+		return json.Number(strings.TrimPrefix(text, "+")), nil
+	}
+	return text, nil
+}
@@ -0,0 +1,82 @@
+package flowexec
+
+import "time"
+
+const EventFlowExecCall = "flowexec.call"
+
+// Methods this client can run when a flow exec node targets it.
+const (
+	MethodCommand  = "cmd.run"
+	MethodVarSet   = "varpool.set"
+	MethodPublish  = "topicbus.publish"
+	MethodFileRead = "file.read"
+)
+
+// ExecCommand is one allowlisted program. Callers refer to it by Name and can
+// never choose the executable path; extra arguments are appended only when
+// AllowArgs is set.
+type ExecCommand struct {
+	Name      string   `json:"name"`
+	Path      string   `json:"path"`
+	Args      []string `json:"args"`
+	WorkDir   string   `json:"workDir"`
+	AllowArgs bool     `json:"allowArgs"`
+}
+
+type MethodPolicy struct {
+	Method    string `json:"method"`
+	Enabled   bool   `json:"enabled"`
+	TimeoutMs int    `json:"timeoutMs"`
+}
+
+// ExecPrefs controls whether this client answers exec calls at all, which
+// methods are allowed and who may call them. Only nodes in AllowedCallers
+// may call; an empty list denies every caller.
+type ExecPrefs struct {
+	Enabled        bool           `json:"enabled"`
+	AllowedCallers []uint32       `json:"allowedCallers"`
+	Methods        []MethodPolicy `json:"methods"`
+	Commands       []ExecCommand  `json:"commands"`
+}
+
+// ExecCallRecord is one handled call, published on EventFlowExecCall.
+type ExecCallRecord struct {
+	ReqID      string    `json:"reqId"`
+	Caller     uint32    `json:"caller"`
+	Method     string    `json:"method"`
+	Code       int       `json:"code"`
+	Msg        string    `json:"msg,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+type CommandResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type VarSetArgs struct {
+	Name       string `json:"name"`
+	Value      string `json:"value"`
+	Visibility string `json:"visibility,omitempty"`
+	Type       string `json:"type,omitempty"`
+}
+
+type PublishArgs struct {
+	Topic   string `json:"topic"`
+	Name    string `json:"name,omitempty"`
+	Payload string `json:"payload"`
+}
+
+type FileReadArgs struct {
+	Dir      string `json:"dir"`
+	Name     string `json:"name"`
+	MaxBytes int    `json:"max_bytes,omitempty"`
+}
+
+type CommandArgs struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+}
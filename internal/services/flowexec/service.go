@@ -0,0 +1,587 @@
+package flowexec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	protocol "github.com/yttydcs/myflowhub-proto/protocol/exec"
+	"github.com/yttydcs/myflowhub-proto/protocol/varstore"
+	sdktransport "github.com/yttydcs/myflowhub-sdk/transport"
+	filesvc "github.com/yttydcs/myflowhub-win/internal/services/file"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	sessionsvc "github.com/yttydcs/myflowhub-win/internal/services/session"
+	topicbussvc "github.com/yttydcs/myflowhub-win/internal/services/topicbus"
+	"github.com/yttydcs/myflowhub-win/internal/services/transport"
+	varpoolsvc "github.com/yttydcs/myflowhub-win/internal/services/varpool"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	cfgFlowExecPrefs = "flowexec.prefs"
+
+	minCallTimeoutMs   = 100
+	maxCallTimeoutMs   = 600000
+	maxConcurrentCalls = 8
+	maxOutputBytes     = 64 * 1024
+	// cmdWaitDelay bounds how long Run waits for the output pipes once the
+	// command exited or was killed, in case a grandchild still holds them.
+	cmdWaitDelay       = 2 * time.Second
+	maxRecentCalls     = 200
+	defaultPublishName = "flow"
+)
+
+var defaultTimeoutsMs = map[string]int{
+	MethodCommand:  30000,
+	MethodVarSet:   5000,
+	MethodPublish:  5000,
+	MethodFileRead: 5000,
+}
+
+var knownMethods = []string{MethodCommand, MethodVarSet, MethodPublish, MethodFileRead}
+
+type FlowExecService struct {
+	session  *sessionsvc.SessionService
+	varpool  *varpoolsvc.VarPoolService
+	topicbus *topicbussvc.TopicBusService
+	file     *filesvc.FileService
+	logs     *logs.LogService
+	store    *storage.Store
+	bus      eventbus.IBus
+
+	handlers  map[string]methodHandler
+	slots     chan struct{}
+	busTokens []busToken
+
+	mu        sync.Mutex
+	localNode uint32
+	hubID     uint32
+	calls     []ExecCallRecord
+}
+
+type busToken struct {
+	name  string
+	token string
+}
+
+type execCall struct {
+	caller uint32
+	local  uint32
+	hub    uint32
+	args   json.RawMessage
+	prefs  ExecPrefs
+}
+
+type methodHandler func(ctx context.Context, call execCall) (any, error)
+
+// callError carries the response code sent back to the executor.
+type callError struct {
+	code int
+	msg  string
+}
+
+func (e *callError) Error() string { return e.msg }
+
+func callErrorf(code int, format string, args ...any) error {
+	return &callError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+func New(session *sessionsvc.SessionService, varpool *varpoolsvc.VarPoolService, topicbus *topicbussvc.TopicBusService, file *filesvc.FileService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *FlowExecService {
+	svc := &FlowExecService{
+		session:  session,
+		varpool:  varpool,
+		topicbus: topicbus,
+		file:     file,
+		logs:     logsSvc,
+		store:    store,
+		bus:      bus,
+		slots:    make(chan struct{}, maxConcurrentCalls),
+	}
+	svc.handlers = map[string]methodHandler{
+		MethodCommand:  svc.runCommand,
+		MethodVarSet:   svc.setVar,
+		MethodPublish:  svc.publish,
+		MethodFileRead: svc.readFile,
+	}
+	svc.bindBus()
+	return svc
+}
+
+func (s *FlowExecService) Close() {
+	s.unbindBus()
+}
+
+// SetIdentity tells the executor which node it is and which hub to use for
+// varpool and topicbus calls made on behalf of a flow. The app sets it after
+// every successful login or register; until then those calls are refused.
+func (s *FlowExecService) SetIdentity(nodeID, hubID uint32) {
+	s.mu.Lock()
+	s.localNode = nodeID
+	s.hubID = hubID
+	s.mu.Unlock()
+}
+
+func (s *FlowExecService) Prefs() (ExecPrefs, error) {
+	return s.loadPrefs(), nil
+}
+
+func (s *FlowExecService) SavePrefs(prefs ExecPrefs) (ExecPrefs, error) {
+	if s == nil || s.store == nil {
+		return ExecPrefs{}, errors.New("storage not initialized")
+	}
+	normalized, err := normalizePrefs(prefs)
+	if err != nil {
+		return ExecPrefs{}, err
+	}
+	raw, err := json.Marshal(normalized)
+	if err != nil {
+		return ExecPrefs{}, err
+	}
+	if err := s.store.SetString(s.store.CurrentProfile(), cfgFlowExecPrefs, string(raw)); err != nil {
+		return ExecPrefs{}, err
+	}
+	return normalized, nil
+}
+
+// RecentCalls returns the last handled calls, oldest first.
+func (s *FlowExecService) RecentCalls() ([]ExecCallRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ExecCallRecord(nil), s.calls...), nil
+}
+
+func (s *FlowExecService) ClearCalls() error {
+	s.mu.Lock()
+	s.calls = nil
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FlowExecService) bindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	token := s.bus.Subscribe(sessionsvc.EventFrame, func(_ context.Context, evt eventbus.Event) {
+		frame, ok := evt.Data.(sessionsvc.FrameEvent)
+		if !ok || frame.SubProto != protocol.SubProtoExec {
+			return
+		}
+		s.handleFrame(frame)
+	})
+	if token != "" {
+		s.busTokens = append(s.busTokens, busToken{name: sessionsvc.EventFrame, token: token})
+	}
+}
+
+func (s *FlowExecService) unbindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	for _, entry := range s.busTokens {
+		if entry.token == "" {
+			continue
+		}
+		s.bus.Unsubscribe(entry.name, entry.token)
+	}
+	s.busTokens = nil
+}
+
+func (s *FlowExecService) handleFrame(frame sessionsvc.FrameEvent) {
+	msg, err := sdktransport.DecodeMessage(frame.Payload)
+	if err != nil || msg.Action != protocol.ActionCall {
+		return
+	}
+	local := s.localNodeFromFrame(frame)
+	var req protocol.CallReq
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		s.reply(frame, protocol.CallResp{Code: 400, Msg: "invalid call", TargetNode: local})
+		return
+	}
+	if req.TargetNode != 0 && req.TargetNode != local {
+		return
+	}
+	go s.serve(frame, local, req)
+}
+
+func (s *FlowExecService) serve(frame sessionsvc.FrameEvent, local uint32, req protocol.CallReq) {
+	started := time.Now()
+	caller := frame.SourceID
+	method := strings.ToLower(strings.TrimSpace(req.Method))
+	resp := protocol.CallResp{ReqID: req.ReqID, ExecutorNode: req.ExecutorNode, TargetNode: local, Method: method}
+
+	result, err := s.dispatch(caller, local, method, req)
+	resp.Code, resp.Msg = 1, "ok"
+	if err != nil {
+		resp.Code, resp.Msg = 500, err.Error()
+		var cerr *callError
+		if errors.As(err, &cerr) {
+			resp.Code = cerr.code
+		}
+	}
+	if result != nil {
+		if raw, merr := json.Marshal(result); merr == nil {
+			resp.Result = raw
+		}
+	}
+	s.reply(frame, resp)
+	s.record(ExecCallRecord{
+		ReqID:      req.ReqID,
+		Caller:     caller,
+		Method:     method,
+		Code:       resp.Code,
+		Msg:        resp.Msg,
+		StartedAt:  started,
+		DurationMs: time.Since(started).Milliseconds(),
+	})
+}
+
+func (s *FlowExecService) dispatch(caller, local uint32, method string, req protocol.CallReq) (any, error) {
+	prefs := s.loadPrefs()
+	if !prefs.Enabled {
+		return nil, callErrorf(403, "local executor disabled")
+	}
+	if !callerAllowed(prefs.AllowedCallers, caller) {
+		return nil, callErrorf(403, "caller %d not allowed", caller)
+	}
+	handler, ok := s.handlers[method]
+	if !ok {
+		return nil, callErrorf(404, "unknown method %q", method)
+	}
+	policy := policyFor(prefs, method)
+	if !policy.Enabled {
+		return nil, callErrorf(403, "method %s disabled", method)
+	}
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		return nil, callErrorf(429, "executor busy")
+	}
+
+	timeoutMs := policy.TimeoutMs
+	if req.TimeoutMs > 0 && req.TimeoutMs < timeoutMs {
+		timeoutMs = req.TimeoutMs
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+
+	s.mu.Lock()
+	hub := s.hubID
+	s.mu.Unlock()
+	result, err := handler(ctx, execCall{caller: caller, local: local, hub: hub, args: req.Args, prefs: prefs})
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return result, callErrorf(408, "%s timed out after %dms", method, timeoutMs)
+	}
+	return result, err
+}
+
+func (s *FlowExecService) runCommand(ctx context.Context, call execCall) (any, error) {
+	var args CommandArgs
+	if err := decodeArgs(call.args, &args); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(args.Name)
+	var entry *ExecCommand
+	for i := range call.prefs.Commands {
+		if call.prefs.Commands[i].Name == name {
+			entry = &call.prefs.Commands[i]
+			break
+		}
+	}
+	if entry == nil {
+		return nil, callErrorf(403, "command %q not allowlisted", name)
+	}
+	if len(args.Args) > 0 && !entry.AllowArgs {
+		return nil, callErrorf(403, "command %q does not accept arguments", name)
+	}
+	argv := append(append([]string(nil), entry.Args...), args.Args...)
+	cmd := exec.CommandContext(ctx, entry.Path, argv...)
+	cmd.Dir = entry.WorkDir
+	cmd.WaitDelay = cmdWaitDelay
+	if runtime.GOOS == "windows" {
+		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	}
+	stdout := &cappedBuffer{limit: maxOutputBytes}
+	stderr := &cappedBuffer{limit: maxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	result := CommandResult{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+			return result, callErrorf(500, "%s exited with code %d", name, result.ExitCode)
+		}
+		return nil, callErrorf(500, "%s: %v", name, err)
+	}
+	return result, nil
+}
+
+func (s *FlowExecService) setVar(ctx context.Context, call execCall) (any, error) {
+	if s.varpool == nil {
+		return nil, errors.New("varpool service not initialized")
+	}
+	var args VarSetArgs
+	if err := decodeArgs(call.args, &args); err != nil {
+		return nil, err
+	}
+	visibility := strings.ToLower(strings.TrimSpace(args.Visibility))
+	switch visibility {
+	case "":
+		visibility = varstore.VisibilityPublic
+	case varstore.VisibilityPublic, varstore.VisibilityPrivate:
+	default:
+		return nil, callErrorf(400, "invalid visibility %q", args.Visibility)
+	}
+	name := strings.TrimSpace(args.Name)
+	if name == "" {
+		return nil, callErrorf(400, "name is required")
+	}
+	req := varstore.SetReq{Name: name, Value: args.Value, Visibility: visibility, Type: strings.TrimSpace(args.Type)}
+	if call.hub == 0 {
+		return nil, callErrorf(503, "hub unknown, log in first")
+	}
+	resp, err := s.varpool.Set(ctx, call.local, call.hub, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *FlowExecService) publish(ctx context.Context, call execCall) (any, error) {
+	if s.topicbus == nil {
+		return nil, errors.New("topicbus service not initialized")
+	}
+	var args PublishArgs
+	if err := decodeArgs(call.args, &args); err != nil {
+		return nil, err
+	}
+	topic := strings.TrimSpace(args.Topic)
+	if topic == "" {
+		return nil, callErrorf(400, "topic is required")
+	}
+	name := strings.TrimSpace(args.Name)
+	if name == "" {
+		name = defaultPublishName
+	}
+	if call.hub == 0 {
+		return nil, callErrorf(503, "hub unknown, log in first")
+	}
+	if err := s.topicbus.Publish(ctx, call.local, call.hub, topic, name, args.Payload); err != nil {
+		return nil, err
+	}
+	return map[string]string{"topic": topic, "name": name}, nil
+}
+
+func (s *FlowExecService) readFile(_ context.Context, call execCall) (any, error) {
+	if s.file == nil {
+		return nil, errors.New("file service not initialized")
+	}
+	var args FileReadArgs
+	if err := decodeArgs(call.args, &args); err != nil {
+		return nil, err
+	}
+	text, err := s.file.ReadLocalText(args.Dir, args.Name, args.MaxBytes)
+	if err != nil {
+		return nil, callErrorf(404, "%v", err)
+	}
+	return map[string]any{"dir": text.Dir, "name": text.Name, "size": text.Size, "text": text.Text, "truncated": text.Truncated}, nil
+}
+
+// reply answers the call frame with a response header carrying its MsgID, so
+// a caller awaiting the call_resp can match it.
+func (s *FlowExecService) reply(frame sessionsvc.FrameEvent, resp protocol.CallResp) {
+	if s.session == nil {
+		return
+	}
+	payload, err := transport.EncodeMessage(protocol.ActionCallResp, resp)
+	if err != nil {
+		return
+	}
+	if err := s.session.SendResponse(frame, resp.Code == 1, payload); err != nil && s.logs != nil {
+		s.logs.Appendf("warn", "flowexec reply to %d failed: %v", frame.SourceID, err)
+	}
+}
+
+func (s *FlowExecService) record(rec ExecCallRecord) {
+	s.mu.Lock()
+	s.calls = append(s.calls, rec)
+	if len(s.calls) > maxRecentCalls {
+		s.calls = append([]ExecCallRecord(nil), s.calls[len(s.calls)-maxRecentCalls:]...)
+	}
+	s.mu.Unlock()
+	if s.logs != nil {
+		level := "info"
+		if rec.Code != 1 {
+			level = "warn"
+		}
+		s.logs.Appendf(level, "flowexec %s from %d code=%d msg=%q (%dms)", rec.Method, rec.Caller, rec.Code, rec.Msg, rec.DurationMs)
+	}
+	if s.bus != nil {
+		_ = s.bus.Publish(context.Background(), EventFlowExecCall, rec, nil)
+	}
+}
+
+func (s *FlowExecService) localNodeFromFrame(frame sessionsvc.FrameEvent) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.localNode == 0 {
+		return frame.TargetID
+	}
+	return s.localNode
+}
+
+func (s *FlowExecService) loadPrefs() ExecPrefs {
+	prefs := ExecPrefs{}
+	if s != nil && s.store != nil {
+		raw := strings.TrimSpace(s.store.GetString(s.store.CurrentProfile(), cfgFlowExecPrefs, ""))
+		if raw != "" {
+			_ = json.Unmarshal([]byte(raw), &prefs)
+		}
+	}
+	normalized, err := normalizePrefs(prefs)
+	if err != nil {
+		// A stored allowlist that no longer validates must not widen access.
+		normalized.Enabled = false
+	}
+	return normalized
+}
+
+func normalizePrefs(prefs ExecPrefs) (ExecPrefs, error) {
+	out := ExecPrefs{Enabled: prefs.Enabled}
+	seenCaller := make(map[uint32]struct{}, len(prefs.AllowedCallers))
+	for _, node := range prefs.AllowedCallers {
+		if node == 0 {
+			continue
+		}
+		if _, ok := seenCaller[node]; ok {
+			continue
+		}
+		seenCaller[node] = struct{}{}
+		out.AllowedCallers = append(out.AllowedCallers, node)
+	}
+
+	given := make(map[string]MethodPolicy, len(prefs.Methods))
+	for _, policy := range prefs.Methods {
+		given[strings.ToLower(strings.TrimSpace(policy.Method))] = policy
+	}
+	for _, method := range knownMethods {
+		policy, ok := given[method]
+		if !ok {
+			policy = MethodPolicy{Enabled: true}
+		}
+		policy.Method = method
+		if policy.TimeoutMs <= 0 {
+			policy.TimeoutMs = defaultTimeoutsMs[method]
+		}
+		if policy.TimeoutMs < minCallTimeoutMs {
+			policy.TimeoutMs = minCallTimeoutMs
+		}
+		if policy.TimeoutMs > maxCallTimeoutMs {
+			policy.TimeoutMs = maxCallTimeoutMs
+		}
+		out.Methods = append(out.Methods, policy)
+	}
+
+	seenCmd := make(map[string]struct{}, len(prefs.Commands))
+	for i, cmd := range prefs.Commands {
+		cmd.Name = strings.TrimSpace(cmd.Name)
+		cmd.Path = strings.TrimSpace(cmd.Path)
+		cmd.WorkDir = strings.TrimSpace(cmd.WorkDir)
+		if cmd.Name == "" {
+			return out, fmt.Errorf("command %d: name is required", i+1)
+		}
+		if strings.ContainsAny(cmd.Name, " \t") {
+			return out, fmt.Errorf("command %q: name must not contain spaces", cmd.Name)
+		}
+		if cmd.Path == "" {
+			return out, fmt.Errorf("command %q: path is required", cmd.Name)
+		}
+		if _, ok := seenCmd[cmd.Name]; ok {
+			return out, fmt.Errorf("command %q is listed twice", cmd.Name)
+		}
+		seenCmd[cmd.Name] = struct{}{}
+		if cmd.Args == nil {
+			cmd.Args = []string{}
+		}
+		out.Commands = append(out.Commands, cmd)
+	}
+	if out.AllowedCallers == nil {
+		out.AllowedCallers = []uint32{}
+	}
+	if out.Commands == nil {
+		out.Commands = []ExecCommand{}
+	}
+	return out, nil
+}
+
+func policyFor(prefs ExecPrefs, method string) MethodPolicy {
+	for _, policy := range prefs.Methods {
+		if policy.Method == method {
+			return policy
+		}
+	}
+	return MethodPolicy{Method: method}
+}
+
+// callerAllowed only accepts listed nodes; an empty list denies everyone.
+func callerAllowed(allowed []uint32, caller uint32) bool {
+	for _, node := range allowed {
+		if node == caller {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeArgs(raw json.RawMessage, out any) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return callErrorf(400, "args are required")
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return callErrorf(400, "invalid args: %v", err)
+	}
+	return nil
+}
+
+// cappedBuffer keeps the first limit bytes of a stream and silently drops the
+// rest so a chatty command cannot grow the response without bound.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - b.buf.Len()
+	if room <= 0 {
+		b.truncated = len(p) > 0 || b.truncated
+		return len(p), nil
+	}
+	if len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
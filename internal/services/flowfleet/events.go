@@ -0,0 +1,76 @@
+package flowfleet
+
+const EventFlowFleetScan = "flowfleet.scan"
+
+const (
+	ActionRun         = "run"
+	ActionDisable     = "disable"
+	ActionSetInterval = "set_interval"
+	ActionDelete      = "delete"
+)
+
+// FleetNode is the outcome of listing flows on one executor.
+type FleetNode struct {
+	NodeID     uint32 `json:"nodeId"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	Flows      int    `json:"flows"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// FleetFlowInstance is one copy of a flow on one executor.
+type FleetFlowInstance struct {
+	ExecutorNode uint32 `json:"executorNode"`
+	Name         string `json:"name"`
+	EveryMs      uint64 `json:"everyMs"`
+	Disabled     bool   `json:"disabled"`
+	LastRunID    string `json:"lastRunId"`
+	LastStatus   string `json:"lastStatus"`
+}
+
+// FleetFlow groups every executor that has a flow with the same ID. Names and
+// Intervals list the distinct values seen, so drift between copies shows up
+// as more than one entry.
+type FleetFlow struct {
+	FlowID    string              `json:"flowId"`
+	Names     []string            `json:"names"`
+	Intervals []uint64            `json:"intervals"`
+	Statuses  map[string]int      `json:"statuses"`
+	Instances []FleetFlowInstance `json:"instances"`
+}
+
+type FleetView struct {
+	HubID     uint32      `json:"hubId"`
+	ScannedAt int64       `json:"scannedAt"`
+	Scanning  bool        `json:"scanning"`
+	Done      int         `json:"done"`
+	Total     int         `json:"total"`
+	Nodes     []FleetNode `json:"nodes"`
+	Flows     []FleetFlow `json:"flows"`
+}
+
+// BulkRequest applies one action to a flow on many executors. An empty
+// Executors list targets every executor that had the flow in the last scan.
+type BulkRequest struct {
+	Action      string   `json:"action"`
+	FlowID      string   `json:"flowId"`
+	Executors   []uint32 `json:"executors"`
+	EveryMs     uint64   `json:"everyMs"`
+	Concurrency int      `json:"concurrency"`
+}
+
+type BulkNodeResult struct {
+	ExecutorNode uint32 `json:"executorNode"`
+	OK           bool   `json:"ok"`
+	Error        string `json:"error,omitempty"`
+	RunID        string `json:"runId,omitempty"`
+	DurationMs   int64  `json:"durationMs"`
+}
+
+type BulkReport struct {
+	Action  string           `json:"action"`
+	FlowID  string           `json:"flowId"`
+	OK      int              `json:"ok"`
+	Failed  int              `json:"failed"`
+	Results []BulkNodeResult `json:"results"`
+}
@@ -0,0 +1,410 @@
+package flowfleet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-proto/protocol/flow"
+	"github.com/yttydcs/myflowhub-proto/protocol/management"
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+	flowsvc "github.com/yttydcs/myflowhub-win/internal/services/flow"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	mgmtsvc "github.com/yttydcs/myflowhub-win/internal/services/management"
+)
+
+const (
+	defaultFleetTimeout     = 8 * time.Second
+	defaultFleetConcurrency = 8
+	maxFleetConcurrency     = 32
+	// The flow protocol has no enable flag; disabling stretches the interval
+	// to a year so the flow stays defined but effectively never fires.
+	disabledEveryMs = 365 * 24 * 60 * 60 * 1000
+	scanEmitTick    = 300 * time.Millisecond
+)
+
+// FlowFleetService lists and operates on flows across every executor under a
+// hub.
+type FlowFleetService struct {
+	flow       *flowsvc.FlowService
+	management *mgmtsvc.ManagementService
+	logs       *logs.LogService
+	bus        eventbus.IBus
+
+	mu       sync.Mutex
+	view     FleetView
+	scanning bool
+	lastEmit time.Time
+}
+
+func New(flow *flowsvc.FlowService, management *mgmtsvc.ManagementService, logsSvc *logs.LogService, bus eventbus.IBus) *FlowFleetService {
+	return &FlowFleetService{
+		flow:       flow,
+		management: management,
+		logs:       logsSvc,
+		bus:        bus,
+		view:       FleetView{Nodes: []FleetNode{}, Flows: []FleetFlow{}},
+	}
+}
+
+// Scan discovers every node under hubID and lists its flows, concurrency at a
+// time (0 uses the default). Progress is published on EventFlowFleetScan.
+func (s *FlowFleetService) Scan(ctx context.Context, sourceID, hubID uint32, concurrency int) (FleetView, error) {
+	if s.flow == nil || s.management == nil {
+		return FleetView{}, errors.New("flow fleet not initialized")
+	}
+	if hubID == 0 {
+		return FleetView{}, errors.New("hub id is required")
+	}
+	s.mu.Lock()
+	if s.scanning {
+		s.mu.Unlock()
+		return FleetView{}, errors.New("a fleet scan is already running")
+	}
+	s.scanning = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.scanning = false
+		s.mu.Unlock()
+	}()
+
+	concurrency = clampConcurrency(concurrency)
+	nodes, err := s.discover(ctx, sourceID, hubID, concurrency)
+	if err != nil {
+		return FleetView{}, err
+	}
+	view := FleetView{HubID: hubID, Scanning: true, Total: len(nodes), Nodes: []FleetNode{}, Flows: []FleetFlow{}}
+	s.publish(view, true)
+
+	results := make([]FleetNode, len(nodes))
+	for i, node := range nodes {
+		results[i] = FleetNode{NodeID: node, Error: "not scanned"}
+	}
+	listed := make([][]flow.FlowSummary, len(nodes))
+	var progressMu sync.Mutex
+	fleet.ForEach(ctx, len(nodes), concurrency, func(i int) {
+		results[i], listed[i] = s.listNode(ctx, sourceID, hubID, nodes[i])
+		progressMu.Lock()
+		view.Done++
+		view.Nodes = append(view.Nodes, results[i])
+		snapshot := view
+		progressMu.Unlock()
+		s.publish(snapshot, false)
+	})
+
+	view.Scanning = false
+	view.ScannedAt = time.Now().UnixMilli()
+	view.Nodes = results
+	view.Flows = aggregate(nodes, listed)
+	s.mu.Lock()
+	s.view = view
+	s.mu.Unlock()
+	s.publish(view, true)
+
+	failed := 0
+	for _, n := range results {
+		if !n.OK {
+			failed++
+		}
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "flow fleet scan hub=%d nodes=%d failed=%d flows=%d", hubID, len(nodes), failed, len(view.Flows))
+	}
+	return view, ctx.Err()
+}
+
+func (s *FlowFleetService) ScanSimple(sourceID, hubID uint32, concurrency int) (FleetView, error) {
+	return s.Scan(context.Background(), sourceID, hubID, concurrency)
+}
+
+// LastView returns the result of the most recent scan.
+func (s *FlowFleetService) LastView() FleetView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.view
+}
+
+// Bulk applies req.Action to req.FlowID on each executor and reports per
+// node. run starts a run; disable and set_interval re-send the flow with a new
+// interval (fetched with Get first, so the graph is preserved). delete is
+// rejected: the flow protocol has no delete action.
+func (s *FlowFleetService) Bulk(ctx context.Context, sourceID, hubID uint32, req BulkRequest) (BulkReport, error) {
+	if s.flow == nil {
+		return BulkReport{}, errors.New("flow fleet not initialized")
+	}
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	req.FlowID = strings.TrimSpace(req.FlowID)
+	if req.FlowID == "" {
+		return BulkReport{}, errors.New("flow_id is required")
+	}
+	switch req.Action {
+	case ActionRun, ActionDisable:
+	case ActionSetInterval:
+		if req.EveryMs == 0 {
+			return BulkReport{}, errors.New("everyMs must be positive")
+		}
+	case ActionDelete:
+		return BulkReport{}, errors.New("delete is not supported: the flow protocol has no delete action")
+	default:
+		return BulkReport{}, fmt.Errorf("unknown action %q", req.Action)
+	}
+	executors := req.Executors
+	if len(executors) == 0 {
+		executors = s.executorsWith(req.FlowID)
+	}
+	if len(executors) == 0 {
+		return BulkReport{}, fmt.Errorf("no executors have flow %s; scan first or list executors", req.FlowID)
+	}
+
+	report := BulkReport{Action: req.Action, FlowID: req.FlowID, Results: make([]BulkNodeResult, len(executors))}
+	for i, executor := range executors {
+		report.Results[i] = BulkNodeResult{ExecutorNode: executor, Error: "not attempted"}
+	}
+	fleet.ForEach(ctx, len(executors), clampConcurrency(req.Concurrency), func(i int) {
+		report.Results[i] = s.applyBulk(ctx, sourceID, hubID, executors[i], req)
+	})
+	for _, r := range report.Results {
+		if r.OK {
+			report.OK++
+		} else {
+			report.Failed++
+		}
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "flow fleet %s flow_id=%s ok=%d failed=%d", req.Action, req.FlowID, report.OK, report.Failed)
+	}
+	return report, nil
+}
+
+func (s *FlowFleetService) BulkSimple(sourceID, hubID uint32, req BulkRequest) (BulkReport, error) {
+	return s.Bulk(context.Background(), sourceID, hubID, req)
+}
+
+func (s *FlowFleetService) applyBulk(ctx context.Context, sourceID, hubID, executor uint32, req BulkRequest) BulkNodeResult {
+	started := time.Now()
+	result := BulkNodeResult{ExecutorNode: executor}
+	err := func() error {
+		reqID, err := newReqID()
+		if err != nil {
+			return err
+		}
+		callCtx, cancel := context.WithTimeout(ctx, defaultFleetTimeout)
+		defer cancel()
+		if req.Action == ActionRun {
+			resp, err := s.flow.Run(callCtx, sourceID, hubID, flow.RunReq{ReqID: reqID, OriginNode: sourceID, ExecutorNode: executor, FlowID: req.FlowID})
+			result.RunID = resp.RunID
+			return err
+		}
+		got, err := s.flow.Get(callCtx, sourceID, hubID, flow.GetReq{ReqID: reqID, OriginNode: sourceID, ExecutorNode: executor, FlowID: req.FlowID})
+		if err != nil {
+			return fmt.Errorf("get: %w", err)
+		}
+		everyMs := req.EveryMs
+		if req.Action == ActionDisable {
+			everyMs = disabledEveryMs
+		}
+		setID, err := newReqID()
+		if err != nil {
+			return err
+		}
+		trigger := got.Trigger
+		trigger.EveryMs = everyMs
+		_, err = s.flow.Set(callCtx, sourceID, hubID, flow.SetReq{
+			ReqID:        setID,
+			OriginNode:   sourceID,
+			ExecutorNode: executor,
+			FlowID:       req.FlowID,
+			Name:         got.Name,
+			Trigger:      trigger,
+			Graph:        got.Graph,
+		})
+		return err
+	}()
+	result.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// discover walks the hub's subtree. Nodes that report children are listed too
+// so deeper levels are found even if a hub only returns one level.
+func (s *FlowFleetService) discover(ctx context.Context, sourceID, hubID uint32, concurrency int) ([]uint32, error) {
+	seen := map[uint32]bool{hubID: true}
+	nodes := []uint32{hubID}
+	queue := []uint32{hubID}
+	for len(queue) > 0 {
+		batch := queue
+		queue = nil
+		found := make([][]management.NodeInfo, len(batch))
+		errs := make([]error, len(batch))
+		fleet.ForEach(ctx, len(batch), concurrency, func(i int) {
+			callCtx, cancel := context.WithTimeout(ctx, defaultFleetTimeout)
+			defer cancel()
+			resp, err := s.management.ListSubtree(callCtx, sourceID, batch[i])
+			found[i], errs[i] = resp.Nodes, err
+		})
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		for i, infos := range found {
+			if errs[i] != nil {
+				if batch[i] == hubID {
+					return nil, fmt.Errorf("list subtree of %d: %w", hubID, errs[i])
+				}
+				if s.logs != nil {
+					s.logs.Appendf("warn", "flow fleet: list subtree of %d failed: %v", batch[i], errs[i])
+				}
+				continue
+			}
+			for _, info := range infos {
+				if info.NodeID == 0 || seen[info.NodeID] {
+					continue
+				}
+				seen[info.NodeID] = true
+				nodes = append(nodes, info.NodeID)
+				if info.HasChildren {
+					queue = append(queue, info.NodeID)
+				}
+			}
+		}
+	}
+	sort.Slice(nodes[1:], func(i, j int) bool { return nodes[1+i] < nodes[1+j] })
+	return nodes, nil
+}
+
+func (s *FlowFleetService) listNode(ctx context.Context, sourceID, hubID, node uint32) (FleetNode, []flow.FlowSummary) {
+	started := time.Now()
+	result := FleetNode{NodeID: node}
+	reqID, err := newReqID()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultFleetTimeout)
+	defer cancel()
+	resp, err := s.flow.List(callCtx, sourceID, hubID, flow.ListReq{ReqID: reqID, OriginNode: sourceID, ExecutorNode: node})
+	result.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.OK = true
+	result.Flows = len(resp.Flows)
+	return result, resp.Flows
+}
+
+func (s *FlowFleetService) executorsWith(flowID string) []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.view.Flows {
+		if f.FlowID != flowID {
+			continue
+		}
+		out := make([]uint32, 0, len(f.Instances))
+		for _, inst := range f.Instances {
+			out = append(out, inst.ExecutorNode)
+		}
+		return out
+	}
+	return nil
+}
+
+func (s *FlowFleetService) publish(view FleetView, force bool) {
+	if s.bus == nil {
+		return
+	}
+	s.mu.Lock()
+	now := time.Now()
+	if !force && now.Sub(s.lastEmit) < scanEmitTick {
+		s.mu.Unlock()
+		return
+	}
+	s.lastEmit = now
+	s.mu.Unlock()
+	_ = s.bus.Publish(context.Background(), EventFlowFleetScan, view, nil)
+}
+
+func aggregate(nodes []uint32, listed [][]flow.FlowSummary) []FleetFlow {
+	byID := make(map[string]*FleetFlow)
+	for i, summaries := range listed {
+		for _, sum := range summaries {
+			f, ok := byID[sum.FlowID]
+			if !ok {
+				f = &FleetFlow{FlowID: sum.FlowID, Names: []string{}, Intervals: []uint64{}, Statuses: map[string]int{}}
+				byID[sum.FlowID] = f
+			}
+			f.Instances = append(f.Instances, FleetFlowInstance{
+				ExecutorNode: nodes[i],
+				Name:         sum.Name,
+				EveryMs:      sum.EveryMs,
+				Disabled:     sum.EveryMs >= disabledEveryMs,
+				LastRunID:    sum.LastRunID,
+				LastStatus:   sum.LastStatus,
+			})
+			if !containsString(f.Names, sum.Name) {
+				f.Names = append(f.Names, sum.Name)
+			}
+			if !containsUint(f.Intervals, sum.EveryMs) {
+				f.Intervals = append(f.Intervals, sum.EveryMs)
+			}
+			status := sum.LastStatus
+			if status == "" {
+				status = "never"
+			}
+			f.Statuses[status]++
+		}
+	}
+	out := make([]FleetFlow, 0, len(byID))
+	for _, f := range byID {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FlowID < out[j].FlowID })
+	return out
+}
+
+func clampConcurrency(n int) int {
+	if n <= 0 {
+		return defaultFleetConcurrency
+	}
+	if n > maxFleetConcurrency {
+		return maxFleetConcurrency
+	}
+	return n
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsUint(list []uint64, v uint64) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func newReqID() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
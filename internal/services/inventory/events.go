@@ -0,0 +1,82 @@
+package inventory
+
+const EventInventorySweep = "inventory.sweep"
+
+// InventoryPrefs configures the periodic sweep. The sweep runs every
+// IntervalMin minutes, counted from the last stored sweep, while Enabled.
+type InventoryPrefs struct {
+	Enabled       bool   `json:"enabled"`
+	SourceID      uint32 `json:"sourceId"`
+	HubID         uint32 `json:"hubId"`
+	IntervalMin   int    `json:"intervalMin"`
+	Concurrency   int    `json:"concurrency"`
+	RetentionDays int    `json:"retentionDays"`
+}
+
+// InventoryEntry is one node as seen by one sweep.
+type InventoryEntry struct {
+	NodeID    uint32            `json:"nodeId"`
+	ParentID  uint32            `json:"parentId"`
+	Reachable bool              `json:"reachable"`
+	Error     string            `json:"error,omitempty"`
+	LatencyMs int64             `json:"latencyMs"`
+	Items     map[string]string `json:"items,omitempty"`
+}
+
+type Sweep struct {
+	ID         string           `json:"id"`
+	HubID      uint32           `json:"hubId"`
+	StartedAt  int64            `json:"startedAt"`
+	DurationMs int64            `json:"durationMs"`
+	Nodes      []InventoryEntry `json:"nodes"`
+}
+
+type SweepSummary struct {
+	ID          string `json:"id"`
+	HubID       uint32 `json:"hubId"`
+	StartedAt   int64  `json:"startedAt"`
+	DurationMs  int64  `json:"durationMs"`
+	Total       int    `json:"total"`
+	Reachable   int    `json:"reachable"`
+	Unreachable int    `json:"unreachable"`
+	Outdated    int    `json:"outdated"`
+	Missing     int    `json:"missing"`
+}
+
+// Build identifies a binary by the NodeInfo items it reports.
+type Build struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	VCSTime string `json:"vcsTime,omitempty"`
+}
+
+// DriftEntry groups nodes running the same app or module. Reference is the
+// newest build seen in the group and Outdated lists nodes running anything
+// else.
+type DriftEntry struct {
+	Group     string   `json:"group"`
+	Reference Build    `json:"reference"`
+	Builds    int      `json:"builds"`
+	Outdated  []uint32 `json:"outdated"`
+}
+
+// InventoryReport is a sweep with its findings. Missing lists nodes that were
+// in the previous sweep but not in this one.
+type InventoryReport struct {
+	Summary     SweepSummary     `json:"summary"`
+	Unreachable []uint32         `json:"unreachable"`
+	Missing     []uint32         `json:"missing"`
+	Drift       []DriftEntry     `json:"drift"`
+	Nodes       []InventoryEntry `json:"nodes"`
+}
+
+// NodeHistoryEntry is one node's state in one sweep, for tracking a node over
+// time.
+type NodeHistoryEntry struct {
+	SweepID   string `json:"sweepId"`
+	At        int64  `json:"at"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	Build     Build  `json:"build"`
+	Platform  string `json:"platform,omitempty"`
+}
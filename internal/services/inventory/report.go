@@ -0,0 +1,191 @@
+package inventory
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+)
+
+func buildReport(sweep Sweep, prev *Sweep) InventoryReport {
+	report := InventoryReport{
+		Summary:     SweepSummary{ID: sweep.ID, HubID: sweep.HubID, StartedAt: sweep.StartedAt, DurationMs: sweep.DurationMs, Total: len(sweep.Nodes)},
+		Unreachable: []uint32{},
+		Missing:     []uint32{},
+		Nodes:       sweep.Nodes,
+	}
+	seen := make(map[uint32]bool, len(sweep.Nodes))
+	for _, entry := range sweep.Nodes {
+		seen[entry.NodeID] = true
+		if entry.Reachable {
+			report.Summary.Reachable++
+		} else {
+			report.Unreachable = append(report.Unreachable, entry.NodeID)
+		}
+	}
+	if prev != nil {
+		for _, entry := range prev.Nodes {
+			if !seen[entry.NodeID] {
+				report.Missing = append(report.Missing, entry.NodeID)
+			}
+		}
+	}
+	report.Drift = detectDrift(sweep.Nodes)
+	for _, drift := range report.Drift {
+		report.Summary.Outdated += len(drift.Outdated)
+	}
+	report.Summary.Unreachable = len(report.Unreachable)
+	report.Summary.Missing = len(report.Missing)
+	return report
+}
+
+// detectDrift groups reachable nodes by module (or app when the module is
+// unknown) and picks the newest build of each group as the reference. The
+// newest build is the one with the latest vcs_time; without VCS data the most
+// common build wins. Groups running a single build are not reported.
+func detectDrift(entries []InventoryEntry) []DriftEntry {
+	type member struct {
+		node  uint32
+		build Build
+	}
+	groups := make(map[string][]member)
+	for _, entry := range entries {
+		if !entry.Reachable {
+			continue
+		}
+		group := strings.TrimSpace(entry.Items["module"])
+		if group == "" {
+			group = strings.TrimSpace(entry.Items["app"])
+		}
+		if group == "" {
+			continue
+		}
+		groups[group] = append(groups[group], member{node: entry.NodeID, build: buildOf(entry.Items)})
+	}
+
+	out := []DriftEntry{}
+	for group, members := range groups {
+		counts := make(map[Build]int)
+		for _, m := range members {
+			counts[m.build]++
+		}
+		if len(counts) < 2 {
+			continue
+		}
+		var ref Build
+		first := true
+		for build, n := range counts {
+			if first || newerBuild(build, n, ref, counts[ref]) {
+				ref, first = build, false
+			}
+		}
+		entry := DriftEntry{Group: group, Reference: ref, Builds: len(counts), Outdated: []uint32{}}
+		for _, m := range members {
+			if m.build != ref {
+				entry.Outdated = append(entry.Outdated, m.node)
+			}
+		}
+		sort.Slice(entry.Outdated, func(i, j int) bool { return entry.Outdated[i] < entry.Outdated[j] })
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Group < out[j].Group })
+	return out
+}
+
+func newerBuild(a Build, aCount int, b Build, bCount int) bool {
+	at, aOK := parseVCSTime(a.VCSTime)
+	bt, bOK := parseVCSTime(b.VCSTime)
+	switch {
+	case aOK && bOK && !at.Equal(bt):
+		return at.After(bt)
+	case aOK != bOK:
+		return aOK
+	case aCount != bCount:
+		return aCount > bCount
+	case a.Version != b.Version:
+		return a.Version > b.Version
+	default:
+		return a.Commit > b.Commit
+	}
+}
+
+func parseVCSTime(raw string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(raw))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func buildOf(items map[string]string) Build {
+	return Build{
+		Version: strings.TrimSpace(items["version"]),
+		Commit:  strings.TrimSpace(items["commit"]),
+		VCSTime: strings.TrimSpace(items["vcs_time"]),
+	}
+}
+
+// ExportCSV writes one row per node of a stored sweep (newest when sweepID is
+// empty) and returns the number of rows.
+func (s *InventoryService) ExportCSV(path, sweepID string) (int, error) {
+	path, err := fleet.ExportPath(path)
+	if err != nil {
+		return 0, err
+	}
+	report, err := s.Report(sweepID)
+	if err != nil {
+		return 0, err
+	}
+	outdated := make(map[uint32]string)
+	for _, drift := range report.Drift {
+		for _, node := range drift.Outdated {
+			outdated[node] = drift.Reference.Version
+		}
+	}
+	header := []string{
+		"sweep_id", "swept_at", "node_id", "parent_id", "reachable", "error", "latency_ms",
+		"app", "module", "version", "commit", "vcs_time", "platform", "go_version", "outdated", "reference_version",
+	}
+	sweptAt := time.UnixMilli(report.Summary.StartedAt).UTC().Format(time.RFC3339)
+	rows := make([][]string, 0, len(report.Nodes))
+	for _, entry := range report.Nodes {
+		ref, isOutdated := outdated[entry.NodeID]
+		rows = append(rows, []string{
+			report.Summary.ID, sweptAt,
+			strconv.FormatUint(uint64(entry.NodeID), 10), strconv.FormatUint(uint64(entry.ParentID), 10),
+			strconv.FormatBool(entry.Reachable), entry.Error, strconv.FormatInt(entry.LatencyMs, 10),
+			entry.Items["app"], entry.Items["module"], entry.Items["version"], entry.Items["commit"],
+			entry.Items["vcs_time"], entry.Items["platform"], entry.Items["go_version"],
+			strconv.FormatBool(isOutdated), ref,
+		})
+	}
+	if err := fleet.WriteCSV(path, header, rows); err != nil {
+		return 0, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "inventory exported %d rows path=%s", len(rows), path)
+	}
+	return len(rows), nil
+}
+
+// ExportJSON writes the full report of a stored sweep (newest when sweepID is
+// empty).
+func (s *InventoryService) ExportJSON(path, sweepID string) (int, error) {
+	path, err := fleet.ExportPath(path)
+	if err != nil {
+		return 0, err
+	}
+	report, err := s.Report(sweepID)
+	if err != nil {
+		return 0, err
+	}
+	if err := fleet.WriteJSON(path, report); err != nil {
+		return 0, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "inventory exported report %s path=%s", report.Summary.ID, path)
+	}
+	return len(report.Nodes), nil
+}
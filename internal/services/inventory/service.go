@@ -0,0 +1,289 @@
+package inventory
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	mgmtsvc "github.com/yttydcs/myflowhub-win/internal/services/management"
+	topologysvc "github.com/yttydcs/myflowhub-win/internal/services/topology"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	cfgInventoryPrefs = "inventory.prefs"
+
+	defaultCallTimeout   = 8 * time.Second
+	defaultSweepTimeout  = 5 * time.Minute
+	defaultIntervalMin   = 24 * 60
+	minIntervalMin       = 5
+	defaultConcurrency   = 8
+	maxConcurrency       = 32
+	defaultRetentionDays = 90
+	retryDelay           = 5 * time.Minute
+)
+
+// InventoryService periodically collects NodeInfo from every node under a hub
+// and keeps the results so outdated binaries and unreachable nodes show up.
+type InventoryService struct {
+	topology   *topologysvc.TopologyService
+	management *mgmtsvc.ManagementService
+	logs       *logs.LogService
+	store      *storage.Store
+	bus        eventbus.IBus
+
+	sweepMu sync.Mutex
+	fileMu  sync.Mutex
+
+	mu         sync.Mutex
+	prefs      InventoryPrefs
+	loopCancel context.CancelFunc
+	nextAt     time.Time
+}
+
+func New(topology *topologysvc.TopologyService, management *mgmtsvc.ManagementService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *InventoryService {
+	svc := &InventoryService{topology: topology, management: management, logs: logsSvc, store: store, bus: bus}
+	svc.ReloadPrefs()
+	return svc
+}
+
+func (s *InventoryService) Close() {
+	s.stopLoop()
+}
+
+func (s *InventoryService) Prefs() (InventoryPrefs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prefs, nil
+}
+
+func (s *InventoryService) SavePrefs(prefs InventoryPrefs) (InventoryPrefs, error) {
+	if s.store == nil {
+		return InventoryPrefs{}, errors.New("storage not initialized")
+	}
+	normalized := normalizePrefs(prefs)
+	if normalized.Enabled && normalized.HubID == 0 {
+		return InventoryPrefs{}, errors.New("hub_id is required for scheduled sweeps")
+	}
+	raw, err := json.Marshal(normalized)
+	if err != nil {
+		return InventoryPrefs{}, err
+	}
+	if err := s.store.SetString(s.store.CurrentProfile(), cfgInventoryPrefs, string(raw)); err != nil {
+		return InventoryPrefs{}, err
+	}
+	s.applyPrefs(normalized)
+	return normalized, nil
+}
+
+// ReloadPrefs re-reads the sweep settings after a profile switch and
+// restarts the schedule.
+func (s *InventoryService) ReloadPrefs() {
+	s.applyPrefs(s.loadPrefs())
+}
+
+// NextSweepAt is the time of the next scheduled sweep, or zero when the
+// schedule is off.
+func (s *InventoryService) NextSweepAt() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nextAt.IsZero() {
+		return 0, nil
+	}
+	return s.nextAt.UnixMilli(), nil
+}
+
+// Sweep crawls the topology under hubID, asks every node for NodeInfo and
+// stores the result. Only one sweep runs at a time.
+func (s *InventoryService) Sweep(ctx context.Context, sourceID, hubID uint32) (InventoryReport, error) {
+	if s.topology == nil || s.management == nil {
+		return InventoryReport{}, errors.New("inventory not initialized")
+	}
+	if hubID == 0 {
+		return InventoryReport{}, errors.New("hub_id is required")
+	}
+	s.sweepMu.Lock()
+	defer s.sweepMu.Unlock()
+
+	s.mu.Lock()
+	prefs := s.prefs
+	s.mu.Unlock()
+
+	started := time.Now()
+	graph, err := s.topology.Crawl(ctx, sourceID, hubID, topologysvc.CrawlOptions{Force: true, Concurrency: prefs.Concurrency})
+	if err != nil {
+		return InventoryReport{}, err
+	}
+	entries := make([]InventoryEntry, len(graph.Nodes))
+	for i, node := range graph.Nodes {
+		entries[i] = InventoryEntry{NodeID: node.NodeID, ParentID: node.ParentID, Error: "not attempted"}
+	}
+	fleet.ForEach(ctx, len(entries), clampConcurrency(prefs.Concurrency), func(i int) {
+		entries[i] = s.probe(ctx, sourceID, entries[i])
+	})
+	if ctx.Err() != nil {
+		return InventoryReport{}, ctx.Err()
+	}
+
+	id, err := newSweepID()
+	if err != nil {
+		return InventoryReport{}, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].NodeID < entries[j].NodeID })
+	sweep := Sweep{ID: id, HubID: hubID, StartedAt: started.UnixMilli(), DurationMs: time.Since(started).Milliseconds(), Nodes: entries}
+	prev, _ := s.lastSweep(hubID)
+	if err := s.appendSweep(sweep, prefs.RetentionDays); err != nil {
+		return InventoryReport{}, err
+	}
+	report := buildReport(sweep, prev)
+	if s.logs != nil {
+		s.logs.Appendf("info", "inventory sweep of %d: %d nodes, %d unreachable, %d outdated", hubID, report.Summary.Total, report.Summary.Unreachable, report.Summary.Outdated)
+	}
+	if s.bus != nil {
+		_ = s.bus.Publish(context.Background(), EventInventorySweep, report.Summary, nil)
+	}
+	return report, nil
+}
+
+func (s *InventoryService) SweepSimple(sourceID, hubID uint32) (InventoryReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSweepTimeout)
+	defer cancel()
+	return s.Sweep(ctx, sourceID, hubID)
+}
+
+func (s *InventoryService) probe(ctx context.Context, sourceID uint32, entry InventoryEntry) InventoryEntry {
+	callCtx, cancel := context.WithTimeout(ctx, defaultCallTimeout)
+	defer cancel()
+	started := time.Now()
+	resp, err := s.management.NodeInfo(callCtx, sourceID, entry.NodeID)
+	entry.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		entry.Reachable, entry.Error = false, err.Error()
+		return entry
+	}
+	entry.Reachable, entry.Error, entry.Items = true, "", resp.Items
+	return entry
+}
+
+func (s *InventoryService) applyPrefs(prefs InventoryPrefs) {
+	s.stopLoop()
+	s.mu.Lock()
+	s.prefs = prefs
+	s.mu.Unlock()
+	if !prefs.Enabled || prefs.HubID == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.loopCancel = cancel
+	s.mu.Unlock()
+	go s.loop(ctx, prefs)
+}
+
+func (s *InventoryService) stopLoop() {
+	s.mu.Lock()
+	cancel := s.loopCancel
+	s.loopCancel = nil
+	s.nextAt = time.Time{}
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// loop schedules sweeps from the time of the last stored sweep, so restarting
+// the app does not trigger an extra sweep and a missed one runs soon after
+// startup.
+func (s *InventoryService) loop(ctx context.Context, prefs InventoryPrefs) {
+	interval := time.Duration(prefs.IntervalMin) * time.Minute
+	next := time.Now().Add(time.Minute)
+	if last, ok := s.lastSweep(prefs.HubID); ok {
+		if due := time.UnixMilli(last.StartedAt).Add(interval); due.After(next) {
+			next = due
+		}
+	}
+	for {
+		s.mu.Lock()
+		if ctx.Err() == nil {
+			s.nextAt = next
+		}
+		s.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		sweepCtx, cancel := context.WithTimeout(ctx, defaultSweepTimeout)
+		_, err := s.Sweep(sweepCtx, prefs.SourceID, prefs.HubID)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if s.logs != nil {
+				s.logs.Appendf("warn", "inventory scheduled sweep failed: %v", err)
+			}
+			wait := retryDelay
+			if interval < wait {
+				wait = interval
+			}
+			next = time.Now().Add(wait)
+			continue
+		}
+		next = time.Now().Add(interval)
+	}
+}
+
+func (s *InventoryService) loadPrefs() InventoryPrefs {
+	prefs := InventoryPrefs{}
+	if s.store != nil {
+		raw := strings.TrimSpace(s.store.GetString(s.store.CurrentProfile(), cfgInventoryPrefs, ""))
+		if raw != "" {
+			_ = json.Unmarshal([]byte(raw), &prefs)
+		}
+	}
+	return normalizePrefs(prefs)
+}
+
+func normalizePrefs(prefs InventoryPrefs) InventoryPrefs {
+	if prefs.IntervalMin <= 0 {
+		prefs.IntervalMin = defaultIntervalMin
+	}
+	if prefs.IntervalMin < minIntervalMin {
+		prefs.IntervalMin = minIntervalMin
+	}
+	prefs.Concurrency = clampConcurrency(prefs.Concurrency)
+	if prefs.RetentionDays <= 0 {
+		prefs.RetentionDays = defaultRetentionDays
+	}
+	return prefs
+}
+
+func clampConcurrency(n int) int {
+	if n <= 0 {
+		return defaultConcurrency
+	}
+	if n > maxConcurrency {
+		return maxConcurrency
+	}
+	return n
+}
+
+func newSweepID() (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
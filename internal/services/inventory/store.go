@@ -0,0 +1,231 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	inventoryDirName  = "inventory"
+	sweepsFileName    = "sweeps.jsonl"
+	maxSweepLineBytes = 16 * 1024 * 1024
+)
+
+// Sweeps lists stored sweeps of hubID (0 for every hub), newest first.
+func (s *InventoryService) Sweeps(hubID uint32) ([]SweepSummary, error) {
+	sweeps, err := s.loadSweeps()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SweepSummary, 0, len(sweeps))
+	prevByHub := make(map[uint32]Sweep)
+	for _, sweep := range sweeps {
+		prev, ok := prevByHub[sweep.HubID]
+		prevByHub[sweep.HubID] = sweep
+		if hubID != 0 && sweep.HubID != hubID {
+			continue
+		}
+		var report InventoryReport
+		if ok {
+			report = buildReport(sweep, &prev)
+		} else {
+			report = buildReport(sweep, nil)
+		}
+		out = append(out, report.Summary)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// Report rebuilds the report of a stored sweep. An empty sweepID picks the
+// newest sweep.
+func (s *InventoryService) Report(sweepID string) (InventoryReport, error) {
+	sweeps, err := s.loadSweeps()
+	if err != nil {
+		return InventoryReport{}, err
+	}
+	sweepID = strings.TrimSpace(sweepID)
+	idx := -1
+	if sweepID == "" {
+		idx = len(sweeps) - 1
+	} else {
+		for i := range sweeps {
+			if sweeps[i].ID == sweepID {
+				idx = i
+				break
+			}
+		}
+	}
+	if idx < 0 {
+		return InventoryReport{}, errors.New("sweep not found")
+	}
+	var prev *Sweep
+	for i := idx - 1; i >= 0; i-- {
+		if sweeps[i].HubID == sweeps[idx].HubID {
+			prev = &sweeps[i]
+			break
+		}
+	}
+	return buildReport(sweeps[idx], prev), nil
+}
+
+// NodeHistory returns a node's state in every stored sweep, oldest first.
+func (s *InventoryService) NodeHistory(nodeID uint32) ([]NodeHistoryEntry, error) {
+	if nodeID == 0 {
+		return nil, errors.New("node_id is required")
+	}
+	sweeps, err := s.loadSweeps()
+	if err != nil {
+		return nil, err
+	}
+	out := []NodeHistoryEntry{}
+	for _, sweep := range sweeps {
+		for _, entry := range sweep.Nodes {
+			if entry.NodeID != nodeID {
+				continue
+			}
+			out = append(out, NodeHistoryEntry{
+				SweepID:   sweep.ID,
+				At:        sweep.StartedAt,
+				Reachable: entry.Reachable,
+				Error:     entry.Error,
+				Build:     buildOf(entry.Items),
+				Platform:  entry.Items["platform"],
+			})
+			break
+		}
+	}
+	return out, nil
+}
+
+func (s *InventoryService) ClearSweeps() error {
+	path, err := s.sweepsPath()
+	if err != nil {
+		return err
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *InventoryService) lastSweep(hubID uint32) (*Sweep, bool) {
+	sweeps, err := s.loadSweeps()
+	if err != nil {
+		return nil, false
+	}
+	for i := len(sweeps) - 1; i >= 0; i-- {
+		if hubID == 0 || sweeps[i].HubID == hubID {
+			return &sweeps[i], true
+		}
+	}
+	return nil, false
+}
+
+// appendSweep adds a sweep and drops sweeps older than retentionDays. The
+// file is only rewritten when something expired.
+func (s *InventoryService) appendSweep(sweep Sweep, retentionDays int) error {
+	path, err := s.sweepsPath()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(sweep)
+	if err != nil {
+		return err
+	}
+	sweeps, err := s.loadSweeps()
+	if err != nil {
+		return err
+	}
+
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-time.Duration(retentionDays) * 24 * time.Hour).UnixMilli()
+	kept := sweeps[:0]
+	for _, old := range sweeps {
+		if old.StartedAt >= cutoff {
+			kept = append(kept, old)
+		}
+	}
+	if len(kept) == len(sweeps) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = f.Write(append(line, '\n'))
+		return err
+	}
+	var buf bytes.Buffer
+	for _, old := range kept {
+		data, err := json.Marshal(old)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *InventoryService) loadSweeps() ([]Sweep, error) {
+	path, err := s.sweepsPath()
+	if err != nil {
+		return nil, err
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Sweep{}, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	out := []Sweep{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxSweepLineBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var sweep Sweep
+		if err := json.Unmarshal(line, &sweep); err != nil {
+			continue
+		}
+		out = append(out, sweep)
+	}
+	return out, scanner.Err()
+}
+
+func (s *InventoryService) sweepsPath() (string, error) {
+	if s.store == nil {
+		return "", errors.New("storage not initialized")
+	}
+	dir := s.store.DataDir(s.store.CurrentProfile(), inventoryDirName)
+	if dir == "" {
+		return "", errors.New("storage not initialized")
+	}
+	return filepath.Join(dir, sweepsFileName), nil
+}
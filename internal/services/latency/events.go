@@ -0,0 +1,146 @@
+package latency
+
+const EventLatencyProgress = "latency.progress"
+
+// RunOptions controls an echo sweep. Every node gets Count echoes per payload
+// size, one at a time with IntervalMs between them; up to Concurrency nodes
+// are probed in parallel.
+type RunOptions struct {
+	Count        int    `json:"count"`
+	PayloadSizes []int  `json:"payloadSizes"`
+	Concurrency  int    `json:"concurrency"`
+	IntervalMs   int    `json:"intervalMs"`
+	TimeoutMs    int    `json:"timeoutMs"`
+	MaxDepth     int    `json:"maxDepth"`
+	Note         string `json:"note,omitempty"`
+}
+
+// RTTStats summarizes round-trip times in milliseconds. It is zero when no
+// echo came back.
+type RTTStats struct {
+	Samples int     `json:"samples"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"stdDev"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+}
+
+type SizeResult struct {
+	Size     int      `json:"size"`
+	Sent     int      `json:"sent"`
+	Received int      `json:"received"`
+	LossPct  float64  `json:"lossPct"`
+	RTT      RTTStats `json:"rtt"`
+}
+
+// NodeResult is one node in a run. HopMs is the node's median RTT minus its
+// parent's, i.e. what the last link adds; it equals the median RTT for nodes
+// whose parent was not measured. Errors counts failed echoes by message.
+type NodeResult struct {
+	NodeID   uint32         `json:"nodeId"`
+	ParentID uint32         `json:"parentId"`
+	Depth    int            `json:"depth"`
+	Sent     int            `json:"sent"`
+	Received int            `json:"received"`
+	LossPct  float64        `json:"lossPct"`
+	RTT      RTTStats       `json:"rtt"`
+	HopMs    float64        `json:"hopMs"`
+	BySize   []SizeResult   `json:"bySize"`
+	Errors   map[string]int `json:"errors,omitempty"`
+}
+
+type DepthResult struct {
+	Depth    int      `json:"depth"`
+	Nodes    int      `json:"nodes"`
+	Sent     int      `json:"sent"`
+	Received int      `json:"received"`
+	LossPct  float64  `json:"lossPct"`
+	RTT      RTTStats `json:"rtt"`
+}
+
+type RunSummary struct {
+	ID         string  `json:"id"`
+	HubID      uint32  `json:"hubId"`
+	StartedAt  int64   `json:"startedAt"`
+	DurationMs int64   `json:"durationMs"`
+	Nodes      int     `json:"nodes"`
+	Sent       int     `json:"sent"`
+	Received   int     `json:"received"`
+	LossPct    float64 `json:"lossPct"`
+	P50        float64 `json:"p50"`
+	P99        float64 `json:"p99"`
+	Note       string  `json:"note,omitempty"`
+}
+
+// LatencyRun is a stored sweep with its per-node and per-depth results.
+type LatencyRun struct {
+	Summary RunSummary    `json:"summary"`
+	Options RunOptions    `json:"options"`
+	Nodes   []NodeResult  `json:"nodes"`
+	Depths  []DepthResult `json:"depths"`
+}
+
+// LatencyProgress is published on EventLatencyProgress while a run is going.
+type LatencyProgress struct {
+	RunID  string `json:"runId"`
+	HubID  uint32 `json:"hubId"`
+	Phase  string `json:"phase"`
+	NodeID uint32 `json:"nodeId,omitempty"`
+	Done   int    `json:"done"`
+	Total  int    `json:"total"`
+}
+
+const (
+	NodeDegraded  = "degraded"
+	NodeImproved  = "improved"
+	NodeUnchanged = "unchanged"
+	NodeAdded     = "added"
+	NodeRemoved   = "removed"
+)
+
+// NodeDelta compares one node between two runs.
+type NodeDelta struct {
+	NodeID       uint32  `json:"nodeId"`
+	ParentID     uint32  `json:"parentId"`
+	Depth        int     `json:"depth"`
+	Status       string  `json:"status"`
+	BaseP50      float64 `json:"baseP50"`
+	P50          float64 `json:"p50"`
+	DeltaP50     float64 `json:"deltaP50"`
+	BaseLossPct  float64 `json:"baseLossPct"`
+	LossPct      float64 `json:"lossPct"`
+	DeltaLossPct float64 `json:"deltaLossPct"`
+	BaseHopMs    float64 `json:"baseHopMs"`
+	HopMs        float64 `json:"hopMs"`
+}
+
+type DepthDelta struct {
+	Depth        int     `json:"depth"`
+	BaseP50      float64 `json:"baseP50"`
+	P50          float64 `json:"p50"`
+	DeltaP50     float64 `json:"deltaP50"`
+	BaseLossPct  float64 `json:"baseLossPct"`
+	LossPct      float64 `json:"lossPct"`
+	DeltaLossPct float64 `json:"deltaLossPct"`
+}
+
+// LinkDelta is a parent->node link whose own contribution got worse: the hop
+// latency grew, or the node lost more echoes than its parent did.
+type LinkDelta struct {
+	ParentID     uint32  `json:"parentId"`
+	NodeID       uint32  `json:"nodeId"`
+	BaseHopMs    float64 `json:"baseHopMs"`
+	HopMs        float64 `json:"hopMs"`
+	DeltaLossPct float64 `json:"deltaLossPct"`
+}
+
+type LatencyComparison struct {
+	Base          RunSummary   `json:"base"`
+	Current       RunSummary   `json:"current"`
+	Nodes         []NodeDelta  `json:"nodes"`
+	Depths        []DepthDelta `json:"depths"`
+	DegradedLinks []LinkDelta  `json:"degradedLinks"`
+}
@@ -0,0 +1,237 @@
+package latency
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+)
+
+// A node or link counts as degraded when its median RTT grew by at least
+// degradeMinMs and by degradeRatio of the old value, or when its loss grew by
+// at least degradeLossPct points. Improvements use the same thresholds.
+const (
+	degradeMinMs   = 5.0
+	degradeRatio   = 0.5
+	degradeLossPct = 5.0
+)
+
+// Compare diffs two stored runs. An empty currentID picks the newest run and
+// an empty baseID the run before it for the same hub.
+func (s *LatencyService) Compare(baseID, currentID string) (LatencyComparison, error) {
+	runs, err := s.loadRuns()
+	if err != nil {
+		return LatencyComparison{}, err
+	}
+	cur := findRun(runs, currentID)
+	if cur < 0 {
+		return LatencyComparison{}, errors.New("run not found")
+	}
+	base := -1
+	if strings.TrimSpace(baseID) == "" {
+		for i := cur - 1; i >= 0; i-- {
+			if runs[i].Summary.HubID == runs[cur].Summary.HubID {
+				base = i
+				break
+			}
+		}
+		if base < 0 {
+			return LatencyComparison{}, errors.New("no earlier run of this hub to compare with")
+		}
+	} else if base = findRun(runs, baseID); base < 0 {
+		return LatencyComparison{}, errors.New("base run not found")
+	}
+	return compareRuns(runs[base], runs[cur]), nil
+}
+
+func compareRuns(base, cur LatencyRun) LatencyComparison {
+	out := LatencyComparison{
+		Base:          base.Summary,
+		Current:       cur.Summary,
+		Nodes:         []NodeDelta{},
+		Depths:        []DepthDelta{},
+		DegradedLinks: []LinkDelta{},
+	}
+	baseNodes := make(map[uint32]NodeResult, len(base.Nodes))
+	for _, node := range base.Nodes {
+		baseNodes[node.NodeID] = node
+	}
+	curNodes := make(map[uint32]NodeResult, len(cur.Nodes))
+	for _, node := range cur.Nodes {
+		curNodes[node.NodeID] = node
+	}
+
+	for _, node := range cur.Nodes {
+		delta := NodeDelta{NodeID: node.NodeID, ParentID: node.ParentID, Depth: node.Depth, P50: node.RTT.P50, LossPct: node.LossPct, HopMs: node.HopMs}
+		old, ok := baseNodes[node.NodeID]
+		if !ok {
+			delta.Status = NodeAdded
+			out.Nodes = append(out.Nodes, delta)
+			continue
+		}
+		delta.BaseP50, delta.BaseLossPct, delta.BaseHopMs = old.RTT.P50, old.LossPct, old.HopMs
+		delta.DeltaP50 = round2(node.RTT.P50 - old.RTT.P50)
+		delta.DeltaLossPct = round2(node.LossPct - old.LossPct)
+		delta.Status = classify(old, node)
+		out.Nodes = append(out.Nodes, delta)
+
+		// Hop latency already has the parent's share subtracted; for loss the
+		// parent's own increase is taken out here.
+		parentLoss := 0.0
+		if parentCur, ok := curNodes[node.ParentID]; ok {
+			if parentOld, ok := baseNodes[node.ParentID]; ok {
+				parentLoss = parentCur.LossPct - parentOld.LossPct
+			}
+		}
+		hopWorse := old.Received > 0 && node.Received > 0 && worse(old.HopMs, node.HopMs)
+		lossWorse := delta.DeltaLossPct-parentLoss >= degradeLossPct
+		if hopWorse || lossWorse {
+			out.DegradedLinks = append(out.DegradedLinks, LinkDelta{
+				ParentID:     node.ParentID,
+				NodeID:       node.NodeID,
+				BaseHopMs:    old.HopMs,
+				HopMs:        node.HopMs,
+				DeltaLossPct: round2(delta.DeltaLossPct - parentLoss),
+			})
+		}
+	}
+	for _, node := range base.Nodes {
+		if _, ok := curNodes[node.NodeID]; ok {
+			continue
+		}
+		out.Nodes = append(out.Nodes, NodeDelta{
+			NodeID: node.NodeID, ParentID: node.ParentID, Depth: node.Depth, Status: NodeRemoved,
+			BaseP50: node.RTT.P50, BaseLossPct: node.LossPct, BaseHopMs: node.HopMs,
+		})
+	}
+	sort.Slice(out.Nodes, func(i, j int) bool { return out.Nodes[i].NodeID < out.Nodes[j].NodeID })
+	sort.Slice(out.DegradedLinks, func(i, j int) bool { return out.DegradedLinks[i].NodeID < out.DegradedLinks[j].NodeID })
+
+	baseDepths := make(map[int]DepthResult, len(base.Depths))
+	for _, depth := range base.Depths {
+		baseDepths[depth.Depth] = depth
+	}
+	seen := make(map[int]bool, len(cur.Depths))
+	for _, depth := range cur.Depths {
+		seen[depth.Depth] = true
+		old := baseDepths[depth.Depth]
+		out.Depths = append(out.Depths, DepthDelta{
+			Depth:        depth.Depth,
+			BaseP50:      old.RTT.P50,
+			P50:          depth.RTT.P50,
+			DeltaP50:     round2(depth.RTT.P50 - old.RTT.P50),
+			BaseLossPct:  old.LossPct,
+			LossPct:      depth.LossPct,
+			DeltaLossPct: round2(depth.LossPct - old.LossPct),
+		})
+	}
+	for _, depth := range base.Depths {
+		if seen[depth.Depth] {
+			continue
+		}
+		out.Depths = append(out.Depths, DepthDelta{Depth: depth.Depth, BaseP50: depth.RTT.P50, BaseLossPct: depth.LossPct})
+	}
+	sort.Slice(out.Depths, func(i, j int) bool { return out.Depths[i].Depth < out.Depths[j].Depth })
+	return out
+}
+
+func classify(old, cur NodeResult) string {
+	switch {
+	case old.Received > 0 && cur.Received == 0:
+		return NodeDegraded
+	case old.Received == 0 && cur.Received > 0:
+		return NodeImproved
+	case cur.LossPct-old.LossPct >= degradeLossPct:
+		return NodeDegraded
+	case old.LossPct-cur.LossPct >= degradeLossPct:
+		return NodeImproved
+	case cur.Received == 0:
+		return NodeUnchanged
+	case worse(old.RTT.P50, cur.RTT.P50):
+		return NodeDegraded
+	case worse(cur.RTT.P50, old.RTT.P50):
+		return NodeImproved
+	default:
+		return NodeUnchanged
+	}
+}
+
+func worse(old, cur float64) bool {
+	diff := cur - old
+	return diff >= degradeMinMs && diff >= degradeRatio*old
+}
+
+// ExportCSV writes one row per node of a stored run (newest when runID is
+// empty) and returns the number of rows.
+func (s *LatencyService) ExportCSV(path, runID string) (int, error) {
+	path, err := fleet.ExportPath(path)
+	if err != nil {
+		return 0, err
+	}
+	run, err := s.Report(runID)
+	if err != nil {
+		return 0, err
+	}
+	header := []string{
+		"run_id", "run_at", "node_id", "parent_id", "depth", "sent", "received", "loss_pct",
+		"rtt_min_ms", "rtt_p50_ms", "rtt_p90_ms", "rtt_p99_ms", "rtt_max_ms", "rtt_stddev_ms", "hop_ms", "errors",
+	}
+	runAt := time.UnixMilli(run.Summary.StartedAt).UTC().Format(time.RFC3339)
+	ff := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	rows := make([][]string, 0, len(run.Nodes))
+	for _, node := range run.Nodes {
+		rows = append(rows, []string{
+			run.Summary.ID, runAt,
+			strconv.FormatUint(uint64(node.NodeID), 10), strconv.FormatUint(uint64(node.ParentID), 10), strconv.Itoa(node.Depth),
+			strconv.Itoa(node.Sent), strconv.Itoa(node.Received), ff(node.LossPct),
+			ff(node.RTT.Min), ff(node.RTT.P50), ff(node.RTT.P90), ff(node.RTT.P99), ff(node.RTT.Max), ff(node.RTT.StdDev),
+			ff(node.HopMs), formatErrors(node.Errors),
+		})
+	}
+	if err := fleet.WriteCSV(path, header, rows); err != nil {
+		return 0, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "latency exported %d rows path=%s", len(rows), path)
+	}
+	return len(rows), nil
+}
+
+// ExportJSON writes a stored run (newest when runID is empty) as indented
+// JSON.
+func (s *LatencyService) ExportJSON(path, runID string) (int, error) {
+	path, err := fleet.ExportPath(path)
+	if err != nil {
+		return 0, err
+	}
+	run, err := s.Report(runID)
+	if err != nil {
+		return 0, err
+	}
+	if err := fleet.WriteJSON(path, run); err != nil {
+		return 0, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "latency exported run %s path=%s", run.Summary.ID, path)
+	}
+	return len(run.Nodes), nil
+}
+
+func formatErrors(errs map[string]int) string {
+	if len(errs) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+" x"+strconv.Itoa(errs[key]))
+	}
+	return strings.Join(parts, "; ")
+}
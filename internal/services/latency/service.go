@@ -0,0 +1,428 @@
+package latency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	mgmtsvc "github.com/yttydcs/myflowhub-win/internal/services/management"
+	topologysvc "github.com/yttydcs/myflowhub-win/internal/services/topology"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	defaultRunTimeout  = 10 * time.Minute
+	defaultCount       = 5
+	maxCount           = 100
+	defaultPayloadSize = 32
+	maxPayloadSize     = 32 * 1024
+	maxPayloadSizes    = 8
+	defaultConcurrency = 4
+	maxConcurrency     = 32
+	defaultTimeoutMs   = 5000
+	minTimeoutMs       = 200
+	maxTimeoutMs       = 60000
+	maxIntervalMs      = 10000
+)
+
+// LatencyService echoes every node under a hub to measure round-trip times
+// and loss, and keeps the results so runs can be compared.
+type LatencyService struct {
+	topology   *topologysvc.TopologyService
+	management *mgmtsvc.ManagementService
+	logs       *logs.LogService
+	store      *storage.Store
+	bus        eventbus.IBus
+
+	fileMu sync.Mutex
+
+	mu        sync.Mutex
+	running   bool
+	runCancel context.CancelFunc
+}
+
+func New(topology *topologysvc.TopologyService, management *mgmtsvc.ManagementService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *LatencyService {
+	return &LatencyService{topology: topology, management: management, logs: logsSvc, store: store, bus: bus}
+}
+
+func (s *LatencyService) Close() {
+	s.Cancel()
+}
+
+// Running reports whether a run is in progress.
+func (s *LatencyService) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Cancel stops the run in progress, if any. A cancelled run is not stored.
+func (s *LatencyService) Cancel() {
+	s.mu.Lock()
+	cancel := s.runCancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Run crawls the topology under hubID and echoes every node found, except
+// sourceID itself. Only one run is allowed at a time.
+func (s *LatencyService) Run(ctx context.Context, sourceID, hubID uint32, opts RunOptions) (LatencyRun, error) {
+	if s.topology == nil || s.management == nil {
+		return LatencyRun{}, errors.New("latency not initialized")
+	}
+	if hubID == 0 {
+		return LatencyRun{}, errors.New("hub_id is required")
+	}
+	opts, err := normalizeOptions(opts)
+	if err != nil {
+		return LatencyRun{}, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return LatencyRun{}, errors.New("a latency run is already in progress")
+	}
+	s.running, s.runCancel = true, cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running, s.runCancel = false, nil
+		s.mu.Unlock()
+	}()
+
+	id, err := newRunID()
+	if err != nil {
+		return LatencyRun{}, err
+	}
+	started := time.Now()
+	graph, err := s.topology.Crawl(ctx, sourceID, hubID, topologysvc.CrawlOptions{Force: true, Concurrency: opts.Concurrency, MaxDepth: opts.MaxDepth})
+	if err != nil {
+		return LatencyRun{}, err
+	}
+	targets := make([]topologysvc.TopologyNode, 0, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		if node.NodeID == sourceID || node.Stale {
+			continue
+		}
+		targets = append(targets, node)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Depth != targets[j].Depth {
+			return targets[i].Depth < targets[j].Depth
+		}
+		return targets[i].NodeID < targets[j].NodeID
+	})
+
+	s.publish(LatencyProgress{RunID: id, HubID: hubID, Phase: "start", Total: len(targets)})
+	results := make([]NodeResult, len(targets))
+	samples := make([][]float64, len(targets))
+	var done int32
+	fleet.ForEach(ctx, len(targets), opts.Concurrency, func(i int) {
+		results[i], samples[i] = s.probeNode(ctx, sourceID, id, targets[i], opts)
+		n := atomic.AddInt32(&done, 1)
+		s.publish(LatencyProgress{RunID: id, HubID: hubID, Phase: "node", NodeID: targets[i].NodeID, Done: int(n), Total: len(targets)})
+	})
+	if ctx.Err() != nil {
+		s.publish(LatencyProgress{RunID: id, HubID: hubID, Phase: "cancelled", Done: int(atomic.LoadInt32(&done)), Total: len(targets)})
+		return LatencyRun{}, ctx.Err()
+	}
+
+	run := buildRun(id, hubID, started, opts, results, samples)
+	if err := s.appendRun(run); err != nil {
+		return LatencyRun{}, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "latency run of %d: %d nodes, loss %.1f%%, p50 %.1fms p99 %.1fms",
+			hubID, run.Summary.Nodes, run.Summary.LossPct, run.Summary.P50, run.Summary.P99)
+	}
+	s.publish(LatencyProgress{RunID: id, HubID: hubID, Phase: "done", Done: len(targets), Total: len(targets)})
+	return run, nil
+}
+
+func (s *LatencyService) RunSimple(sourceID, hubID uint32, opts RunOptions) (LatencyRun, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRunTimeout)
+	defer cancel()
+	return s.Run(ctx, sourceID, hubID, opts)
+}
+
+// probeNode sends the echoes for one node sequentially, so a node's RTTs are
+// not inflated by our own parallel requests to it.
+func (s *LatencyService) probeNode(ctx context.Context, sourceID uint32, runID string, node topologysvc.TopologyNode, opts RunOptions) (NodeResult, []float64) {
+	result := NodeResult{NodeID: node.NodeID, ParentID: node.ParentID, Depth: node.Depth, BySize: make([]SizeResult, 0, len(opts.PayloadSizes))}
+	var all []float64
+	seq := 0
+	for _, size := range opts.PayloadSizes {
+		sized := SizeResult{Size: size}
+		var rtts []float64
+		for i := 0; i < opts.Count; i++ {
+			if ctx.Err() != nil {
+				break
+			}
+			if seq > 0 && opts.IntervalMs > 0 {
+				timer := time.NewTimer(time.Duration(opts.IntervalMs) * time.Millisecond)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+				case <-timer.C:
+				}
+				if ctx.Err() != nil {
+					break
+				}
+			}
+			seq++
+			sized.Sent++
+			rtt, err := s.echo(ctx, sourceID, node.NodeID, echoPayload(runID, seq, size), opts.TimeoutMs)
+			if err != nil {
+				if ctx.Err() != nil {
+					sized.Sent--
+					break
+				}
+				if result.Errors == nil {
+					result.Errors = make(map[string]int)
+				}
+				result.Errors[err.Error()]++
+				continue
+			}
+			sized.Received++
+			rtts = append(rtts, rtt)
+		}
+		sized.LossPct = lossPct(sized.Sent, sized.Received)
+		sized.RTT = computeStats(rtts)
+		result.Sent += sized.Sent
+		result.Received += sized.Received
+		result.BySize = append(result.BySize, sized)
+		all = append(all, rtts...)
+	}
+	result.LossPct = lossPct(result.Sent, result.Received)
+	result.RTT = computeStats(all)
+	return result, all
+}
+
+func (s *LatencyService) echo(ctx context.Context, sourceID, nodeID uint32, message string, timeoutMs int) (float64, error) {
+	callCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	resp, err := s.management.NodeEcho(callCtx, sourceID, nodeID, message)
+	rtt := float64(time.Since(started).Microseconds()) / 1000
+	if err != nil {
+		return 0, err
+	}
+	if resp.Echo != message {
+		return 0, errors.New("echo mismatch")
+	}
+	return rtt, nil
+}
+
+// echoPayload builds a message of exactly size bytes (or just the unique
+// prefix when size is smaller) so replies can be matched to requests.
+func echoPayload(runID string, seq, size int) string {
+	prefix := fmt.Sprintf("%s-%d-", runID, seq)
+	if len(prefix) >= size {
+		return prefix
+	}
+	return prefix + strings.Repeat("x", size-len(prefix))
+}
+
+// buildRun fills in hop latencies, per-depth results and the summary. Depth
+// and summary statistics pool every sample rather than averaging node
+// statistics, so busy nodes do not skew them.
+func buildRun(id string, hubID uint32, started time.Time, opts RunOptions, results []NodeResult, samples [][]float64) LatencyRun {
+	medianByNode := make(map[uint32]float64, len(results))
+	for _, result := range results {
+		if result.Received > 0 {
+			medianByNode[result.NodeID] = result.RTT.P50
+		}
+	}
+	type depthAcc struct {
+		result  DepthResult
+		samples []float64
+	}
+	depths := make(map[int]*depthAcc)
+	var all []float64
+	sent, received := 0, 0
+	for i := range results {
+		result := &results[i]
+		if result.Received > 0 {
+			result.HopMs = result.RTT.P50
+			if parent, ok := medianByNode[result.ParentID]; ok && result.ParentID != result.NodeID {
+				result.HopMs = round2(result.RTT.P50 - parent)
+			}
+		}
+		acc := depths[result.Depth]
+		if acc == nil {
+			acc = &depthAcc{result: DepthResult{Depth: result.Depth}}
+			depths[result.Depth] = acc
+		}
+		acc.result.Nodes++
+		acc.result.Sent += result.Sent
+		acc.result.Received += result.Received
+		acc.samples = append(acc.samples, samples[i]...)
+		all = append(all, samples[i]...)
+		sent += result.Sent
+		received += result.Received
+	}
+	depthResults := make([]DepthResult, 0, len(depths))
+	for _, acc := range depths {
+		acc.result.LossPct = lossPct(acc.result.Sent, acc.result.Received)
+		acc.result.RTT = computeStats(acc.samples)
+		depthResults = append(depthResults, acc.result)
+	}
+	sort.Slice(depthResults, func(i, j int) bool { return depthResults[i].Depth < depthResults[j].Depth })
+	sort.Slice(results, func(i, j int) bool { return results[i].NodeID < results[j].NodeID })
+
+	stats := computeStats(all)
+	return LatencyRun{
+		Summary: RunSummary{
+			ID:         id,
+			HubID:      hubID,
+			StartedAt:  started.UnixMilli(),
+			DurationMs: time.Since(started).Milliseconds(),
+			Nodes:      len(results),
+			Sent:       sent,
+			Received:   received,
+			LossPct:    lossPct(sent, received),
+			P50:        stats.P50,
+			P99:        stats.P99,
+			Note:       opts.Note,
+		},
+		Options: opts,
+		Nodes:   results,
+		Depths:  depthResults,
+	}
+}
+
+func computeStats(samples []float64) RTTStats {
+	if len(samples) == 0 {
+		return RTTStats{}
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(len(sorted))
+	variance := 0.0
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(sorted))
+	return RTTStats{
+		Samples: len(sorted),
+		Min:     round2(sorted[0]),
+		Max:     round2(sorted[len(sorted)-1]),
+		Mean:    round2(mean),
+		StdDev:  round2(math.Sqrt(variance)),
+		P50:     round2(percentile(sorted, 50)),
+		P90:     round2(percentile(sorted, 90)),
+		P99:     round2(percentile(sorted, 99)),
+	}
+}
+
+// percentile uses the nearest-rank method on sorted samples.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func lossPct(sent, received int) float64 {
+	if sent == 0 {
+		return 0
+	}
+	return round2(float64(sent-received) / float64(sent) * 100)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func normalizeOptions(opts RunOptions) (RunOptions, error) {
+	if opts.Count <= 0 {
+		opts.Count = defaultCount
+	}
+	if opts.Count > maxCount {
+		return opts, fmt.Errorf("count must be at most %d", maxCount)
+	}
+	sizes := make([]int, 0, len(opts.PayloadSizes))
+	seen := make(map[int]bool, len(opts.PayloadSizes))
+	for _, size := range opts.PayloadSizes {
+		if size <= 0 || size > maxPayloadSize {
+			return opts, fmt.Errorf("payload size must be between 1 and %d bytes", maxPayloadSize)
+		}
+		if seen[size] {
+			continue
+		}
+		seen[size] = true
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		sizes = append(sizes, defaultPayloadSize)
+	}
+	if len(sizes) > maxPayloadSizes {
+		return opts, fmt.Errorf("at most %d payload sizes are allowed", maxPayloadSizes)
+	}
+	sort.Ints(sizes)
+	opts.PayloadSizes = sizes
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.Concurrency > maxConcurrency {
+		opts.Concurrency = maxConcurrency
+	}
+	if opts.TimeoutMs <= 0 {
+		opts.TimeoutMs = defaultTimeoutMs
+	}
+	if opts.TimeoutMs < minTimeoutMs {
+		opts.TimeoutMs = minTimeoutMs
+	}
+	if opts.TimeoutMs > maxTimeoutMs {
+		opts.TimeoutMs = maxTimeoutMs
+	}
+	if opts.IntervalMs < 0 {
+		opts.IntervalMs = 0
+	}
+	if opts.IntervalMs > maxIntervalMs {
+		opts.IntervalMs = maxIntervalMs
+	}
+	if opts.MaxDepth < 0 {
+		opts.MaxDepth = 0
+	}
+	opts.Note = strings.TrimSpace(opts.Note)
+	return opts, nil
+}
+
+func (s *LatencyService) publish(progress LatencyProgress) {
+	if s.bus == nil {
+		return
+	}
+	_ = s.bus.Publish(context.Background(), EventLatencyProgress, progress, nil)
+}
+
+func newRunID() (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
@@ -0,0 +1,192 @@
+package latency
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	latencyDirName  = "latency"
+	runsFileName    = "runs.jsonl"
+	maxStoredRuns   = 50
+	maxRunLineBytes = 16 * 1024 * 1024
+)
+
+// Runs lists stored runs of hubID (0 for every hub), newest first.
+func (s *LatencyService) Runs(hubID uint32) ([]RunSummary, error) {
+	runs, err := s.loadRuns()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RunSummary, 0, len(runs))
+	for i := len(runs) - 1; i >= 0; i-- {
+		if hubID != 0 && runs[i].Summary.HubID != hubID {
+			continue
+		}
+		out = append(out, runs[i].Summary)
+	}
+	return out, nil
+}
+
+// Report returns a stored run. An empty runID picks the newest run.
+func (s *LatencyService) Report(runID string) (LatencyRun, error) {
+	runs, err := s.loadRuns()
+	if err != nil {
+		return LatencyRun{}, err
+	}
+	idx := findRun(runs, runID)
+	if idx < 0 {
+		return LatencyRun{}, errors.New("run not found")
+	}
+	return runs[idx], nil
+}
+
+func (s *LatencyService) DeleteRun(runID string) error {
+	runID = strings.TrimSpace(runID)
+	if runID == "" {
+		return errors.New("run_id is required")
+	}
+	runs, err := s.loadRuns()
+	if err != nil {
+		return err
+	}
+	idx := findRun(runs, runID)
+	if idx < 0 {
+		return errors.New("run not found")
+	}
+	kept := append(runs[:idx:idx], runs[idx+1:]...)
+	return s.writeRuns(kept)
+}
+
+func (s *LatencyService) ClearRuns() error {
+	path, err := s.runsPath()
+	if err != nil {
+		return err
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func findRun(runs []LatencyRun, runID string) int {
+	runID = strings.TrimSpace(runID)
+	if runID == "" {
+		return len(runs) - 1
+	}
+	for i := range runs {
+		if runs[i].Summary.ID == runID {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendRun adds a run and drops the oldest ones beyond maxStoredRuns. The
+// file is only rewritten when something was dropped.
+func (s *LatencyService) appendRun(run LatencyRun) error {
+	runs, err := s.loadRuns()
+	if err != nil {
+		return err
+	}
+	if len(runs)+1 > maxStoredRuns {
+		runs = append(runs[len(runs)+1-maxStoredRuns:], run)
+		return s.writeRuns(runs)
+	}
+	path, err := s.runsPath()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *LatencyService) writeRuns(runs []LatencyRun) error {
+	path, err := s.runsPath()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, run := range runs {
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *LatencyService) loadRuns() ([]LatencyRun, error) {
+	path, err := s.runsPath()
+	if err != nil {
+		return nil, err
+	}
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []LatencyRun{}, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	out := []LatencyRun{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRunLineBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var run LatencyRun
+		if err := json.Unmarshal(line, &run); err != nil {
+			continue
+		}
+		out = append(out, run)
+	}
+	return out, scanner.Err()
+}
+
+func (s *LatencyService) runsPath() (string, error) {
+	if s.store == nil {
+		return "", errors.New("storage not initialized")
+	}
+	dir := s.store.DataDir(s.store.CurrentProfile(), latencyDirName)
+	if dir == "" {
+		return "", errors.New("storage not initialized")
+	}
+	return filepath.Join(dir, runsFileName), nil
+}
@@ -26,19 +26,19 @@ const (
 
 	defaultParentReconnectSec = 3
 
-	keyHost         = "localhub.host"
-	keyPort         = "localhub.port"
-	keyNodeID       = "localhub.node_id"
-	keyParent       = "localhub.parent"
-	keyParentEnable = "localhub.parent_enable"
-	keyParentRetry  = "localhub.parent_reconnect"
+	KeyHost         = "localhub.host"
+	KeyPort         = "localhub.port"
+	KeyNodeID       = "localhub.node_id"
+	KeyParent       = "localhub.parent"
+	KeyParentEnable = "localhub.parent_enable"
+	KeyParentRetry  = "localhub.parent_reconnect"
 
-	keyAuthDefaultRole  = "localhub.auth.default_role"
-	keyAuthDefaultPerms = "localhub.auth.default_perms"
-	keyAuthNodeRoles    = "localhub.auth.node_roles"
-	keyAuthRolePerms    = "localhub.auth.role_perms"
+	KeyAuthDefaultRole  = "localhub.auth.default_role"
+	KeyAuthDefaultPerms = "localhub.auth.default_perms"
+	KeyAuthNodeRoles    = "localhub.auth.node_roles"
+	KeyAuthRolePerms    = "localhub.auth.role_perms"
 
-	keyExtraArgs = "localhub.extra_args"
+	KeyExtraArgs = "localhub.extra_args"
 
 	keyInstalledTag = "localhub.installed.tag"
 	keyInstalledAt  = "localhub.installed.at"
@@ -136,6 +136,14 @@ func (s *LocalHubService) SaveConfig(cfg Config) (Config, error) {
 	return out, nil
 }
 
+// ReloadConfig re-reads the settings after they were changed outside
+// SaveConfig. A running hub keeps its arguments until it is restarted.
+func (s *LocalHubService) ReloadConfig() {
+	s.mu.Lock()
+	s.loadConfigLocked()
+	s.mu.Unlock()
+}
+
 func (s *LocalHubService) RefreshLatest() (Release, error) {
 	if !isSupported() {
 		return Release{}, fmt.Errorf("unsupported platform: %s/%s", runtime.GOOS, runtime.GOARCH)
@@ -533,17 +541,17 @@ func (s *LocalHubService) loadConfigLocked() {
 		ExtraArgs:          "",
 	}
 	if s.store != nil {
-		cfg.Host = s.store.GetString("", keyHost, cfg.Host)
-		cfg.Port = s.store.GetInt("", keyPort, cfg.Port)
-		cfg.NodeID = s.store.GetInt("", keyNodeID, cfg.NodeID)
-		cfg.Parent = s.store.GetString("", keyParent, cfg.Parent)
-		cfg.ParentEnable = s.store.GetBool("", keyParentEnable, cfg.ParentEnable)
-		cfg.ParentReconnectSec = s.store.GetInt("", keyParentRetry, cfg.ParentReconnectSec)
-		cfg.AuthDefaultRole = s.store.GetString("", keyAuthDefaultRole, cfg.AuthDefaultRole)
-		cfg.AuthDefaultPerms = s.store.GetString("", keyAuthDefaultPerms, cfg.AuthDefaultPerms)
-		cfg.AuthNodeRoles = s.store.GetString("", keyAuthNodeRoles, cfg.AuthNodeRoles)
-		cfg.AuthRolePerms = s.store.GetString("", keyAuthRolePerms, cfg.AuthRolePerms)
-		cfg.ExtraArgs = s.store.GetString("", keyExtraArgs, cfg.ExtraArgs)
+		cfg.Host = s.store.GetString("", KeyHost, cfg.Host)
+		cfg.Port = s.store.GetInt("", KeyPort, cfg.Port)
+		cfg.NodeID = s.store.GetInt("", KeyNodeID, cfg.NodeID)
+		cfg.Parent = s.store.GetString("", KeyParent, cfg.Parent)
+		cfg.ParentEnable = s.store.GetBool("", KeyParentEnable, cfg.ParentEnable)
+		cfg.ParentReconnectSec = s.store.GetInt("", KeyParentRetry, cfg.ParentReconnectSec)
+		cfg.AuthDefaultRole = s.store.GetString("", KeyAuthDefaultRole, cfg.AuthDefaultRole)
+		cfg.AuthDefaultPerms = s.store.GetString("", KeyAuthDefaultPerms, cfg.AuthDefaultPerms)
+		cfg.AuthNodeRoles = s.store.GetString("", KeyAuthNodeRoles, cfg.AuthNodeRoles)
+		cfg.AuthRolePerms = s.store.GetString("", KeyAuthRolePerms, cfg.AuthRolePerms)
+		cfg.ExtraArgs = s.store.GetString("", KeyExtraArgs, cfg.ExtraArgs)
 	}
 
 	cfg.Host = strings.TrimSpace(cfg.Host)
@@ -581,37 +589,37 @@ func (s *LocalHubService) saveConfigLocked() error {
 	if s.store == nil {
 		return nil
 	}
-	if err := s.store.SetString("", keyHost, s.cfg.Host); err != nil {
+	if err := s.store.SetString("", KeyHost, s.cfg.Host); err != nil {
 		return err
 	}
-	if err := s.store.SetInt("", keyPort, s.cfg.Port); err != nil {
+	if err := s.store.SetInt("", KeyPort, s.cfg.Port); err != nil {
 		return err
 	}
-	if err := s.store.SetInt("", keyNodeID, s.cfg.NodeID); err != nil {
+	if err := s.store.SetInt("", KeyNodeID, s.cfg.NodeID); err != nil {
 		return err
 	}
-	if err := s.store.SetString("", keyParent, s.cfg.Parent); err != nil {
+	if err := s.store.SetString("", KeyParent, s.cfg.Parent); err != nil {
 		return err
 	}
-	if err := s.store.SetBool("", keyParentEnable, s.cfg.ParentEnable); err != nil {
+	if err := s.store.SetBool("", KeyParentEnable, s.cfg.ParentEnable); err != nil {
 		return err
 	}
-	if err := s.store.SetInt("", keyParentRetry, s.cfg.ParentReconnectSec); err != nil {
+	if err := s.store.SetInt("", KeyParentRetry, s.cfg.ParentReconnectSec); err != nil {
 		return err
 	}
-	if err := s.store.SetString("", keyAuthDefaultRole, s.cfg.AuthDefaultRole); err != nil {
+	if err := s.store.SetString("", KeyAuthDefaultRole, s.cfg.AuthDefaultRole); err != nil {
 		return err
 	}
-	if err := s.store.SetString("", keyAuthDefaultPerms, s.cfg.AuthDefaultPerms); err != nil {
+	if err := s.store.SetString("", KeyAuthDefaultPerms, s.cfg.AuthDefaultPerms); err != nil {
 		return err
 	}
-	if err := s.store.SetString("", keyAuthNodeRoles, s.cfg.AuthNodeRoles); err != nil {
+	if err := s.store.SetString("", KeyAuthNodeRoles, s.cfg.AuthNodeRoles); err != nil {
 		return err
 	}
-	if err := s.store.SetString("", keyAuthRolePerms, s.cfg.AuthRolePerms); err != nil {
+	if err := s.store.SetString("", KeyAuthRolePerms, s.cfg.AuthRolePerms); err != nil {
 		return err
 	}
-	if err := s.store.SetString("", keyExtraArgs, s.cfg.ExtraArgs); err != nil {
+	if err := s.store.SetString("", KeyExtraArgs, s.cfg.ExtraArgs); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,259 @@
+package management
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	filesvc "github.com/yttydcs/myflowhub-win/internal/services/file"
+	localhubsvc "github.com/yttydcs/myflowhub-win/internal/services/localhub"
+	recordersvc "github.com/yttydcs/myflowhub-win/internal/services/recorder"
+)
+
+const (
+	ConfigTypeString = "string"
+	ConfigTypeInt    = "int"
+	ConfigTypeBool   = "bool"
+
+	// Profile-scoped keys are stored per profile (prefixed with the profile
+	// name outside the default profile); global keys are shared.
+	ConfigScopeProfile = "profile"
+	ConfigScopeGlobal  = "global"
+)
+
+// ConfigKeySpec describes one config key that ConfigGet/ConfigSet understand.
+// Default is the value reported while the key is unset. Min/Max bound int
+// keys; Options, when set, is the full list of accepted string values.
+type ConfigKeySpec struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"`
+	Default     string   `json:"default"`
+	Scope       string   `json:"scope"`
+	Description string   `json:"description"`
+	Min         *int64   `json:"min,omitempty"`
+	Max         *int64   `json:"max,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	NotEmpty    bool     `json:"notEmpty,omitempty"`
+}
+
+func bound(v int64) *int64 { return &v }
+
+// configSchema mirrors the keys and defaults the services read. JSON-valued
+// keys (rules, jobs, prefs blobs) are left out on purpose: they have their
+// own editors and validation and cannot be set through ConfigSet.
+var configSchema = []ConfigKeySpec{
+	{Key: filesvc.CfgFileBaseDir, Type: ConfigTypeString, Default: "./file", Scope: ConfigScopeProfile, NotEmpty: true,
+		Description: "Directory shared and written by file transfers."},
+	{Key: filesvc.CfgFileMaxSizeBytes, Type: ConfigTypeInt, Default: "0", Scope: ConfigScopeProfile, Min: bound(0),
+		Description: "Largest accepted file in bytes; 0 means unlimited."},
+	{Key: filesvc.CfgFileMaxConcurrent, Type: ConfigTypeInt, Default: "4", Scope: ConfigScopeProfile, Min: bound(1), Max: bound(64),
+		Description: "Transfers running at the same time."},
+	{Key: filesvc.CfgFileChunkBytes, Type: ConfigTypeInt, Default: "262144", Scope: ConfigScopeProfile, Min: bound(1024), Max: bound(8 * 1024 * 1024),
+		Description: "Chunk size used when sending files."},
+	{Key: filesvc.CfgFileIncompleteTTLSec, Type: ConfigTypeInt, Default: "3600", Scope: ConfigScopeProfile, Min: bound(60), Max: bound(7 * 24 * 3600),
+		Description: "Seconds an unfinished incoming transfer is kept before cleanup."},
+	{Key: filesvc.CfgFileWantSHA256, Type: ConfigTypeBool, Default: "true", Scope: ConfigScopeProfile,
+		Description: "Verify received files against the sender's SHA-256."},
+	{Key: filesvc.CfgFileAutoAccept, Type: ConfigTypeBool, Default: "false", Scope: ConfigScopeProfile,
+		Description: "Accept incoming file offers without asking."},
+	{Key: recordersvc.CfgRecorderEnabled, Type: ConfigTypeBool, Default: "false", Scope: ConfigScopeProfile,
+		Description: "Record matching topic bus events to disk."},
+	{Key: recordersvc.CfgRecorderMaxFileBytes, Type: ConfigTypeInt, Default: "16777216", Scope: ConfigScopeProfile, Min: bound(64 * 1024),
+		Description: "Size at which the recorder rotates to a new file."},
+	{Key: recordersvc.CfgRecorderMaxFiles, Type: ConfigTypeInt, Default: "20", Scope: ConfigScopeProfile, Min: bound(1), Max: bound(1000),
+		Description: "Recording files kept before the oldest is deleted."},
+	{Key: localhubsvc.KeyHost, Type: ConfigTypeString, Default: "127.0.0.1", Scope: ConfigScopeGlobal, NotEmpty: true,
+		Description: "Address the local hub listens on."},
+	{Key: localhubsvc.KeyPort, Type: ConfigTypeInt, Default: "9000", Scope: ConfigScopeGlobal, Min: bound(1), Max: bound(65535),
+		Description: "Port the local hub listens on."},
+	{Key: localhubsvc.KeyNodeID, Type: ConfigTypeInt, Default: "1", Scope: ConfigScopeGlobal, Min: bound(1), Max: bound(4294967295),
+		Description: "Node ID of the local hub."},
+	{Key: localhubsvc.KeyParent, Type: ConfigTypeString, Default: "", Scope: ConfigScopeGlobal,
+		Description: "Parent hub address (host:port) the local hub connects to."},
+	{Key: localhubsvc.KeyParentEnable, Type: ConfigTypeBool, Default: "false", Scope: ConfigScopeGlobal,
+		Description: "Connect the local hub to its parent."},
+	{Key: localhubsvc.KeyParentRetry, Type: ConfigTypeInt, Default: "3", Scope: ConfigScopeGlobal, Min: bound(0), Max: bound(3600),
+		Description: "Seconds between parent reconnect attempts; 0 leaves the hub default."},
+	{Key: localhubsvc.KeyAuthDefaultRole, Type: ConfigTypeString, Default: "", Scope: ConfigScopeGlobal,
+		Description: "Role given to nodes without an explicit role."},
+	{Key: localhubsvc.KeyAuthDefaultPerms, Type: ConfigTypeString, Default: "", Scope: ConfigScopeGlobal,
+		Description: "Permissions of the default role."},
+	{Key: localhubsvc.KeyAuthNodeRoles, Type: ConfigTypeString, Default: "", Scope: ConfigScopeGlobal,
+		Description: "Node to role assignments passed to the local hub."},
+	{Key: localhubsvc.KeyAuthRolePerms, Type: ConfigTypeString, Default: "", Scope: ConfigScopeGlobal,
+		Description: "Role to permission assignments passed to the local hub."},
+	{Key: localhubsvc.KeyExtraArgs, Type: ConfigTypeString, Default: "", Scope: ConfigScopeGlobal,
+		Description: "Extra command line arguments for the local hub."},
+}
+
+// ConfigSchema lists the known config keys for UI editors.
+func (s *ManagementService) ConfigSchema() []ConfigKeySpec {
+	out := make([]ConfigKeySpec, len(configSchema))
+	copy(out, configSchema)
+	return out
+}
+
+func lookupConfigKey(key string) (ConfigKeySpec, bool) {
+	for _, spec := range configSchema {
+		if spec.Key == key {
+			return spec, true
+		}
+	}
+	return ConfigKeySpec{}, false
+}
+
+// normalizeConfigValue checks value against spec and returns the canonical
+// string form that is stored and echoed back.
+func normalizeConfigValue(spec ConfigKeySpec, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch spec.Type {
+	case ConfigTypeInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s must be an integer", spec.Key)
+		}
+		if spec.Min != nil && n < *spec.Min {
+			return "", fmt.Errorf("%s must be at least %d", spec.Key, *spec.Min)
+		}
+		if spec.Max != nil && n > *spec.Max {
+			return "", fmt.Errorf("%s must be at most %d", spec.Key, *spec.Max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case ConfigTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", spec.Key)
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		if spec.NotEmpty && value == "" {
+			return "", fmt.Errorf("%s must not be empty", spec.Key)
+		}
+		if len(spec.Options) > 0 {
+			for _, option := range spec.Options {
+				if option == value {
+					return value, nil
+				}
+			}
+			return "", fmt.Errorf("%s must be one of %s", spec.Key, strings.Join(spec.Options, ", "))
+		}
+		return value, nil
+	}
+}
+
+func (s *ManagementService) configProfile(spec ConfigKeySpec) string {
+	if spec.Scope == ConfigScopeGlobal {
+		return ""
+	}
+	return s.store.CurrentProfile()
+}
+
+// readConfig returns the value of key. Known keys are read typed from their
+// scope and fall back to their default; unknown keys are read raw.
+func (s *ManagementService) readConfig(key string) (string, int, error) {
+	if s.store == nil {
+		return "", 500, errors.New("config unavailable")
+	}
+	spec, ok := lookupConfigKey(key)
+	if !ok {
+		raw, found := s.store.GetRaw(key)
+		if !found {
+			return "", 404, errors.New("not found")
+		}
+		return formatConfigValue(raw), 1, nil
+	}
+	profile := s.configProfile(spec)
+	switch spec.Type {
+	case ConfigTypeInt:
+		def, _ := strconv.Atoi(spec.Default)
+		return strconv.Itoa(s.store.GetInt(profile, key, def)), 1, nil
+	case ConfigTypeBool:
+		def, _ := strconv.ParseBool(spec.Default)
+		return strconv.FormatBool(s.store.GetBool(profile, key, def)), 1, nil
+	default:
+		return s.store.GetString(profile, key, spec.Default), 1, nil
+	}
+}
+
+// writeConfig validates and stores value for a known key and returns the
+// stored form. Unknown keys are rejected so typos cannot land in settings.
+func (s *ManagementService) writeConfig(key, value string) (string, int, error) {
+	if s.store == nil {
+		return "", 500, errors.New("config unavailable")
+	}
+	spec, ok := lookupConfigKey(key)
+	if !ok {
+		return "", 404, errors.New("unknown config key")
+	}
+	normalized, err := normalizeConfigValue(spec, value)
+	if err != nil {
+		return "", 400, err
+	}
+	profile := s.configProfile(spec)
+	switch spec.Type {
+	case ConfigTypeInt:
+		n, _ := strconv.Atoi(normalized)
+		err = s.store.SetInt(profile, key, n)
+	case ConfigTypeBool:
+		b, _ := strconv.ParseBool(normalized)
+		err = s.store.SetBool(profile, key, b)
+	default:
+		err = s.store.SetString(profile, key, normalized)
+	}
+	if err != nil {
+		return "", 500, err
+	}
+	s.notifyConfigChanged(key)
+	return normalized, 1, nil
+}
+
+type configHook struct {
+	prefix string
+	fn     func()
+}
+
+// OnConfigChanged registers fn to run after ConfigSet stored a key starting
+// with prefix, so services that cache their settings pick up the new value
+// instead of overwriting it on their next save.
+func (s *ManagementService) OnConfigChanged(prefix string, fn func()) {
+	if fn == nil {
+		return
+	}
+	s.hookMu.Lock()
+	s.configHooks = append(s.configHooks, configHook{prefix: prefix, fn: fn})
+	s.hookMu.Unlock()
+}
+
+func (s *ManagementService) notifyConfigChanged(key string) {
+	s.hookMu.Lock()
+	hooks := append([]configHook(nil), s.configHooks...)
+	s.hookMu.Unlock()
+	for _, hook := range hooks {
+		if strings.HasPrefix(key, hook.prefix) {
+			hook.fn()
+		}
+	}
+}
+
+// configKeys lists the known keys plus every raw key in settings.json.
+func (s *ManagementService) configKeys() []string {
+	seen := make(map[string]struct{}, len(configSchema))
+	keys := make([]string, 0, len(configSchema))
+	for _, spec := range configSchema {
+		seen[spec.Key] = struct{}{}
+		keys = append(keys, spec.Key)
+	}
+	if s.store != nil {
+		for _, key := range s.store.Keys() {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,37 @@
+package management
+
+import "time"
+
+const EventManagementRemote = "management.remote"
+
+// RemoteGrant gives one requester access to the allowlisted config keys. Node
+// 0 matches every requester and a node's own grant takes precedence over it.
+// Write implies read.
+type RemoteGrant struct {
+	Node  uint32 `json:"node"`
+	Read  bool   `json:"read"`
+	Write bool   `json:"write"`
+}
+
+// RemotePrefs controls which management requests from other nodes this
+// client answers. node_echo and node_info are always answered; config
+// requests need Enabled, a matching grant and a key on the allowlist. Only
+// keys of the config schema can be allowed. Key patterns match exactly or,
+// with a trailing "*", by prefix.
+type RemotePrefs struct {
+	Enabled   bool          `json:"enabled"`
+	ReadKeys  []string      `json:"readKeys"`
+	WriteKeys []string      `json:"writeKeys"`
+	Grants    []RemoteGrant `json:"grants"`
+}
+
+// RemoteRequestRecord is one answered request, published on
+// EventManagementRemote.
+type RemoteRequestRecord struct {
+	Requester uint32    `json:"requester"`
+	Action    string    `json:"action"`
+	Key       string    `json:"key,omitempty"`
+	Code      int       `json:"code"`
+	Msg       string    `json:"msg,omitempty"`
+	At        time.Time `json:"at"`
+}
@@ -0,0 +1,213 @@
+package management
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-proto/protocol/management"
+	sdktransport "github.com/yttydcs/myflowhub-sdk/transport"
+	sessionsvc "github.com/yttydcs/myflowhub-win/internal/services/session"
+	"github.com/yttydcs/myflowhub-win/internal/services/transport"
+)
+
+var processStartedAt = time.Now()
+
+// InfoProvider contributes items to this node's NodeInfo. It is called for
+// every node_info answer and must be cheap and non-blocking.
+type InfoProvider func() map[string]string
+
+type infoProvider struct {
+	name     string
+	provider InfoProvider
+}
+
+type cpuSample struct {
+	at  time.Time
+	cpu time.Duration
+}
+
+type busToken struct {
+	name  string
+	token string
+}
+
+// RegisterInfoProvider adds or replaces a named NodeInfo contributor. Items
+// from providers never override the built-in process items.
+func (s *ManagementService) RegisterInfoProvider(name string, provider InfoProvider) {
+	name = strings.TrimSpace(name)
+	if name == "" || provider == nil {
+		return
+	}
+	s.infoMu.Lock()
+	defer s.infoMu.Unlock()
+	for i := range s.providers {
+		if s.providers[i].name == name {
+			s.providers[i].provider = provider
+			return
+		}
+	}
+	s.providers = append(s.providers, infoProvider{name: name, provider: provider})
+}
+
+// LocalNodeInfo returns the items this client reports for itself, both for
+// self-targeted NodeInfo calls and for node_info requests from other nodes.
+func (s *ManagementService) LocalNodeInfo(nodeID uint32) map[string]string {
+	items := collectNodeInfoItems(nodeID)
+	for key, value := range s.processInfoItems() {
+		items[key] = value
+	}
+
+	s.infoMu.Lock()
+	providers := append([]infoProvider(nil), s.providers...)
+	s.infoMu.Unlock()
+	sort.SliceStable(providers, func(i, j int) bool { return providers[i].name < providers[j].name })
+	for _, p := range providers {
+		for key, value := range safeProvide(p.provider) {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			if _, exists := items[key]; exists {
+				continue
+			}
+			items[key] = value
+		}
+	}
+	return items
+}
+
+func (s *ManagementService) processInfoItems() map[string]string {
+	now := time.Now()
+	items := map[string]string{
+		"pid":         strconv.Itoa(os.Getpid()),
+		"started_at":  processStartedAt.UTC().Format(time.RFC3339),
+		"uptime_sec":  strconv.FormatInt(int64(now.Sub(processStartedAt)/time.Second), 10),
+		"num_cpu":     strconv.Itoa(runtime.NumCPU()),
+		"goroutines":  strconv.Itoa(runtime.NumGoroutine()),
+		"os":          runtime.GOOS,
+		"arch":        runtime.GOARCH,
+		"go_maxprocs": strconv.Itoa(runtime.GOMAXPROCS(0)),
+	}
+	if host, err := os.Hostname(); err == nil {
+		items["hostname"] = host
+	}
+	if version := osVersion(); version != "" {
+		items["os_version"] = version
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	items["mem_heap_alloc_bytes"] = strconv.FormatUint(mem.HeapAlloc, 10)
+	items["mem_sys_bytes"] = strconv.FormatUint(mem.Sys, 10)
+	items["gc_count"] = strconv.FormatUint(uint64(mem.NumGC), 10)
+
+	if user, kernel, ok := processCPUTimes(); ok {
+		total := user + kernel
+		items["cpu_user_ms"] = strconv.FormatInt(user.Milliseconds(), 10)
+		items["cpu_kernel_ms"] = strconv.FormatInt(kernel.Milliseconds(), 10)
+		// CPU percent covers the time since the previous answer (or since
+		// start for the first one), normalized to all cores.
+		s.infoMu.Lock()
+		prev := s.lastCPU
+		s.lastCPU = cpuSample{at: now, cpu: total}
+		s.infoMu.Unlock()
+		if prev.at.IsZero() {
+			prev = cpuSample{at: processStartedAt}
+		}
+		if wall := now.Sub(prev.at); wall > 0 && total >= prev.cpu {
+			pct := float64(total-prev.cpu) / float64(wall) / float64(runtime.NumCPU()) * 100
+			items["cpu_percent"] = strconv.FormatFloat(pct, 'f', 1, 64)
+		}
+	}
+	return items
+}
+
+func safeProvide(provider InfoProvider) (items map[string]string) {
+	defer func() {
+		if recover() != nil {
+			items = nil
+		}
+	}()
+	return provider()
+}
+
+func (s *ManagementService) bindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	token := s.bus.Subscribe(sessionsvc.EventFrame, func(_ context.Context, evt eventbus.Event) {
+		frame, ok := evt.Data.(sessionsvc.FrameEvent)
+		if !ok || frame.SubProto != management.SubProtoManagement || frame.Major != header.MajorCmd {
+			return
+		}
+		s.handleFrame(frame)
+	})
+	if token != "" {
+		s.busTokens = append(s.busTokens, busToken{name: sessionsvc.EventFrame, token: token})
+	}
+}
+
+func (s *ManagementService) unbindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	for _, entry := range s.busTokens {
+		if entry.token == "" {
+			continue
+		}
+		s.bus.Unsubscribe(entry.name, entry.token)
+	}
+	s.busTokens = nil
+}
+
+// handleFrame answers management requests addressed to this client. Replies
+// to our own requests are consumed by the awaiter and ignored here.
+func (s *ManagementService) handleFrame(frame sessionsvc.FrameEvent) {
+	msg, err := sdktransport.DecodeMessage(frame.Payload)
+	if err != nil {
+		return
+	}
+	switch msg.Action {
+	case management.ActionNodeInfo:
+		go func() {
+			s.reply(frame, management.ActionNodeInfoResp, true, management.NodeInfoResp{Code: 1, Msg: "ok", Items: s.LocalNodeInfo(frame.TargetID)})
+		}()
+	case management.ActionNodeEcho:
+		go s.handleRemoteEcho(frame, msg.Data)
+	case management.ActionConfigGet:
+		go s.handleRemoteConfigGet(frame, msg.Data)
+	case management.ActionConfigSet:
+		go s.handleRemoteConfigSet(frame, msg.Data)
+	case management.ActionConfigList:
+		go s.handleRemoteConfigList(frame)
+	default:
+		return
+	}
+}
+
+// reply answers frame; ok=false sends the payload as an error response.
+func (s *ManagementService) reply(frame sessionsvc.FrameEvent, action string, ok bool, data any) {
+	if s.session == nil {
+		return
+	}
+	payload, err := transport.EncodeMessage(action, data)
+	if err != nil {
+		return
+	}
+	if err := s.session.SendResponse(frame, ok, payload); err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "management %s to %d failed: %v", action, frame.SourceID, err)
+		}
+		return
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "management %s answered for %d", action, frame.SourceID)
+	}
+}
@@ -0,0 +1,270 @@
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/management"
+	sessionsvc "github.com/yttydcs/myflowhub-win/internal/services/session"
+)
+
+const cfgRemotePrefs = "management.remote"
+
+func (s *ManagementService) RemotePrefs() (RemotePrefs, error) {
+	return s.loadRemotePrefs(), nil
+}
+
+func (s *ManagementService) SaveRemotePrefs(prefs RemotePrefs) (RemotePrefs, error) {
+	if s.store == nil {
+		return RemotePrefs{}, errors.New("storage not initialized")
+	}
+	normalized, err := normalizeRemotePrefs(prefs)
+	if err != nil {
+		return RemotePrefs{}, err
+	}
+	raw, err := json.Marshal(normalized)
+	if err != nil {
+		return RemotePrefs{}, err
+	}
+	if err := s.store.SetString(s.store.CurrentProfile(), cfgRemotePrefs, string(raw)); err != nil {
+		return RemotePrefs{}, err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "management remote access enabled=%t read=%d write=%d grants=%d",
+			normalized.Enabled, len(normalized.ReadKeys), len(normalized.WriteKeys), len(normalized.Grants))
+	}
+	return normalized, nil
+}
+
+func (s *ManagementService) handleRemoteEcho(frame sessionsvc.FrameEvent, raw json.RawMessage) {
+	var req management.NodeEchoReq
+	if err := json.Unmarshal(raw, &req); err != nil {
+		s.answerRemote(frame, management.ActionNodeEchoResp, "", management.NodeEchoResp{Code: 400, Msg: "invalid echo"})
+		return
+	}
+	s.answerRemote(frame, management.ActionNodeEchoResp, "", management.NodeEchoResp{Code: 1, Msg: "ok", Echo: req.Message})
+}
+
+func (s *ManagementService) handleRemoteConfigGet(frame sessionsvc.FrameEvent, raw json.RawMessage) {
+	var req management.ConfigGetReq
+	if err := json.Unmarshal(raw, &req); err != nil {
+		s.answerRemote(frame, management.ActionConfigGetResp, "", management.ConfigResp{Code: 400, Msg: "invalid config_get"})
+		return
+	}
+	key := strings.TrimSpace(req.Key)
+	if code, msg := s.checkRemote(frame.SourceID, key, false); code != 1 {
+		s.answerRemote(frame, management.ActionConfigGetResp, key, management.ConfigResp{Code: code, Msg: msg, Key: key})
+		return
+	}
+	value, code, err := s.readConfig(key)
+	if err != nil {
+		s.answerRemote(frame, management.ActionConfigGetResp, key, management.ConfigResp{Code: code, Msg: err.Error(), Key: key})
+		return
+	}
+	s.answerRemote(frame, management.ActionConfigGetResp, key, management.ConfigResp{Code: 1, Msg: "ok", Key: key, Value: value})
+}
+
+func (s *ManagementService) handleRemoteConfigSet(frame sessionsvc.FrameEvent, raw json.RawMessage) {
+	var req management.ConfigSetReq
+	if err := json.Unmarshal(raw, &req); err != nil {
+		s.answerRemote(frame, management.ActionConfigSetResp, "", management.ConfigResp{Code: 400, Msg: "invalid config_set"})
+		return
+	}
+	key := strings.TrimSpace(req.Key)
+	if code, msg := s.checkRemote(frame.SourceID, key, true); code != 1 {
+		s.answerRemote(frame, management.ActionConfigSetResp, key, management.ConfigResp{Code: code, Msg: msg, Key: key})
+		return
+	}
+	stored, code, err := s.writeConfig(key, req.Value)
+	if err != nil {
+		s.answerRemote(frame, management.ActionConfigSetResp, key, management.ConfigResp{Code: code, Msg: err.Error(), Key: key})
+		return
+	}
+	s.answerRemote(frame, management.ActionConfigSetResp, key, management.ConfigResp{Code: 1, Msg: "ok", Key: key, Value: stored})
+}
+
+func (s *ManagementService) handleRemoteConfigList(frame sessionsvc.FrameEvent) {
+	if code, msg := s.checkRemote(frame.SourceID, "", false); code != 1 {
+		s.answerRemote(frame, management.ActionConfigListResp, "", management.ConfigListResp{Code: code, Msg: msg})
+		return
+	}
+	prefs := s.loadRemotePrefs()
+	keys := []string{}
+	for _, spec := range configSchema {
+		if s.remoteKeyAllowed(prefs, spec.Key, false) {
+			keys = append(keys, spec.Key)
+		}
+	}
+	sort.Strings(keys)
+	s.answerRemote(frame, management.ActionConfigListResp, "", management.ConfigListResp{Code: 1, Msg: "ok", Keys: keys})
+}
+
+// checkRemote reports whether requester may read (or write) key. An empty key
+// only checks the requester, as config_list filters keys itself.
+func (s *ManagementService) checkRemote(requester uint32, key string, write bool) (int, string) {
+	if s.store == nil {
+		return 500, "config unavailable"
+	}
+	prefs := s.loadRemotePrefs()
+	if !prefs.Enabled {
+		return 403, "remote config disabled"
+	}
+	if !grantAllows(prefs.Grants, requester, write) {
+		return 403, "permission denied"
+	}
+	if write && key == "" {
+		return 400, "key is required"
+	}
+	if key != "" && !s.remoteKeyAllowed(prefs, key, write) {
+		return 403, "key not allowed"
+	}
+	return 1, "ok"
+}
+
+// remoteKeyAllowed matches key against the allowlists. Only keys in the
+// config schema are ever exposed, whatever the patterns say: raw keys include
+// prefs blobs such as the exec allowlist or bridge credentials, and other
+// profiles' settings.
+func (s *ManagementService) remoteKeyAllowed(prefs RemotePrefs, key string, write bool) bool {
+	if _, ok := lookupConfigKey(key); !ok {
+		return false
+	}
+	if matchKeyPatterns(prefs.WriteKeys, key) {
+		return true
+	}
+	return !write && matchKeyPatterns(prefs.ReadKeys, key)
+}
+
+func (s *ManagementService) answerRemote(frame sessionsvc.FrameEvent, action, key string, data any) {
+	code, msg := 0, ""
+	switch t := data.(type) {
+	case management.NodeEchoResp:
+		code, msg = t.Code, t.Msg
+	case management.ConfigResp:
+		code, msg = t.Code, t.Msg
+	case management.ConfigListResp:
+		code, msg = t.Code, t.Msg
+	}
+	s.reply(frame, action, code == 1, data)
+	if code != 1 && s.logs != nil {
+		s.logs.Appendf("warn", "management %s from %d rejected (code=%d msg=%q)", strings.TrimSuffix(action, "_resp"), frame.SourceID, code, msg)
+	}
+	if s.bus != nil {
+		rec := RemoteRequestRecord{
+			Requester: frame.SourceID,
+			Action:    strings.TrimSuffix(action, "_resp"),
+			Key:       key,
+			Code:      code,
+			At:        time.Now(),
+		}
+		if code != 1 {
+			rec.Msg = msg
+		}
+		_ = s.bus.Publish(context.Background(), EventManagementRemote, rec, nil)
+	}
+}
+
+func (s *ManagementService) loadRemotePrefs() RemotePrefs {
+	prefs := RemotePrefs{}
+	if s != nil && s.store != nil {
+		raw := strings.TrimSpace(s.store.GetString(s.store.CurrentProfile(), cfgRemotePrefs, ""))
+		if raw != "" {
+			_ = json.Unmarshal([]byte(raw), &prefs)
+		}
+	}
+	normalized, err := normalizeRemotePrefs(prefs)
+	if err != nil {
+		// An allowlist that no longer validates must not widen access.
+		normalized.Enabled = false
+	}
+	return normalized
+}
+
+func normalizeRemotePrefs(prefs RemotePrefs) (RemotePrefs, error) {
+	out := RemotePrefs{Enabled: prefs.Enabled}
+	var err error
+	if out.ReadKeys, err = normalizeKeyPatterns(prefs.ReadKeys); err != nil {
+		return out, err
+	}
+	if out.WriteKeys, err = normalizeKeyPatterns(prefs.WriteKeys); err != nil {
+		return out, err
+	}
+	byNode := make(map[uint32]int, len(prefs.Grants))
+	out.Grants = []RemoteGrant{}
+	for _, grant := range prefs.Grants {
+		if grant.Write {
+			grant.Read = true
+		}
+		if idx, ok := byNode[grant.Node]; ok {
+			out.Grants[idx].Write = out.Grants[idx].Write || grant.Write
+			continue
+		}
+		byNode[grant.Node] = len(out.Grants)
+		out.Grants = append(out.Grants, grant)
+	}
+	sort.Slice(out.Grants, func(i, j int) bool { return out.Grants[i].Node < out.Grants[j].Node })
+	return out, nil
+}
+
+func normalizeKeyPatterns(patterns []string) ([]string, error) {
+	out := []string{}
+	seen := make(map[string]struct{}, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if idx := strings.Index(pattern, "*"); idx >= 0 && idx != len(pattern)-1 {
+			return nil, errors.New("key pattern " + pattern + ": \"*\" is only allowed at the end")
+		}
+		if _, ok := seen[pattern]; ok {
+			continue
+		}
+		seen[pattern] = struct{}{}
+		out = append(out, pattern)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func matchKeyPatterns(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+			continue
+		}
+		if pattern == key {
+			return true
+		}
+	}
+	return false
+}
+
+// grantAllows picks the requester's own grant over the catch-all one, so a
+// node can be given less than everyone else (a grant with neither flag set
+// denies it).
+func grantAllows(grants []RemoteGrant, requester uint32, write bool) bool {
+	var match *RemoteGrant
+	for i := range grants {
+		if grants[i].Node == requester {
+			match = &grants[i]
+			break
+		}
+		if grants[i].Node == 0 && match == nil {
+			match = &grants[i]
+		}
+	}
+	if match == nil {
+		return false
+	}
+	if write {
+		return match.Write
+	}
+	return match.Read
+}
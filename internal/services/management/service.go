@@ -10,8 +10,10 @@ import (
 	"runtime"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/yttydcs/myflowhub-core/eventbus"
 	"github.com/yttydcs/myflowhub-proto/protocol/management"
 	"github.com/yttydcs/myflowhub-win/internal/services/logs"
 	sessionsvc "github.com/yttydcs/myflowhub-win/internal/services/session"
@@ -25,10 +27,26 @@ type ManagementService struct {
 	session *sessionsvc.SessionService
 	logs    *logs.LogService
 	store   *storagesvc.Store
+	bus     eventbus.IBus
+
+	busTokens []busToken
+
+	infoMu    sync.Mutex
+	providers []infoProvider
+	lastCPU   cpuSample
+
+	hookMu      sync.Mutex
+	configHooks []configHook
+}
+
+func New(session *sessionsvc.SessionService, logsSvc *logs.LogService, store *storagesvc.Store, bus eventbus.IBus) *ManagementService {
+	svc := &ManagementService{session: session, logs: logsSvc, store: store, bus: bus}
+	svc.bindBus()
+	return svc
 }
 
-func New(session *sessionsvc.SessionService, logsSvc *logs.LogService, store *storagesvc.Store) *ManagementService {
-	return &ManagementService{session: session, logs: logsSvc, store: store}
+func (s *ManagementService) Close() {
+	s.unbindBus()
 }
 
 func (s *ManagementService) NodeEcho(ctx context.Context, sourceID, targetID uint32, message string) (management.NodeEchoResp, error) {
@@ -55,7 +73,7 @@ func (s *ManagementService) NodeEchoSimple(sourceID, targetID uint32, message st
 
 func (s *ManagementService) NodeInfo(ctx context.Context, sourceID, targetID uint32) (management.NodeInfoResp, error) {
 	if sourceID != 0 && sourceID == targetID {
-		return management.NodeInfoResp{Code: 1, Msg: "ok", Items: collectNodeInfoItems(sourceID)}, nil
+		return management.NodeInfoResp{Code: 1, Msg: "ok", Items: s.LocalNodeInfo(sourceID)}, nil
 	}
 	payload, err := transport.EncodeMessage(management.ActionNodeInfo, management.NodeInfoReq{})
 	if err != nil {
@@ -122,14 +140,11 @@ func (s *ManagementService) ConfigGet(ctx context.Context, sourceID, targetID ui
 		return management.ConfigResp{}, errors.New("key is required")
 	}
 	if sourceID != 0 && sourceID == targetID {
-		if s.store == nil {
-			return management.ConfigResp{}, errors.New("config unavailable (code=500)")
-		}
-		raw, ok := s.store.GetRaw(key)
-		if !ok {
-			return management.ConfigResp{}, errors.New("not found (code=404)")
+		value, code, err := s.readConfig(key)
+		if err != nil {
+			return management.ConfigResp{}, &respError{code: code, msg: err.Error()}
 		}
-		return management.ConfigResp{Code: 1, Msg: "ok", Key: key, Value: formatConfigValue(raw)}, nil
+		return management.ConfigResp{Code: 1, Msg: "ok", Key: key, Value: value}, nil
 	}
 	payload, err := transport.EncodeMessage(management.ActionConfigGet, management.ConfigGetReq{Key: key})
 	if err != nil {
@@ -154,13 +169,11 @@ func (s *ManagementService) ConfigSet(ctx context.Context, sourceID, targetID ui
 		return management.ConfigResp{}, errors.New("key is required")
 	}
 	if sourceID != 0 && sourceID == targetID {
-		if s.store == nil {
-			return management.ConfigResp{}, errors.New("config unavailable (code=500)")
+		stored, code, err := s.writeConfig(key, value)
+		if err != nil {
+			return management.ConfigResp{}, &respError{code: code, msg: err.Error()}
 		}
-		if err := s.store.SetRaw(key, value); err != nil {
-			return management.ConfigResp{}, err
-		}
-		return management.ConfigResp{Code: 1, Msg: "ok", Key: key, Value: value}, nil
+		return management.ConfigResp{Code: 1, Msg: "ok", Key: key, Value: stored}, nil
 	}
 	payload, err := transport.EncodeMessage(management.ActionConfigSet, management.ConfigSetReq{Key: key, Value: value})
 	if err != nil {
@@ -182,9 +195,9 @@ func (s *ManagementService) ConfigSetSimple(sourceID, targetID uint32, key, valu
 func (s *ManagementService) ConfigList(ctx context.Context, sourceID, targetID uint32) (management.ConfigListResp, error) {
 	if sourceID != 0 && sourceID == targetID {
 		if s.store == nil {
-			return management.ConfigListResp{}, errors.New("config unavailable (code=500)")
+			return management.ConfigListResp{}, &respError{code: 500, msg: "config unavailable"}
 		}
-		return management.ConfigListResp{Code: 1, Msg: "ok", Keys: s.store.Keys()}, nil
+		return management.ConfigListResp{Code: 1, Msg: "ok", Keys: s.configKeys()}, nil
 	}
 	payload, err := transport.EncodeMessage(management.ActionConfigList, management.ConfigListReq{})
 	if err != nil {
@@ -251,12 +264,12 @@ func (s *ManagementService) sendAndAwait(ctx context.Context, sourceID, targetID
 			if s.logs != nil {
 				s.logs.Appendf("warn", "management %s failed (code=%d msg=%q)", strings.TrimSpace(reqAction), code, msg)
 			}
-			return fmt.Errorf("%s (code=%d)", msg, code)
+			return &respError{code: code, msg: msg}
 		}
 		if s.logs != nil {
 			s.logs.Appendf("warn", "management %s failed (code=%d)", strings.TrimSpace(reqAction), code)
 		}
-		return fmt.Errorf("management %s failed (code=%d)", strings.TrimSpace(reqAction), code)
+		return &respError{code: code, msg: fmt.Sprintf("management %s failed", strings.TrimSpace(reqAction))}
 	}
 	if s.logs != nil {
 		s.logs.Appendf("info", "management %s ok", strings.TrimSpace(reqAction))
@@ -264,6 +277,24 @@ func (s *ManagementService) sendAndAwait(ctx context.Context, sourceID, targetID
 	return nil
 }
 
+// respError is a non-ok reply from the target node (or the local config
+// store), kept typed so callers can tell its code apart from transport failures.
+type respError struct {
+	code int
+	msg  string
+}
+
+func (e *respError) Error() string {
+	return fmt.Sprintf("%s (code=%d)", e.msg, e.code)
+}
+
+// IsNotFound reports whether err is a reply with code 404, e.g. a missing
+// config key.
+func IsNotFound(err error) bool {
+	var re *respError
+	return errors.As(err, &re) && re.code == 404
+}
+
 func toUIError(err error) error {
 	if err == nil {
 		return nil
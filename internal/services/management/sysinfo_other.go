@@ -0,0 +1,21 @@
+//go:build !windows
+
+package management
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+func osVersion() string {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func processCPUTimes() (user, kernel time.Duration, ok bool) {
+	return 0, 0, false
+}
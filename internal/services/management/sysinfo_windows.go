@@ -0,0 +1,34 @@
+package management
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+func osVersion() string {
+	v, err := syscall.GetVersion()
+	if err != nil {
+		return ""
+	}
+	major := byte(v)
+	minor := uint8(v >> 8)
+	build := uint16(v >> 16)
+	return fmt.Sprintf("Windows %d.%d.%d", major, minor, build)
+}
+
+func processCPUTimes() (user, kernel time.Duration, ok bool) {
+	handle, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, 0, false
+	}
+	var creation, exit, kernelTime, userTime syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernelTime, &userTime); err != nil {
+		return 0, 0, false
+	}
+	// Filetime durations are in 100ns units.
+	toDuration := func(ft syscall.Filetime) time.Duration {
+		return time.Duration(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) * 100
+	}
+	return toDuration(userTime), toDuration(kernelTime), true
+}
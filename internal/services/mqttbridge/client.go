@@ -0,0 +1,403 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	connectTimeout = 10 * time.Second
+	ackTimeout     = 10 * time.Second
+)
+
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// mqttClient is a minimal MQTT 3.1.1 client: QoS 0-2 publish and subscribe,
+// keepalive pings and no offline queue. A dropped connection is final; the
+// service dials a new client to reconnect.
+type mqttClient struct {
+	conn      net.Conn
+	keepAlive time.Duration
+	onMessage func(mqttMessage)
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	nextID    uint16
+	inflight  map[uint16]chan packet
+	received  map[uint16]bool
+	lastRecv  time.Time
+	lastWrite time.Time
+	err       error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// parseBroker accepts tcp://, mqtt://, ssl://, tls:// and mqtts:// URLs, or a
+// bare host[:port].
+func parseBroker(broker string) (addr string, useTLS bool, host string, err error) {
+	broker = strings.TrimSpace(broker)
+	if broker == "" {
+		return "", false, "", errors.New("broker address is required")
+	}
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", false, "", fmt.Errorf("invalid broker address: %w", err)
+	}
+	port := "1883"
+	switch strings.ToLower(u.Scheme) {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS = true
+		port = "8883"
+	default:
+		return "", false, "", fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", false, "", errors.New("broker host is required")
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, u.Hostname(), nil
+}
+
+func dialMQTT(ctx context.Context, broker string, opts connectOptions, onMessage func(mqttMessage)) (*mqttClient, error) {
+	addr, useTLS, host, err := parseBroker(broker)
+	if err != nil {
+		return nil, err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(dialCtx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	connect, err := encodeConnect(opts)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	deadline := time.Now().Add(connectTimeout)
+	if dl, ok := dialCtx.Deadline(); ok {
+		deadline = dl
+	}
+	_ = conn.SetDeadline(deadline)
+	reader := bufio.NewReader(conn)
+	if _, err := conn.Write(connect); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	ack, err := readPacket(reader)
+	if err == nil {
+		err = connackError(ack)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	now := time.Now()
+	c := &mqttClient{
+		conn:      conn,
+		keepAlive: time.Duration(opts.keepAliveSec) * time.Second,
+		onMessage: onMessage,
+		inflight:  make(map[uint16]chan packet),
+		received:  make(map[uint16]bool),
+		lastRecv:  now,
+		lastWrite: now,
+		done:      make(chan struct{}),
+	}
+	go c.readLoop(reader)
+	if c.keepAlive > 0 {
+		go c.keepAliveLoop()
+	}
+	return c, nil
+}
+
+func (c *mqttClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *mqttClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close sends DISCONNECT and closes the connection.
+func (c *mqttClient) Close() {
+	if pkt, err := encodePacket(pktDisconnect, 0, nil); err == nil {
+		_ = c.write(pkt)
+	}
+	c.fail(errors.New("connection closed"))
+}
+
+func (c *mqttClient) Subscribe(ctx context.Context, topic string, qos byte) error {
+	id, ch := c.reserveID()
+	defer c.releaseID(id)
+	pkt, err := encodeSubscribe(id, topic, qos)
+	if err != nil {
+		return err
+	}
+	if err := c.write(pkt); err != nil {
+		return err
+	}
+	ack, err := c.await(ctx, ch, pktSuback)
+	if err != nil {
+		return err
+	}
+	if len(ack.body) < 3 || ack.body[2] == 0x80 {
+		return fmt.Errorf("broker rejected subscription %s", topic)
+	}
+	return nil
+}
+
+func (c *mqttClient) Unsubscribe(ctx context.Context, topic string) error {
+	id, ch := c.reserveID()
+	defer c.releaseID(id)
+	pkt, err := encodeUnsubscribe(id, topic)
+	if err != nil {
+		return err
+	}
+	if err := c.write(pkt); err != nil {
+		return err
+	}
+	_, err = c.await(ctx, ch, pktUnsuback)
+	return err
+}
+
+// Publish sends msg and, for QoS 1 and 2, waits for the broker's
+// acknowledgement flow to complete.
+func (c *mqttClient) Publish(ctx context.Context, msg mqttMessage) error {
+	if msg.QoS == 0 {
+		pkt, err := encodePublish(msg, 0, false)
+		if err != nil {
+			return err
+		}
+		return c.write(pkt)
+	}
+	id, ch := c.reserveID()
+	defer c.releaseID(id)
+	pkt, err := encodePublish(msg, id, false)
+	if err != nil {
+		return err
+	}
+	if err := c.write(pkt); err != nil {
+		return err
+	}
+	if msg.QoS == 1 {
+		_, err := c.await(ctx, ch, pktPuback)
+		return err
+	}
+	if _, err := c.await(ctx, ch, pktPubrec); err != nil {
+		return err
+	}
+	rel, err := encodeAck(pktPubrel, id)
+	if err != nil {
+		return err
+	}
+	if err := c.write(rel); err != nil {
+		return err
+	}
+	_, err = c.await(ctx, ch, pktPubcomp)
+	return err
+}
+
+func (c *mqttClient) reserveID() (uint16, chan packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.nextID++
+		if c.nextID == 0 {
+			continue
+		}
+		if _, busy := c.inflight[c.nextID]; !busy {
+			break
+		}
+	}
+	ch := make(chan packet, 2)
+	c.inflight[c.nextID] = ch
+	return c.nextID, ch
+}
+
+func (c *mqttClient) releaseID(id uint16) {
+	c.mu.Lock()
+	delete(c.inflight, id)
+	c.mu.Unlock()
+}
+
+func (c *mqttClient) await(ctx context.Context, ch chan packet, want byte) (packet, error) {
+	timer := time.NewTimer(ackTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return packet{}, ctx.Err()
+		case <-c.done:
+			return packet{}, c.Err()
+		case <-timer.C:
+			return packet{}, errors.New("mqtt acknowledgement timed out")
+		case p := <-ch:
+			if p.typ == want {
+				return p, nil
+			}
+		}
+	}
+}
+
+func (c *mqttClient) write(pkt []byte) error {
+	select {
+	case <-c.done:
+		return c.Err()
+	default:
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(ackTimeout))
+	if _, err := c.conn.Write(pkt); err != nil {
+		c.fail(err)
+		return err
+	}
+	c.mu.Lock()
+	c.lastWrite = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *mqttClient) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		_ = c.conn.Close()
+		close(c.done)
+	})
+}
+
+func (c *mqttClient) readLoop(r *bufio.Reader) {
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.mu.Lock()
+		c.lastRecv = time.Now()
+		c.mu.Unlock()
+		switch p.typ {
+		case pktPublish:
+			c.handlePublish(p)
+		case pktPubrel:
+			id, ok := packetID(p)
+			if !ok {
+				continue
+			}
+			c.mu.Lock()
+			delete(c.received, id)
+			c.mu.Unlock()
+			if ack, err := encodeAck(pktPubcomp, id); err == nil {
+				_ = c.write(ack)
+			}
+		case pktPuback, pktPubrec, pktPubcomp, pktSuback, pktUnsuback:
+			id, ok := packetID(p)
+			if !ok {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.inflight[id]
+			c.mu.Unlock()
+			if ch != nil {
+				select {
+				case ch <- p:
+				default:
+				}
+			}
+		case pktPingresp:
+		default:
+			c.fail(fmt.Errorf("mqtt: unexpected packet type %d", p.typ))
+			return
+		}
+	}
+}
+
+func (c *mqttClient) handlePublish(p packet) {
+	msg, id, err := decodePublish(p)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	switch msg.QoS {
+	case 1:
+		if ack, err := encodeAck(pktPuback, id); err == nil {
+			_ = c.write(ack)
+		}
+	case 2:
+		// Deliver once per packet id until the broker releases it.
+		c.mu.Lock()
+		dup := c.received[id]
+		c.received[id] = true
+		c.mu.Unlock()
+		if ack, err := encodeAck(pktPubrec, id); err == nil {
+			_ = c.write(ack)
+		}
+		if dup {
+			return
+		}
+	}
+	if c.onMessage != nil {
+		c.onMessage(msg)
+	}
+}
+
+func (c *mqttClient) keepAliveLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	ping, _ := encodePacket(pktPingreq, 0, nil)
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		sinceRecv := time.Since(c.lastRecv)
+		sinceWrite := time.Since(c.lastWrite)
+		c.mu.Unlock()
+		if sinceRecv > c.keepAlive*3/2 {
+			c.fail(errors.New("mqtt keepalive timed out"))
+			return
+		}
+		if sinceWrite >= c.keepAlive/2 || sinceRecv >= c.keepAlive/2 {
+			_ = c.write(ping)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package mqttbridge
+
+import "time"
+
+const EventMQTTBridgeStatus = "mqttbridge.status"
+
+const (
+	DirectionMQTTToTopic = "mqtt_to_topic"
+	DirectionTopicToMQTT = "topic_to_mqtt"
+
+	StateStopped      = "stopped"
+	StateConnecting   = "connecting"
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+)
+
+// Config is the per-profile MQTT bridge setup. The password is not part of the
+// profile settings: it is encrypted with DPAPI for the current Windows user and
+// kept in the profile data directory. Config returns it blank with HasPassword
+// set; saving a blank Password keeps the stored one unless HasPassword is
+// false.
+type Config struct {
+	Enabled      bool      `json:"enabled"`
+	Broker       string    `json:"broker"`
+	ClientID     string    `json:"clientId"`
+	Username     string    `json:"username"`
+	Password     string    `json:"password,omitempty"`
+	HasPassword  bool      `json:"hasPassword"`
+	KeepAliveSec int       `json:"keepAliveSec"`
+	CleanSession bool      `json:"cleanSession"`
+	SourceID     uint32    `json:"sourceId"`
+	TargetID     uint32    `json:"targetId"`
+	Rules        []MapRule `json:"rules"`
+}
+
+// MapRule forwards messages whose topic matches From (MQTT wildcards allowed)
+// to the other side. To rewrites the topic: {topic} is the full source topic
+// and {1}, {2}... are the levels matched by the wildcards in order; an empty
+// To keeps the topic unchanged.
+//
+// QoS and Retain apply to the MQTT side: the subscription QoS for
+// mqtt_to_topic and the publish QoS/retain flag for topic_to_mqtt. Name is the
+// TopicBus publish name for mqtt_to_topic.
+type MapRule struct {
+	Direction string `json:"direction"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	QoS       int    `json:"qos"`
+	Retain    bool   `json:"retain"`
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type DirectionCounters struct {
+	Received  int       `json:"received"`
+	Forwarded int       `json:"forwarded"`
+	Dropped   int       `json:"dropped"`
+	Looped    int       `json:"looped"`
+	Errors    int       `json:"errors"`
+	Retained  int       `json:"retained"`
+	Bytes     int64     `json:"bytes"`
+	LastAt    time.Time `json:"lastAt"`
+}
+
+type Status struct {
+	State       string            `json:"state"`
+	Broker      string            `json:"broker"`
+	LastError   string            `json:"lastError,omitempty"`
+	Reconnects  int               `json:"reconnects"`
+	ConnectedAt time.Time         `json:"connectedAt"`
+	MQTTToTopic DirectionCounters `json:"mqttToTopic"`
+	TopicToMQTT DirectionCounters `json:"topicToMqtt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
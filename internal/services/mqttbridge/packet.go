@@ -0,0 +1,225 @@
+package mqttbridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	pktConnect     = 1
+	pktConnack     = 2
+	pktPublish     = 3
+	pktPuback      = 4
+	pktPubrec      = 5
+	pktPubrel      = 6
+	pktPubcomp     = 7
+	pktSubscribe   = 8
+	pktSuback      = 9
+	pktUnsubscribe = 10
+	pktUnsuback    = 11
+	pktPingreq     = 12
+	pktPingresp    = 13
+	pktDisconnect  = 14
+
+	maxRemainingLength = 268435455
+	// Incoming packets larger than this are treated as a protocol error.
+	maxPacketSize = 16 * 1024 * 1024
+)
+
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	var length, shift int
+	for i := 0; ; i++ {
+		if i == 4 {
+			return packet{}, errors.New("mqtt: malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	if length > maxPacketSize {
+		return packet{}, fmt.Errorf("mqtt: packet of %d bytes exceeds limit", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{typ: first >> 4, flags: first & 0x0f, body: body}, nil
+}
+
+func encodePacket(typ, flags byte, body []byte) ([]byte, error) {
+	if len(body) > maxRemainingLength {
+		return nil, errors.New("mqtt: packet too large")
+	}
+	out := make([]byte, 0, len(body)+5)
+	out = append(out, typ<<4|flags&0x0f)
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...), nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+func readString(body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	return string(body[2 : 2+n]), body[2+n:], nil
+}
+
+type connectOptions struct {
+	clientID     string
+	username     string
+	password     string
+	keepAliveSec int
+	cleanSession bool
+}
+
+func encodeConnect(opts connectOptions) ([]byte, error) {
+	var flags byte
+	if opts.cleanSession {
+		flags |= 0x02
+	}
+	if opts.username != "" {
+		flags |= 0x80
+		if opts.password != "" {
+			flags |= 0x40
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.keepAliveSec))
+	body = appendString(body, opts.clientID)
+	if opts.username != "" {
+		body = appendString(body, opts.username)
+		if opts.password != "" {
+			body = appendString(body, opts.password)
+		}
+	}
+	return encodePacket(pktConnect, 0, body)
+}
+
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+func connackError(p packet) error {
+	if p.typ != pktConnack || len(p.body) < 2 {
+		return errors.New("mqtt: expected CONNACK")
+	}
+	code := p.body[1]
+	if code == 0 {
+		return nil
+	}
+	if msg, ok := connackErrors[code]; ok {
+		return fmt.Errorf("mqtt connect refused: %s (code=%d)", msg, code)
+	}
+	return fmt.Errorf("mqtt connect refused (code=%d)", code)
+}
+
+func encodePublish(msg mqttMessage, id uint16, dup bool) ([]byte, error) {
+	flags := msg.QoS << 1
+	if msg.Retain {
+		flags |= 0x01
+	}
+	if dup {
+		flags |= 0x08
+	}
+	body := appendString(nil, msg.Topic)
+	if msg.QoS > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, msg.Payload...)
+	return encodePacket(pktPublish, flags, body)
+}
+
+func decodePublish(p packet) (mqttMessage, uint16, error) {
+	msg := mqttMessage{QoS: (p.flags >> 1) & 0x03, Retain: p.flags&0x01 != 0}
+	if msg.QoS > 2 {
+		return mqttMessage{}, 0, errors.New("mqtt: invalid QoS")
+	}
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return mqttMessage{}, 0, err
+	}
+	msg.Topic = topic
+	var id uint16
+	if msg.QoS > 0 {
+		if len(rest) < 2 {
+			return mqttMessage{}, 0, errors.New("mqtt: truncated publish")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	msg.Payload = append([]byte(nil), rest...)
+	return msg, id, nil
+}
+
+func encodeSubscribe(id uint16, topic string, qos byte) ([]byte, error) {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, topic)
+	body = append(body, qos)
+	return encodePacket(pktSubscribe, 0x02, body)
+}
+
+func encodeUnsubscribe(id uint16, topic string) ([]byte, error) {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, topic)
+	return encodePacket(pktUnsubscribe, 0x02, body)
+}
+
+// encodeAck builds PUBACK, PUBREC, PUBREL and PUBCOMP.
+func encodeAck(typ byte, id uint16) ([]byte, error) {
+	var flags byte
+	if typ == pktPubrel {
+		flags = 0x02
+	}
+	return encodePacket(typ, flags, binary.BigEndian.AppendUint16(nil, id))
+}
+
+func packetID(p packet) (uint16, bool) {
+	if len(p.body) < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(p.body), true
+}
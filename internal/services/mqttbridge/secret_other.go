@@ -0,0 +1,11 @@
+//go:build !windows
+
+package mqttbridge
+
+import "errors"
+
+var errNoSecretStore = errors.New("password storage needs Windows DPAPI")
+
+func protectSecret([]byte) ([]byte, error) { return nil, errNoSecretStore }
+
+func unprotectSecret([]byte) ([]byte, error) { return nil, errNoSecretStore }
@@ -0,0 +1,57 @@
+package mqttbridge
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+)
+
+const cryptProtectUIForbidden = 0x1
+
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+func newBlob(b []byte) dataBlob {
+	if len(b) == 0 {
+		return dataBlob{}
+	}
+	return dataBlob{size: uint32(len(b)), data: &b[0]}
+}
+
+// takeBytes copies the blob out and frees the memory DPAPI allocated for it.
+func (b dataBlob) takeBytes() []byte {
+	if b.data == nil {
+		return nil
+	}
+	defer syscall.LocalFree(syscall.Handle(unsafe.Pointer(b.data)))
+	return append([]byte(nil), unsafe.Slice(b.data, b.size)...)
+}
+
+// protectSecret encrypts plain with DPAPI for the current Windows user.
+func protectSecret(plain []byte) ([]byte, error) {
+	in := newBlob(plain)
+	var out dataBlob
+	r, _, err := procCryptProtectData.Call(uintptr(unsafe.Pointer(&in)), 0, 0, 0, 0, cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("CryptProtectData: %w", err)
+	}
+	return out.takeBytes(), nil
+}
+
+func unprotectSecret(sealed []byte) ([]byte, error) {
+	in := newBlob(sealed)
+	var out dataBlob
+	r, _, err := procCryptUnprotectData.Call(uintptr(unsafe.Pointer(&in)), 0, 0, 0, 0, cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("CryptUnprotectData: %w", err)
+	}
+	return out.takeBytes(), nil
+}
@@ -0,0 +1,811 @@
+package mqttbridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	topicbussvc "github.com/yttydcs/myflowhub-win/internal/services/topicbus"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	cfgMQTTBridge = "mqttbridge.config"
+
+	secretDirName    = "mqttbridge"
+	passwordFileName = "password.bin"
+
+	defaultKeepAliveSec  = 30
+	defaultPublishName   = "mqtt"
+	defaultBridgeTimeout = 8 * time.Second
+	minReconnectDelay    = time.Second
+	maxReconnectDelay    = 30 * time.Second
+	queueSize            = 256
+	loopWindow           = 5 * time.Second
+	statusEmitTick       = 500 * time.Millisecond
+)
+
+var missingLevelRef = regexp.MustCompile(`\{\d+\}`)
+
+type MQTTBridgeService struct {
+	topicbus *topicbussvc.TopicBusService
+	logs     *logs.LogService
+	store    *storage.Store
+	bus      eventbus.IBus
+
+	mu        sync.Mutex
+	cfg       Config
+	status    Status
+	cancel    context.CancelFunc
+	client    *mqttClient
+	outbound  chan mqttMessage
+	produced  map[string]time.Time
+	topicSubs []topicSub
+	lastEmit  time.Time
+	busTokens []busToken
+}
+
+type topicSub struct {
+	topic    string
+	sourceID uint32
+	targetID uint32
+}
+
+type busToken struct {
+	name  string
+	token string
+}
+
+func New(topicbus *topicbussvc.TopicBusService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *MQTTBridgeService {
+	svc := &MQTTBridgeService{
+		topicbus: topicbus,
+		logs:     logsSvc,
+		store:    store,
+		bus:      bus,
+		status:   Status{State: StateStopped},
+		produced: make(map[string]time.Time),
+	}
+	svc.bindBus()
+	svc.ReloadConfig()
+	return svc
+}
+
+func (s *MQTTBridgeService) Close() {
+	s.unbindBus()
+	s.stop()
+}
+
+func (s *MQTTBridgeService) Config() (Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return redactConfig(s.cfg), nil
+}
+
+// SaveConfig stores the configuration and starts, restarts or stops the bridge
+// according to its Enabled flag.
+func (s *MQTTBridgeService) SaveConfig(cfg Config) (Config, error) {
+	if cfg.Password == "" && cfg.HasPassword {
+		s.mu.Lock()
+		cfg.Password = s.cfg.Password
+		s.mu.Unlock()
+	}
+	normalized, err := normalizeConfig(cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := s.persist(normalized); err != nil {
+		return Config{}, err
+	}
+	s.mu.Lock()
+	s.cfg = normalized
+	s.mu.Unlock()
+	s.stop()
+	if normalized.Enabled {
+		s.start(normalized)
+	}
+	return redactConfig(normalized), nil
+}
+
+func (s *MQTTBridgeService) Start() (Status, error) {
+	cfg, err := s.setEnabled(true)
+	if err != nil {
+		return Status{}, err
+	}
+	s.stop()
+	s.start(cfg)
+	return s.Status()
+}
+
+func (s *MQTTBridgeService) Stop() (Status, error) {
+	if _, err := s.setEnabled(false); err != nil {
+		return Status{}, err
+	}
+	s.stop()
+	return s.Status()
+}
+
+func (s *MQTTBridgeService) Status() (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status, nil
+}
+
+// ReloadConfig re-reads the configuration after a profile switch and starts
+// the bridge when it is enabled there.
+func (s *MQTTBridgeService) ReloadConfig() {
+	s.stop()
+	cfg := s.loadConfig()
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	if cfg.Enabled {
+		s.start(cfg)
+	}
+}
+
+func (s *MQTTBridgeService) setEnabled(enabled bool) (Config, error) {
+	s.mu.Lock()
+	cfg := s.cfg
+	s.mu.Unlock()
+	cfg.Enabled = enabled
+	if enabled {
+		normalized, err := normalizeConfig(cfg)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg = normalized
+	}
+	if err := s.persist(cfg); err != nil {
+		return Config{}, err
+	}
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	return cfg, nil
+}
+
+func (s *MQTTBridgeService) start(cfg Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	inbound := make(chan mqttMessage, queueSize)
+	outbound := make(chan mqttMessage, queueSize)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.outbound = outbound
+	s.status = Status{State: StateConnecting, Broker: cfg.Broker, UpdatedAt: time.Now()}
+	s.mu.Unlock()
+	s.subscribeTopicBus(cfg)
+	go s.run(ctx, cfg, inbound)
+	go s.inboundWorker(ctx, cfg, inbound)
+	go s.outboundWorker(ctx, outbound)
+	s.emitStatus(true)
+}
+
+func (s *MQTTBridgeService) stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.outbound = nil
+	if cancel == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.status.State = StateStopped
+	s.status.UpdatedAt = time.Now()
+	s.mu.Unlock()
+	cancel()
+	s.unsubscribeTopicBus()
+	s.emitStatus(true)
+}
+
+// run keeps a broker connection alive until ctx ends, reconnecting with
+// exponential backoff.
+func (s *MQTTBridgeService) run(ctx context.Context, cfg Config, inbound chan mqttMessage) {
+	opts := connectOptions{
+		clientID:     cfg.ClientID,
+		username:     cfg.Username,
+		password:     cfg.Password,
+		keepAliveSec: cfg.KeepAliveSec,
+		cleanSession: cfg.CleanSession,
+	}
+	onMessage := func(msg mqttMessage) {
+		select {
+		case inbound <- msg:
+		default:
+			s.count(DirectionMQTTToTopic, func(c *DirectionCounters) { c.Received++; c.Dropped++ })
+		}
+	}
+	delay := minReconnectDelay
+	connectedBefore := false
+	for {
+		client, err := dialMQTT(ctx, cfg.Broker, opts, onMessage)
+		if ctx.Err() != nil {
+			if client != nil {
+				client.Close()
+			}
+			return
+		}
+		if err != nil {
+			s.setState(StateReconnecting, err)
+			if s.logs != nil {
+				s.logs.Appendf("warn", "mqtt bridge connect to %s failed: %v", cfg.Broker, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+		delay = minReconnectDelay
+		// Retry TopicBus subscriptions that failed while the session was down.
+		s.subscribeTopicBus(cfg)
+		for _, rule := range cfg.Rules {
+			if !rule.Enabled || rule.Direction != DirectionMQTTToTopic {
+				continue
+			}
+			if err := client.Subscribe(ctx, rule.From, byte(rule.QoS)); err != nil && s.logs != nil {
+				s.logs.Appendf("warn", "mqtt bridge subscribe %s failed: %v", rule.From, err)
+			}
+		}
+		s.mu.Lock()
+		s.client = client
+		if connectedBefore {
+			s.status.Reconnects++
+		}
+		s.status.State = StateConnected
+		s.status.LastError = ""
+		s.status.ConnectedAt = time.Now()
+		s.status.UpdatedAt = time.Now()
+		s.mu.Unlock()
+		connectedBefore = true
+		if s.logs != nil {
+			s.logs.Appendf("info", "mqtt bridge connected to %s", cfg.Broker)
+		}
+		s.emitStatus(true)
+
+		select {
+		case <-ctx.Done():
+			client.Close()
+			s.clearClient(client)
+			return
+		case <-client.Done():
+		}
+		s.clearClient(client)
+		err = client.Err()
+		s.setState(StateReconnecting, err)
+		if s.logs != nil {
+			s.logs.Appendf("warn", "mqtt bridge connection lost: %v", err)
+		}
+	}
+}
+
+func (s *MQTTBridgeService) inboundWorker(ctx context.Context, cfg Config, inbound chan mqttMessage) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-inbound:
+			s.forwardToTopicBus(ctx, cfg, msg)
+		}
+	}
+}
+
+func (s *MQTTBridgeService) forwardToTopicBus(ctx context.Context, cfg Config, msg mqttMessage) {
+	s.count(DirectionMQTTToTopic, func(c *DirectionCounters) {
+		c.Received++
+		c.Bytes += int64(len(msg.Payload))
+		if msg.Retain {
+			c.Retained++
+		}
+	})
+	if s.consumeProduced(mqttKey(msg.Topic, msg.Payload)) {
+		s.count(DirectionMQTTToTopic, func(c *DirectionCounters) { c.Looped++ })
+		return
+	}
+	text := mqttPayloadText(msg.Payload)
+	matched := false
+	for _, rule := range cfg.Rules {
+		if !rule.Enabled || rule.Direction != DirectionMQTTToTopic || !topicbussvc.MatchTopic(rule.From, msg.Topic) {
+			continue
+		}
+		matched = true
+		target, err := rewriteTopic(rule.From, rule.To, msg.Topic)
+		if err == nil {
+			name := rule.Name
+			if name == "" {
+				name = defaultPublishName
+			}
+			// The echo comes back in wire form, so key on the encoded payload.
+			var payload json.RawMessage
+			if payload, err = s.topicbus.EncodePayload(target, text); err == nil {
+				s.markProduced(topicKey(target, string(payload)))
+				pubCtx, cancel := context.WithTimeout(ctx, defaultBridgeTimeout)
+				err = s.topicbus.PublishRaw(pubCtx, cfg.SourceID, cfg.TargetID, target, name, payload)
+				cancel()
+			}
+		}
+		s.countResult(DirectionMQTTToTopic, err)
+	}
+	if !matched {
+		s.count(DirectionMQTTToTopic, func(c *DirectionCounters) { c.Dropped++ })
+	}
+}
+
+func (s *MQTTBridgeService) handleTopicEvent(evt topicbussvc.TopicBusEvent) {
+	s.mu.Lock()
+	cfg := s.cfg
+	outbound := s.outbound
+	s.mu.Unlock()
+	if outbound == nil {
+		return
+	}
+	var rules []MapRule
+	for _, rule := range cfg.Rules {
+		if rule.Enabled && rule.Direction == DirectionTopicToMQTT && topicbussvc.MatchTopic(rule.From, evt.Topic) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return
+	}
+	payload := topicPayloadBytes(evt)
+	s.count(DirectionTopicToMQTT, func(c *DirectionCounters) {
+		c.Received++
+		c.Bytes += int64(len(payload))
+	})
+	if s.consumeProduced(topicKey(evt.Topic, string(evt.Payload))) {
+		s.count(DirectionTopicToMQTT, func(c *DirectionCounters) { c.Looped++ })
+		return
+	}
+	for _, rule := range rules {
+		target, err := rewriteTopic(rule.From, rule.To, evt.Topic)
+		if err != nil {
+			s.countResult(DirectionTopicToMQTT, err)
+			continue
+		}
+		msg := mqttMessage{Topic: target, Payload: payload, QoS: byte(rule.QoS), Retain: rule.Retain}
+		select {
+		case outbound <- msg:
+		default:
+			s.count(DirectionTopicToMQTT, func(c *DirectionCounters) { c.Dropped++ })
+		}
+	}
+}
+
+func (s *MQTTBridgeService) outboundWorker(ctx context.Context, outbound chan mqttMessage) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-outbound:
+			s.mu.Lock()
+			client := s.client
+			s.mu.Unlock()
+			if client == nil {
+				s.count(DirectionTopicToMQTT, func(c *DirectionCounters) { c.Dropped++ })
+				continue
+			}
+			s.markProduced(mqttKey(msg.Topic, msg.Payload))
+			pubCtx, cancel := context.WithTimeout(ctx, defaultBridgeTimeout)
+			err := client.Publish(pubCtx, msg)
+			cancel()
+			s.countResult(DirectionTopicToMQTT, err)
+		}
+	}
+}
+
+// subscribeTopicBus subscribes the TopicBus side of topic_to_mqtt rules that
+// are not subscribed already; only those are undone on stop.
+func (s *MQTTBridgeService) subscribeTopicBus(cfg Config) {
+	if s.topicbus == nil {
+		return
+	}
+	for _, rule := range cfg.Rules {
+		if !rule.Enabled || rule.Direction != DirectionTopicToMQTT || s.topicbus.Subscribed(rule.From) {
+			continue
+		}
+		if _, err := s.topicbus.SubscribePatternSimple(cfg.SourceID, cfg.TargetID, rule.From, nil); err != nil {
+			if s.logs != nil {
+				s.logs.Appendf("warn", "mqtt bridge topicbus subscribe %s failed: %v", rule.From, err)
+			}
+			continue
+		}
+		s.mu.Lock()
+		tracked := false
+		for _, sub := range s.topicSubs {
+			tracked = tracked || sub.topic == rule.From
+		}
+		if !tracked {
+			s.topicSubs = append(s.topicSubs, topicSub{topic: rule.From, sourceID: cfg.SourceID, targetID: cfg.TargetID})
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *MQTTBridgeService) unsubscribeTopicBus() {
+	s.mu.Lock()
+	subs := s.topicSubs
+	s.topicSubs = nil
+	s.mu.Unlock()
+	for _, sub := range subs {
+		var err error
+		if topicbussvc.IsPattern(sub.topic) {
+			err = s.topicbus.UnsubscribePatternSimple(sub.topic)
+		} else {
+			_, err = s.topicbus.UnsubscribeSimple(sub.sourceID, sub.targetID, sub.topic)
+		}
+		if err != nil && s.logs != nil {
+			s.logs.Appendf("warn", "mqtt bridge topicbus unsubscribe %s failed: %v", sub.topic, err)
+		}
+	}
+}
+
+func (s *MQTTBridgeService) clearClient(client *mqttClient) {
+	s.mu.Lock()
+	if s.client == client {
+		s.client = nil
+	}
+	s.mu.Unlock()
+}
+
+func (s *MQTTBridgeService) setState(state string, err error) {
+	s.mu.Lock()
+	if s.cancel == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.status.State = state
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	s.status.UpdatedAt = time.Now()
+	s.mu.Unlock()
+	s.emitStatus(true)
+}
+
+func (s *MQTTBridgeService) count(direction string, update func(c *DirectionCounters)) {
+	s.mu.Lock()
+	c := &s.status.MQTTToTopic
+	if direction == DirectionTopicToMQTT {
+		c = &s.status.TopicToMQTT
+	}
+	update(c)
+	c.LastAt = time.Now()
+	s.status.UpdatedAt = c.LastAt
+	s.mu.Unlock()
+	s.emitStatus(false)
+}
+
+func (s *MQTTBridgeService) countResult(direction string, err error) {
+	s.count(direction, func(c *DirectionCounters) {
+		if err != nil {
+			c.Errors++
+			return
+		}
+		c.Forwarded++
+	})
+	if err != nil {
+		s.mu.Lock()
+		s.status.LastError = err.Error()
+		s.mu.Unlock()
+	}
+}
+
+func (s *MQTTBridgeService) markProduced(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, at := range s.produced {
+		if now.Sub(at) > loopWindow {
+			delete(s.produced, k)
+		}
+	}
+	s.produced[key] = now
+}
+
+func (s *MQTTBridgeService) consumeProduced(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.produced[key]
+	if !ok {
+		return false
+	}
+	delete(s.produced, key)
+	return time.Since(at) <= loopWindow
+}
+
+func (s *MQTTBridgeService) emitStatus(force bool) {
+	if s == nil || s.bus == nil {
+		return
+	}
+	s.mu.Lock()
+	if !force && !s.lastEmit.IsZero() && time.Since(s.lastEmit) < statusEmitTick {
+		s.mu.Unlock()
+		return
+	}
+	s.lastEmit = time.Now()
+	status := s.status
+	s.mu.Unlock()
+	_ = s.bus.Publish(context.Background(), EventMQTTBridgeStatus, status, nil)
+}
+
+func (s *MQTTBridgeService) bindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	addToken := func(name string, handler func(evt any)) {
+		token := s.bus.Subscribe(name, func(_ context.Context, evt eventbus.Event) {
+			if handler == nil {
+				return
+			}
+			handler(evt.Data)
+		})
+		if token != "" {
+			s.busTokens = append(s.busTokens, busToken{name: name, token: token})
+		}
+	}
+	addToken(topicbussvc.EventTopicBusEvent, func(data any) {
+		evt, ok := data.(topicbussvc.TopicBusEvent)
+		if !ok {
+			return
+		}
+		s.handleTopicEvent(evt)
+	})
+}
+
+func (s *MQTTBridgeService) unbindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	for _, entry := range s.busTokens {
+		if entry.token == "" {
+			continue
+		}
+		s.bus.Unsubscribe(entry.name, entry.token)
+	}
+	s.busTokens = nil
+}
+
+func (s *MQTTBridgeService) persist(cfg Config) error {
+	if s.store == nil {
+		return errors.New("storage not initialized")
+	}
+	if err := s.savePassword(cfg.Password); err != nil {
+		return err
+	}
+	cfg.Password, cfg.HasPassword = "", false
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.store.SetString(s.store.CurrentProfile(), cfgMQTTBridge, string(data))
+}
+
+func (s *MQTTBridgeService) loadConfig() Config {
+	if s == nil || s.store == nil {
+		return Config{KeepAliveSec: defaultKeepAliveSec, CleanSession: true}
+	}
+	raw := strings.TrimSpace(s.store.GetString(s.store.CurrentProfile(), cfgMQTTBridge, ""))
+	if raw == "" {
+		return Config{KeepAliveSec: defaultKeepAliveSec, CleanSession: true}
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "mqtt bridge config ignored: %v", err)
+		}
+		return Config{KeepAliveSec: defaultKeepAliveSec, CleanSession: true}
+	}
+	if cfg.Password != "" {
+		// Older versions kept the password in the settings; move it out.
+		if err := s.persist(cfg); err != nil && s.logs != nil {
+			s.logs.Appendf("warn", "mqtt bridge password not migrated: %v", err)
+		}
+	} else {
+		cfg.Password = s.loadPassword()
+	}
+	cfg.HasPassword = false
+	normalized, err := normalizeConfig(cfg)
+	if err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "mqtt bridge config invalid, bridge not started: %v", err)
+		}
+		cfg.Enabled = false
+		return cfg
+	}
+	return normalized
+}
+
+func (s *MQTTBridgeService) passwordPath() (string, error) {
+	dir := s.store.DataDir(s.store.CurrentProfile(), secretDirName)
+	if dir == "" {
+		return "", errors.New("storage not initialized")
+	}
+	return filepath.Join(dir, passwordFileName), nil
+}
+
+// savePassword stores password encrypted, or removes it when empty.
+func (s *MQTTBridgeService) savePassword(password string) error {
+	path, err := s.passwordPath()
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	sealed, err := protectSecret([]byte(password))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, sealed, 0o600)
+}
+
+func (s *MQTTBridgeService) loadPassword() string {
+	path, err := s.passwordPath()
+	if err != nil {
+		return ""
+	}
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	plain, err := unprotectSecret(sealed)
+	if err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "mqtt bridge password unreadable: %v", err)
+		}
+		return ""
+	}
+	return string(plain)
+}
+
+// redactConfig hides the password from what is handed to the UI.
+func redactConfig(cfg Config) Config {
+	cfg.HasPassword = cfg.Password != ""
+	cfg.Password = ""
+	return cfg
+}
+
+func normalizeConfig(cfg Config) (Config, error) {
+	cfg.Broker = strings.TrimSpace(cfg.Broker)
+	cfg.ClientID = strings.TrimSpace(cfg.ClientID)
+	cfg.Username = strings.TrimSpace(cfg.Username)
+	if _, _, _, err := parseBroker(cfg.Broker); err != nil {
+		return Config{}, err
+	}
+	if cfg.ClientID == "" {
+		var buf [4]byte
+		if _, err := rand.Read(buf[:]); err != nil {
+			return Config{}, err
+		}
+		cfg.ClientID = "myflowhub-win-" + hex.EncodeToString(buf[:])
+	}
+	if cfg.KeepAliveSec <= 0 {
+		cfg.KeepAliveSec = defaultKeepAliveSec
+	}
+	if cfg.KeepAliveSec > 65535 {
+		cfg.KeepAliveSec = 65535
+	}
+	rules := make([]MapRule, 0, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		rule.Direction = strings.TrimSpace(rule.Direction)
+		rule.From = strings.TrimSpace(rule.From)
+		rule.To = strings.TrimSpace(rule.To)
+		rule.Name = strings.TrimSpace(rule.Name)
+		if rule.Direction != DirectionMQTTToTopic && rule.Direction != DirectionTopicToMQTT {
+			return Config{}, fmt.Errorf("rule %d: unknown direction %q", i+1, rule.Direction)
+		}
+		if err := topicbussvc.ValidatePattern(rule.From); err != nil {
+			return Config{}, fmt.Errorf("rule %d: from: %w", i+1, err)
+		}
+		if topicbussvc.IsPattern(rule.To) {
+			return Config{}, fmt.Errorf("rule %d: rewrite target must not contain wildcards", i+1)
+		}
+		if rule.QoS < 0 || rule.QoS > 2 {
+			return Config{}, fmt.Errorf("rule %d: qos must be 0, 1 or 2", i+1)
+		}
+		rules = append(rules, rule)
+	}
+	cfg.Rules = rules
+	return cfg, nil
+}
+
+// rewriteTopic maps topic, which matched from, through the To template.
+func rewriteTopic(from, to, topic string) (string, error) {
+	if to == "" {
+		if topicbussvc.IsPattern(topic) {
+			return "", errors.New("topic contains wildcards")
+		}
+		return topic, nil
+	}
+	var captures []string
+	tLevels := strings.Split(topic, "/")
+	for i, level := range strings.Split(from, "/") {
+		if level == "#" {
+			if i < len(tLevels) {
+				captures = append(captures, strings.Join(tLevels[i:], "/"))
+			} else {
+				captures = append(captures, "")
+			}
+			break
+		}
+		if level == "+" && i < len(tLevels) {
+			captures = append(captures, tLevels[i])
+		}
+	}
+	out := strings.ReplaceAll(to, "{topic}", topic)
+	for i, c := range captures {
+		out = strings.ReplaceAll(out, "{"+strconv.Itoa(i+1)+"}", c)
+	}
+	if missingLevelRef.MatchString(out) {
+		return "", fmt.Errorf("rewrite %q references a level not matched by %q", to, from)
+	}
+	out = strings.Trim(out, "/")
+	if out == "" || topicbussvc.IsPattern(out) {
+		return "", fmt.Errorf("rewrite produced invalid topic %q", out)
+	}
+	return out, nil
+}
+
+// mqttPayloadText turns MQTT bytes into TopicBus payload text: JSON and UTF-8
+// pass through, binary is sent as base64.
+func mqttPayloadText(payload []byte) string {
+	if json.Valid(payload) || utf8.Valid(payload) {
+		return string(payload)
+	}
+	return base64.StdEncoding.EncodeToString(payload)
+}
+
+// topicPayloadBytes is the MQTT payload for a TopicBus message: JSON strings
+// are sent unquoted, other values as JSON text.
+func topicPayloadBytes(evt topicbussvc.TopicBusEvent) []byte {
+	payload := evt.Payload
+	if evt.DecodeError == "" && len(evt.Decoded) > 0 {
+		payload = evt.Decoded
+	}
+	var text string
+	if err := json.Unmarshal(payload, &text); err == nil {
+		return []byte(text)
+	}
+	return bytes.TrimSpace(payload)
+}
+
+func mqttKey(topic string, payload []byte) string {
+	return "mqtt|" + topic + "|" + string(payload)
+}
+
+func topicKey(topic, payload string) string {
+	payload = strings.TrimSpace(payload)
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(payload)); err == nil {
+		payload = compact.String()
+	} else if quoted, err := json.Marshal(payload); err == nil {
+		payload = string(quoted)
+	}
+	return "topic|" + topic + "|" + payload
+}
@@ -0,0 +1,64 @@
+package recorder
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventRecorderStatus = "recorder.status"
+	EventRecorderReplay = "recorder.replay"
+)
+
+type RecorderPrefs struct {
+	Enabled      bool     `json:"enabled"`
+	Topics       []string `json:"topics"`
+	MaxFileBytes int      `json:"maxFileBytes"`
+	MaxFiles     int      `json:"maxFiles"`
+}
+
+type Record struct {
+	Topic   string          `json:"topic"`
+	Name    string          `json:"name"`
+	TS      int64           `json:"ts"`
+	RecvAt  int64           `json:"recvAt"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type RecordQuery struct {
+	Topic  string `json:"topic"`
+	Name   string `json:"name"`
+	FromMs int64  `json:"fromMs"`
+	ToMs   int64  `json:"toMs"`
+	Limit  int    `json:"limit"`
+}
+
+type RecorderStatus struct {
+	Enabled     bool      `json:"enabled"`
+	Topics      []string  `json:"topics"`
+	Dir         string    `json:"dir"`
+	CurrentFile string    `json:"currentFile"`
+	Recorded    int       `json:"recorded"`
+	Errors      int       `json:"errors"`
+	LastError   string    `json:"lastError,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type ReplayReq struct {
+	SourceID uint32      `json:"sourceId"`
+	TargetID uint32      `json:"targetId"`
+	Query    RecordQuery `json:"query"`
+	Speed    float64     `json:"speed"`
+}
+
+type ReplayStatus struct {
+	Active    bool      `json:"active"`
+	Total     int       `json:"total"`
+	Truncated bool      `json:"truncated"`
+	Sent      int       `json:"sent"`
+	Errors    int       `json:"errors"`
+	Speed     float64   `json:"speed"`
+	LastError string    `json:"lastError,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
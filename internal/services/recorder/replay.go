@@ -0,0 +1,246 @@
+package recorder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	topicbussvc "github.com/yttydcs/myflowhub-win/internal/services/topicbus"
+)
+
+const (
+	defaultSearchLimit = 1000
+	maxSearchLimit     = 100000
+	maxReplayRecords   = 1000000
+	maxRecordLine      = 16 * 1024 * 1024
+)
+
+// Search scans the record files of the current profile. Topic may be an
+// MQTT-style pattern; the time range applies to the publish TS (or the receive
+// time when TS is missing). Results are in chronological order.
+func (s *RecorderService) Search(query RecordQuery) ([]Record, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultSearchLimit
+	}
+	if query.Limit > maxSearchLimit {
+		query.Limit = maxSearchLimit
+	}
+	out, _, err := s.searchRecords(query, query.Limit)
+	return out, err
+}
+
+// searchRecords collects up to limit matches in chronological order and
+// reports whether more records matched.
+func (s *RecorderService) searchRecords(query RecordQuery, limit int) ([]Record, bool, error) {
+	query.Topic = strings.TrimSpace(query.Topic)
+	query.Name = strings.TrimSpace(query.Name)
+	if query.Topic != "" {
+		if err := topicbussvc.ValidatePattern(query.Topic); err != nil {
+			return nil, false, err
+		}
+	}
+	dir := s.recordsDir()
+	if dir == "" {
+		return nil, false, errors.New("storage not initialized")
+	}
+	files, err := listRecordFiles(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	out := make([]Record, 0)
+	truncated := false
+	for _, path := range files {
+		if err := scanRecordFile(path, func(rec Record) bool {
+			if !matchRecord(query, rec) {
+				return true
+			}
+			if len(out) >= limit {
+				truncated = true
+				return false
+			}
+			out = append(out, rec)
+			return true
+		}); err != nil {
+			return nil, false, err
+		}
+		if truncated {
+			break
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return recordTime(out[i]) < recordTime(out[j]) })
+	return out, truncated, nil
+}
+
+// StartReplay republishes the records matching req.Query through TopicBusService.Publish.
+// Speed 1 keeps the original spacing, 2 replays twice as fast, and 0 sends back to back.
+// Unlike Search, a zero Query.Limit replays the whole window up to maxReplayRecords;
+// ReplayStatus.Truncated reports a window cut short by the limit.
+func (s *RecorderService) StartReplay(req ReplayReq) error {
+	if s.topicbus == nil {
+		return errors.New("topicbus service not initialized")
+	}
+	if req.SourceID == 0 {
+		return errors.New("source_id is required")
+	}
+	if req.TargetID == 0 {
+		return errors.New("target_id is required")
+	}
+	if req.Speed < 0 {
+		return errors.New("speed must be non-negative")
+	}
+	limit := req.Query.Limit
+	if limit <= 0 || limit > maxReplayRecords {
+		limit = maxReplayRecords
+	}
+	records, truncated, err := s.searchRecords(req.Query, limit)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("no records match")
+	}
+	s.mu.Lock()
+	if s.replay.Active {
+		s.mu.Unlock()
+		return errors.New("replay already active")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	s.replay = ReplayStatus{Active: true, Total: len(records), Truncated: truncated, Speed: req.Speed, StartedAt: now, UpdatedAt: now}
+	s.replayStop = cancel
+	s.mu.Unlock()
+	if truncated && s.logs != nil {
+		s.logs.Appendf("warn", "recorder replay limited to the first %d matching records", len(records))
+	}
+	s.emitReplay()
+	go s.runReplay(ctx, req, records)
+	return nil
+}
+
+func (s *RecorderService) StopReplay() {
+	s.mu.Lock()
+	cancel := s.replayStop
+	s.replayStop = nil
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (s *RecorderService) ReplayState() (ReplayStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replay, nil
+}
+
+func (s *RecorderService) runReplay(ctx context.Context, req ReplayReq, records []Record) {
+	start := time.Now()
+	first := recordTime(records[0])
+	for _, rec := range records {
+		if req.Speed > 0 {
+			offset := time.Duration(float64(recordTime(rec)-first)/req.Speed) * time.Millisecond
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					s.finishReplay()
+					return
+				case <-timer.C:
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			s.finishReplay()
+			return
+		}
+		err := s.topicbus.PublishRaw(ctx, req.SourceID, req.TargetID, rec.Topic, rec.Name, rec.Payload)
+		s.mu.Lock()
+		if err != nil {
+			s.replay.Errors++
+			s.replay.LastError = err.Error()
+		} else {
+			s.replay.Sent++
+		}
+		s.replay.UpdatedAt = time.Now()
+		shouldEmit := time.Since(s.lastEmit) >= statusEmitTick
+		if shouldEmit {
+			s.lastEmit = time.Now()
+		}
+		s.mu.Unlock()
+		if shouldEmit {
+			s.emitReplay()
+		}
+	}
+	s.finishReplay()
+}
+
+func (s *RecorderService) finishReplay() {
+	s.mu.Lock()
+	s.replay.Active = false
+	s.replay.UpdatedAt = time.Now()
+	s.replayStop = nil
+	s.mu.Unlock()
+	s.emitReplay()
+}
+
+func (s *RecorderService) emitReplay() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	status, _ := s.ReplayState()
+	_ = s.bus.Publish(context.Background(), EventRecorderReplay, status, nil)
+}
+
+func scanRecordFile(path string, fn func(Record) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordLine)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn last line after a crash must not hide the rest of the history.
+			continue
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func matchRecord(query RecordQuery, rec Record) bool {
+	if query.Topic != "" && !topicbussvc.MatchTopic(query.Topic, rec.Topic) {
+		return false
+	}
+	if query.Name != "" && query.Name != rec.Name {
+		return false
+	}
+	ts := recordTime(rec)
+	if query.FromMs > 0 && ts < query.FromMs {
+		return false
+	}
+	if query.ToMs > 0 && ts > query.ToMs {
+		return false
+	}
+	return true
+}
+
+func recordTime(rec Record) int64 {
+	if rec.TS > 0 {
+		return rec.TS
+	}
+	return rec.RecvAt
+}
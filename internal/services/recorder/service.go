@@ -0,0 +1,380 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	protocol "github.com/yttydcs/myflowhub-proto/protocol/topicbus"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	topicbussvc "github.com/yttydcs/myflowhub-win/internal/services/topicbus"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	CfgRecorderEnabled      = "topicbus.recorder.enabled"
+	cfgRecorderTopics       = "topicbus.recorder.topics"
+	CfgRecorderMaxFileBytes = "topicbus.recorder.max_file_bytes"
+	CfgRecorderMaxFiles     = "topicbus.recorder.max_files"
+
+	recordsDirName  = "topicbus_records"
+	recordFilePrefx = "rec-"
+	recordFileExt   = ".jsonl"
+
+	defaultMaxFileBytes = 16 * 1024 * 1024
+	defaultMaxFiles     = 20
+	statusEmitTick      = 500 * time.Millisecond
+)
+
+type RecorderService struct {
+	topicbus *topicbussvc.TopicBusService
+	logs     *logs.LogService
+	store    *storage.Store
+	bus      eventbus.IBus
+
+	mu         sync.Mutex
+	prefs      RecorderPrefs
+	file       *os.File
+	filePath   string
+	fileSize   int64
+	recorded   int
+	errors     int
+	lastError  string
+	lastEmit   time.Time
+	replay     ReplayStatus
+	replayStop context.CancelFunc
+	busTokens  []busToken
+}
+
+type busToken struct {
+	name  string
+	token string
+}
+
+func New(topicbus *topicbussvc.TopicBusService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *RecorderService {
+	svc := &RecorderService{topicbus: topicbus, logs: logsSvc, store: store, bus: bus}
+	svc.prefs = svc.loadPrefs()
+	svc.bindBus()
+	return svc
+}
+
+func (s *RecorderService) Close() {
+	s.unbindBus()
+	s.StopReplay()
+	s.mu.Lock()
+	s.closeFileLocked()
+	s.mu.Unlock()
+}
+
+func (s *RecorderService) Prefs() (RecorderPrefs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prefs, nil
+}
+
+func (s *RecorderService) SavePrefs(prefs RecorderPrefs) (RecorderPrefs, error) {
+	if s == nil || s.store == nil {
+		return RecorderPrefs{}, errors.New("storage not initialized")
+	}
+	normalized, err := normalizePrefs(prefs)
+	if err != nil {
+		return RecorderPrefs{}, err
+	}
+	topics, err := json.Marshal(normalized.Topics)
+	if err != nil {
+		return RecorderPrefs{}, err
+	}
+	profile := s.store.CurrentProfile()
+	if err := s.store.SetBool(profile, CfgRecorderEnabled, normalized.Enabled); err != nil {
+		return RecorderPrefs{}, err
+	}
+	if err := s.store.SetString(profile, cfgRecorderTopics, string(topics)); err != nil {
+		return RecorderPrefs{}, err
+	}
+	if err := s.store.SetInt(profile, CfgRecorderMaxFileBytes, normalized.MaxFileBytes); err != nil {
+		return RecorderPrefs{}, err
+	}
+	if err := s.store.SetInt(profile, CfgRecorderMaxFiles, normalized.MaxFiles); err != nil {
+		return RecorderPrefs{}, err
+	}
+	s.mu.Lock()
+	s.prefs = normalized
+	if !normalized.Enabled {
+		s.closeFileLocked()
+	}
+	s.mu.Unlock()
+	s.emitStatus()
+	return normalized, nil
+}
+
+// ReloadPrefs re-reads the recorder settings after a profile switch or a
+// change made through the config keys.
+func (s *RecorderService) ReloadPrefs() {
+	prefs := s.loadPrefs()
+	s.mu.Lock()
+	s.prefs = prefs
+	s.closeFileLocked()
+	s.mu.Unlock()
+	s.emitStatus()
+}
+
+func (s *RecorderService) Status() (RecorderStatus, error) {
+	return s.statusSnapshot(), nil
+}
+
+// Files lists the record files of the current profile, oldest first.
+func (s *RecorderService) Files() ([]string, error) {
+	dir := s.recordsDir()
+	if dir == "" {
+		return nil, errors.New("storage not initialized")
+	}
+	return listRecordFiles(dir)
+}
+
+func (s *RecorderService) bindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	addToken := func(name string, handler func(evt any)) {
+		token := s.bus.Subscribe(name, func(_ context.Context, evt eventbus.Event) {
+			if handler == nil {
+				return
+			}
+			handler(evt.Data)
+		})
+		if token != "" {
+			s.busTokens = append(s.busTokens, busToken{name: name, token: token})
+		}
+	}
+	addToken(topicbussvc.EventTopicBusEvent, func(data any) {
+		evt, ok := data.(topicbussvc.TopicBusEvent)
+		if !ok {
+			return
+		}
+		s.record(evt.PublishReq)
+	})
+}
+
+func (s *RecorderService) unbindBus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	for _, entry := range s.busTokens {
+		if entry.token == "" {
+			continue
+		}
+		s.bus.Unsubscribe(entry.name, entry.token)
+	}
+	s.busTokens = nil
+}
+
+func (s *RecorderService) record(msg protocol.PublishReq) {
+	s.mu.Lock()
+	if !s.prefs.Enabled || !matchesAny(s.prefs.Topics, msg.Topic) {
+		s.mu.Unlock()
+		return
+	}
+	rec := Record{Topic: msg.Topic, Name: msg.Name, TS: msg.TS, RecvAt: time.Now().UnixMilli(), Payload: msg.Payload}
+	err := s.writeLocked(rec)
+	if err != nil {
+		s.errors++
+		s.lastError = err.Error()
+	} else {
+		s.recorded++
+	}
+	shouldEmit := s.lastEmit.IsZero() || time.Since(s.lastEmit) >= statusEmitTick
+	if shouldEmit {
+		s.lastEmit = time.Now()
+	}
+	s.mu.Unlock()
+	if err != nil && s.logs != nil {
+		s.logs.Appendf("error", "topicbus recorder write failed: %v", err)
+	}
+	if shouldEmit {
+		s.emitStatus()
+	}
+}
+
+func (s *RecorderService) writeLocked(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	dir := s.recordsDir()
+	if dir == "" {
+		return errors.New("storage not initialized")
+	}
+	if s.file != nil && (filepath.Dir(s.filePath) != dir || s.fileSize+int64(len(line)) > int64(s.prefs.MaxFileBytes)) {
+		s.closeFileLocked()
+	}
+	if s.file == nil {
+		if err := s.openFileLocked(dir); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.fileSize += int64(n)
+	return err
+}
+
+func (s *RecorderService) openFileLocked(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s%s-%03d%s", recordFilePrefx, now.Format("20060102-150405"), now.Nanosecond()/int(time.Millisecond), recordFileExt)
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.filePath = path
+	s.fileSize = 0
+	s.pruneLocked(dir)
+	return nil
+}
+
+func (s *RecorderService) closeFileLocked() {
+	if s.file == nil {
+		return
+	}
+	_ = s.file.Close()
+	s.file = nil
+	s.filePath = ""
+	s.fileSize = 0
+}
+
+// pruneLocked removes the oldest record files beyond MaxFiles.
+func (s *RecorderService) pruneLocked(dir string) {
+	files, err := listRecordFiles(dir)
+	if err != nil {
+		return
+	}
+	for len(files) > s.prefs.MaxFiles {
+		if files[0] != s.filePath {
+			_ = os.Remove(files[0])
+		}
+		files = files[1:]
+	}
+}
+
+func (s *RecorderService) recordsDir() string {
+	if s == nil || s.store == nil {
+		return ""
+	}
+	return s.store.DataDir(s.store.CurrentProfile(), recordsDirName)
+}
+
+func (s *RecorderService) loadPrefs() RecorderPrefs {
+	if s == nil || s.store == nil {
+		prefs, _ := normalizePrefs(RecorderPrefs{})
+		return prefs
+	}
+	profile := s.store.CurrentProfile()
+	var topics []string
+	if raw := strings.TrimSpace(s.store.GetString(profile, cfgRecorderTopics, "")); raw != "" {
+		_ = json.Unmarshal([]byte(raw), &topics)
+	}
+	raw := RecorderPrefs{
+		Enabled:      s.store.GetBool(profile, CfgRecorderEnabled, false),
+		Topics:       topics,
+		MaxFileBytes: s.store.GetInt(profile, CfgRecorderMaxFileBytes, defaultMaxFileBytes),
+		MaxFiles:     s.store.GetInt(profile, CfgRecorderMaxFiles, defaultMaxFiles),
+	}
+	prefs, err := normalizePrefs(raw)
+	if err != nil {
+		raw.Topics = nil
+		prefs, _ = normalizePrefs(raw)
+	}
+	return prefs
+}
+
+func normalizePrefs(prefs RecorderPrefs) (RecorderPrefs, error) {
+	topics := make([]string, 0, len(prefs.Topics))
+	seen := make(map[string]bool, len(prefs.Topics))
+	for _, topic := range prefs.Topics {
+		topic = strings.TrimSpace(topic)
+		if topic == "" || seen[topic] {
+			continue
+		}
+		if err := topicbussvc.ValidatePattern(topic); err != nil {
+			return RecorderPrefs{}, fmt.Errorf("topic %q: %w", topic, err)
+		}
+		seen[topic] = true
+		topics = append(topics, topic)
+	}
+	prefs.Topics = topics
+	if prefs.MaxFileBytes <= 0 {
+		prefs.MaxFileBytes = defaultMaxFileBytes
+	}
+	if prefs.MaxFiles <= 0 {
+		prefs.MaxFiles = defaultMaxFiles
+	}
+	return prefs, nil
+}
+
+func matchesAny(patterns []string, topic string) bool {
+	for _, pattern := range patterns {
+		if topicbussvc.MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func listRecordFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry == nil || entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if !strings.HasPrefix(name, recordFilePrefx) || !strings.HasSuffix(name, recordFileExt) {
+			continue
+		}
+		out = append(out, filepath.Join(dir, name))
+	}
+	// File names embed the creation time, so lexical order is chronological.
+	sort.Strings(out)
+	return out, nil
+}
+
+func (s *RecorderService) statusSnapshot() RecorderStatus {
+	dir := s.recordsDir()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return RecorderStatus{
+		Enabled:     s.prefs.Enabled,
+		Topics:      append([]string(nil), s.prefs.Topics...),
+		Dir:         dir,
+		CurrentFile: s.filePath,
+		Recorded:    s.recorded,
+		Errors:      s.errors,
+		LastError:   s.lastError,
+		UpdatedAt:   time.Now(),
+	}
+}
+
+func (s *RecorderService) emitStatus() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	_ = s.bus.Publish(context.Background(), EventRecorderStatus, s.statusSnapshot(), nil)
+}
@@ -0,0 +1,34 @@
+package scheduler
+
+import "time"
+
+const EventSchedulerJob = "scheduler.job"
+
+// Job publishes a templated payload on a topic, either every IntervalMs or on
+// a cron schedule. Enabled jobs are started when the profile is loaded.
+type Job struct {
+	ID         string `json:"id"`
+	Label      string `json:"label"`
+	SourceID   uint32 `json:"sourceId"`
+	TargetID   uint32 `json:"targetId"`
+	Topic      string `json:"topic"`
+	Name       string `json:"name"`
+	Payload    string `json:"payload"`
+	IntervalMs int    `json:"intervalMs"`
+	Cron       string `json:"cron"`
+	Enabled    bool   `json:"enabled"`
+}
+
+type JobStatus struct {
+	ID          string    `json:"id"`
+	Running     bool      `json:"running"`
+	Sent        int       `json:"sent"`
+	Errors      int       `json:"errors"`
+	Counter     int64     `json:"counter"`
+	LastPayload string    `json:"lastPayload,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastRunAt   time.Time `json:"lastRunAt"`
+	NextRunAt   time.Time `json:"nextRunAt"`
+	StartedAt   time.Time `json:"startedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
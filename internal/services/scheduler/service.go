@@ -0,0 +1,409 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	topicbussvc "github.com/yttydcs/myflowhub-win/internal/services/topicbus"
+	varpoolsvc "github.com/yttydcs/myflowhub-win/internal/services/varpool"
+	"github.com/yttydcs/myflowhub-win/internal/storage"
+)
+
+const (
+	cfgSchedulerJobs = "scheduler.jobs"
+
+	minIntervalMs      = 100
+	defaultRunTimeout  = 8 * time.Second
+	statusEmitTick     = 200 * time.Millisecond
+	defaultPublishName = "scheduled"
+)
+
+type SchedulerService struct {
+	topicbus *topicbussvc.TopicBusService
+	varpool  *varpoolsvc.VarPoolService
+	logs     *logs.LogService
+	store    *storage.Store
+	bus      eventbus.IBus
+
+	mu   sync.Mutex
+	jobs []Job
+	runs map[string]*jobRun
+}
+
+type jobRun struct {
+	cancel   context.CancelFunc
+	status   JobStatus
+	lastEmit time.Time
+}
+
+func New(topicbus *topicbussvc.TopicBusService, varpool *varpoolsvc.VarPoolService, logsSvc *logs.LogService, store *storage.Store, bus eventbus.IBus) *SchedulerService {
+	svc := &SchedulerService{topicbus: topicbus, varpool: varpool, logs: logsSvc, store: store, bus: bus, runs: make(map[string]*jobRun)}
+	svc.ReloadJobs()
+	return svc
+}
+
+// Close stops every running job without changing its saved enabled flag.
+func (s *SchedulerService) Close() {
+	s.stopAll()
+}
+
+func (s *SchedulerService) Jobs() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Job(nil), s.jobs...), nil
+}
+
+// SaveJob creates a job (empty ID) or replaces an existing one. A running job
+// is restarted with the new definition.
+func (s *SchedulerService) SaveJob(job Job) (Job, error) {
+	normalized, err := normalizeJob(job)
+	if err != nil {
+		return Job{}, err
+	}
+	if normalized.ID == "" {
+		if normalized.ID, err = newJobID(); err != nil {
+			return Job{}, err
+		}
+	}
+	s.mu.Lock()
+	replaced := false
+	for i := range s.jobs {
+		if s.jobs[i].ID == normalized.ID {
+			normalized.Enabled = s.jobs[i].Enabled
+			s.jobs[i] = normalized
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		normalized.Enabled = false
+		s.jobs = append(s.jobs, normalized)
+	}
+	_, running := s.runs[normalized.ID]
+	err = s.persistLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return Job{}, err
+	}
+	if running {
+		s.stopRun(normalized.ID)
+		s.startRun(normalized)
+	}
+	return normalized, nil
+}
+
+func (s *SchedulerService) DeleteJob(id string) error {
+	id = strings.TrimSpace(id)
+	s.stopRun(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.jobs {
+		if s.jobs[i].ID == id {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			return s.persistLocked()
+		}
+	}
+	return errors.New("job not found")
+}
+
+// StartJob starts a job and marks it enabled so it resumes with the profile.
+func (s *SchedulerService) StartJob(id string) (JobStatus, error) {
+	job, err := s.setEnabled(id, true)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	s.stopRun(job.ID)
+	return s.startRun(job), nil
+}
+
+func (s *SchedulerService) StopJob(id string) (JobStatus, error) {
+	job, err := s.setEnabled(id, false)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return s.stopRun(job.ID), nil
+}
+
+func (s *SchedulerService) Status() ([]JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		if run := s.runs[job.ID]; run != nil {
+			out = append(out, run.status)
+			continue
+		}
+		out = append(out, JobStatus{ID: job.ID})
+	}
+	return out, nil
+}
+
+// ReloadJobs stops running jobs, loads the current profile's jobs and starts
+// the enabled ones.
+func (s *SchedulerService) ReloadJobs() {
+	s.stopAll()
+	jobs := s.loadJobs()
+	s.mu.Lock()
+	s.jobs = jobs
+	s.mu.Unlock()
+	for _, job := range jobs {
+		if job.Enabled {
+			s.startRun(job)
+		}
+	}
+}
+
+func (s *SchedulerService) setEnabled(id string, enabled bool) (Job, error) {
+	id = strings.TrimSpace(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.jobs {
+		if s.jobs[i].ID != id {
+			continue
+		}
+		if s.jobs[i].Enabled != enabled {
+			s.jobs[i].Enabled = enabled
+			if err := s.persistLocked(); err != nil {
+				return Job{}, err
+			}
+		}
+		return s.jobs[i], nil
+	}
+	return Job{}, errors.New("job not found")
+}
+
+func (s *SchedulerService) startRun(job Job) JobStatus {
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	run := &jobRun{cancel: cancel, status: JobStatus{ID: job.ID, Running: true, StartedAt: now, UpdatedAt: now}}
+	s.mu.Lock()
+	s.runs[job.ID] = run
+	status := run.status
+	s.mu.Unlock()
+	if s.logs != nil {
+		s.logs.Appendf("info", "scheduler job started id=%s topic=%s", job.ID, job.Topic)
+	}
+	go s.runJob(ctx, job, run)
+	s.emit(status)
+	return status
+}
+
+func (s *SchedulerService) stopRun(id string) JobStatus {
+	s.mu.Lock()
+	run := s.runs[id]
+	delete(s.runs, id)
+	if run == nil {
+		s.mu.Unlock()
+		return JobStatus{ID: id}
+	}
+	run.cancel()
+	run.status.Running = false
+	run.status.NextRunAt = time.Time{}
+	run.status.UpdatedAt = time.Now()
+	status := run.status
+	s.mu.Unlock()
+	if s.logs != nil {
+		s.logs.Appendf("info", "scheduler job stopped id=%s sent=%d errors=%d", id, status.Sent, status.Errors)
+	}
+	s.emit(status)
+	return status
+}
+
+func (s *SchedulerService) stopAll() {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.runs))
+	for id := range s.runs {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		s.stopRun(id)
+	}
+}
+
+func (s *SchedulerService) runJob(ctx context.Context, job Job, run *jobRun) {
+	var cron *cronSchedule
+	if job.Cron != "" {
+		// Validated in normalizeJob.
+		cron, _ = parseCron(job.Cron)
+	}
+	rnd := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+	interval := time.Duration(job.IntervalMs) * time.Millisecond
+	next := time.Now()
+	if cron != nil {
+		next = cron.Next(next)
+	}
+	var counter int64
+	for {
+		if next.IsZero() {
+			// The cron expression never fires again (e.g. Feb 30).
+			s.mu.Lock()
+			current := s.runs[job.ID] == run
+			s.mu.Unlock()
+			if current {
+				s.stopRun(job.ID)
+			}
+			return
+		}
+		s.mu.Lock()
+		run.status.NextRunAt = next
+		s.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		counter++
+		s.fire(ctx, job, run, counter, rnd)
+		if cron != nil {
+			next = cron.Next(time.Now())
+			continue
+		}
+		next = next.Add(interval)
+		if now := time.Now(); next.Before(now) {
+			// Skip missed ticks instead of bursting after a stall.
+			next = now.Add(interval)
+		}
+	}
+}
+
+func (s *SchedulerService) fire(ctx context.Context, job Job, run *jobRun, counter int64, rnd *mathrand.Rand) {
+	runCtx, cancel := context.WithTimeout(ctx, defaultRunTimeout)
+	defer cancel()
+	now := time.Now()
+	payload, err := renderPayload(job.Payload, renderEnv{counter: counter, now: now, rnd: rnd, lookup: s.varLookup(runCtx, job)})
+	if err == nil {
+		if s.topicbus == nil {
+			err = errors.New("topicbus not available")
+		} else {
+			err = s.topicbus.Publish(runCtx, job.SourceID, job.TargetID, job.Topic, job.Name, payload)
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	s.mu.Lock()
+	prevError := run.status.LastError
+	run.status.Counter = counter
+	run.status.LastRunAt = now
+	run.status.UpdatedAt = time.Now()
+	if err != nil {
+		run.status.Errors++
+		run.status.LastError = err.Error()
+	} else {
+		run.status.Sent++
+		run.status.LastError = ""
+		run.status.LastPayload = payload
+	}
+	shouldEmit := run.lastEmit.IsZero() || time.Since(run.lastEmit) >= statusEmitTick || run.status.LastError != prevError
+	if shouldEmit {
+		run.lastEmit = time.Now()
+	}
+	status := run.status
+	s.mu.Unlock()
+
+	// Log only error transitions so a job running while offline does not flood the log.
+	if err != nil && err.Error() != prevError && s.logs != nil {
+		s.logs.Appendf("warn", "scheduler job %s publish failed: %v", job.ID, err)
+	}
+	if shouldEmit {
+		s.emit(status)
+	}
+}
+
+func (s *SchedulerService) emit(status JobStatus) {
+	if s == nil || s.bus == nil {
+		return
+	}
+	_ = s.bus.Publish(context.Background(), EventSchedulerJob, status, nil)
+}
+
+func (s *SchedulerService) persistLocked() error {
+	if s.store == nil {
+		return errors.New("storage not initialized")
+	}
+	data, err := json.Marshal(s.jobs)
+	if err != nil {
+		return err
+	}
+	return s.store.SetString(s.store.CurrentProfile(), cfgSchedulerJobs, string(data))
+}
+
+func (s *SchedulerService) loadJobs() []Job {
+	if s == nil || s.store == nil {
+		return nil
+	}
+	raw := strings.TrimSpace(s.store.GetString(s.store.CurrentProfile(), cfgSchedulerJobs, ""))
+	if raw == "" {
+		return nil
+	}
+	var stored []Job
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		if s.logs != nil {
+			s.logs.Appendf("warn", "scheduler jobs ignored: %v", err)
+		}
+		return nil
+	}
+	out := make([]Job, 0, len(stored))
+	for _, job := range stored {
+		normalized, err := normalizeJob(job)
+		if err != nil || normalized.ID == "" {
+			if s.logs != nil {
+				s.logs.Appendf("warn", "scheduler job %q ignored: %v", job.ID, err)
+			}
+			continue
+		}
+		out = append(out, normalized)
+	}
+	return out
+}
+
+func normalizeJob(job Job) (Job, error) {
+	job.ID = strings.TrimSpace(job.ID)
+	job.Label = strings.TrimSpace(job.Label)
+	job.Topic = strings.TrimSpace(job.Topic)
+	job.Name = strings.TrimSpace(job.Name)
+	job.Cron = strings.TrimSpace(job.Cron)
+	if job.Topic == "" {
+		return Job{}, errors.New("topic is required")
+	}
+	if topicbussvc.IsPattern(job.Topic) {
+		return Job{}, errors.New("topic must not contain wildcards")
+	}
+	if job.Name == "" {
+		job.Name = defaultPublishName
+	}
+	if job.Cron != "" {
+		if _, err := parseCron(job.Cron); err != nil {
+			return Job{}, fmt.Errorf("cron: %w", err)
+		}
+		job.IntervalMs = 0
+	} else if job.IntervalMs < minIntervalMs {
+		return Job{}, fmt.Errorf("interval must be at least %d ms", minIntervalMs)
+	}
+	if err := validateTemplate(job.Payload); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func newJobID() (string, error) {
+	var buf [6]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return "job-" + hex.EncodeToString(buf[:]), nil
+}
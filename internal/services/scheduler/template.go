@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/varstore"
+)
+
+// Payload templates substitute {{...}} placeholders on every run:
+//
+//	{{counter}}          run number of the job, starting at 1
+//	{{ts}}               unix time in milliseconds
+//	{{iso}}              RFC 3339 timestamp
+//	{{rand MIN MAX}}     random integer in [MIN, MAX]
+//	{{randf MIN MAX}}    random float in [MIN, MAX)
+//	{{var NAME}}         VarPool value of NAME on the job's target
+//	{{var OWNER NAME}}   VarPool value of NAME owned by node OWNER
+//
+// Values are inserted as-is, so quote placeholders that should be JSON strings.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+type renderEnv struct {
+	counter int64
+	now     time.Time
+	rnd     *rand.Rand
+	lookup  func(owner uint32, name string) (string, error)
+}
+
+func renderPayload(tmpl string, env renderEnv) (string, error) {
+	var firstErr error
+	out := placeholderPattern.ReplaceAllStringFunc(tmpl, func(match string) string {
+		expr := placeholderPattern.FindStringSubmatch(match)[1]
+		val, err := evalPlaceholder(expr, env)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("{{%s}}: %w", expr, err)
+			}
+			return match
+		}
+		return val
+	})
+	return out, firstErr
+}
+
+func evalPlaceholder(expr string, env renderEnv) (string, error) {
+	args := strings.Fields(expr)
+	if len(args) == 0 {
+		return "", errors.New("empty placeholder")
+	}
+	switch strings.ToLower(args[0]) {
+	case "counter":
+		return strconv.FormatInt(env.counter, 10), nil
+	case "ts":
+		return strconv.FormatInt(env.now.UnixMilli(), 10), nil
+	case "iso":
+		return env.now.Format(time.RFC3339), nil
+	case "rand":
+		if len(args) != 3 {
+			return "", errors.New("usage: rand MIN MAX")
+		}
+		lo, errLo := strconv.ParseInt(args[1], 10, 64)
+		hi, errHi := strconv.ParseInt(args[2], 10, 64)
+		if errLo != nil || errHi != nil || lo > hi {
+			return "", errors.New("invalid range")
+		}
+		// The span is computed unsigned so ranges crossing zero cannot
+		// overflow; Int63n needs span+1 to stay a positive int64.
+		span := uint64(hi) - uint64(lo)
+		if span >= math.MaxInt64 {
+			return "", errors.New("range too wide")
+		}
+		return strconv.FormatInt(lo+env.rnd.Int63n(int64(span)+1), 10), nil
+	case "randf":
+		if len(args) != 3 {
+			return "", errors.New("usage: randf MIN MAX")
+		}
+		lo, errLo := strconv.ParseFloat(args[1], 64)
+		hi, errHi := strconv.ParseFloat(args[2], 64)
+		if errLo != nil || errHi != nil || lo > hi {
+			return "", errors.New("invalid range")
+		}
+		return strconv.FormatFloat(lo+env.rnd.Float64()*(hi-lo), 'f', 3, 64), nil
+	case "var":
+		if env.lookup == nil {
+			return "", errors.New("varpool not available")
+		}
+		switch len(args) {
+		case 2:
+			return env.lookup(0, args[1])
+		case 3:
+			owner, err := strconv.ParseUint(args[1], 10, 32)
+			if err != nil {
+				return "", errors.New("invalid owner")
+			}
+			return env.lookup(uint32(owner), args[2])
+		default:
+			return "", errors.New("usage: var [OWNER] NAME")
+		}
+	default:
+		return "", errors.New("unknown placeholder")
+	}
+}
+
+// validateTemplate checks placeholder syntax without side effects.
+func validateTemplate(tmpl string) error {
+	env := renderEnv{
+		now: time.Now(),
+		rnd: rand.New(rand.NewSource(1)),
+		lookup: func(uint32, string) (string, error) {
+			return "", nil
+		},
+	}
+	_, err := renderPayload(tmpl, env)
+	return err
+}
+
+func (s *SchedulerService) varLookup(ctx context.Context, job Job) func(owner uint32, name string) (string, error) {
+	if s.varpool == nil {
+		return nil
+	}
+	cache := make(map[string]string)
+	return func(owner uint32, name string) (string, error) {
+		key := strconv.FormatUint(uint64(owner), 10) + "/" + name
+		if v, ok := cache[key]; ok {
+			return v, nil
+		}
+		resp, err := s.varpool.Get(ctx, job.SourceID, job.TargetID, varstore.GetReq{Name: name, Owner: owner})
+		if err != nil {
+			return "", err
+		}
+		cache[key] = resp.Value
+		return resp.Value, nil
+	}
+}
@@ -165,6 +165,40 @@ func (s *SessionService) SendCommand(subProto uint8, sourceID, targetID uint32,
 	return nil
 }
 
+// SendResponse answers the command frame req. The header is built from the
+// request (same MsgID and sub protocol, source and target swapped) so that the
+// peer's awaiter can match it; ok selects MajorOKResp or MajorErrResp.
+func (s *SessionService) SendResponse(req FrameEvent, ok bool, payload []byte) error {
+	if req.SubProto == 0 {
+		return errors.New("subProto is required")
+	}
+	reqHdr := (&header.HeaderTcp{}).
+		WithMajor(req.Major).
+		WithSubProto(req.SubProto).
+		WithSourceID(req.SourceID).
+		WithTargetID(req.TargetID).
+		WithMsgID(req.MsgID).
+		WithTimestamp(req.Timestamp)
+	hdr := header.BuildTCPResponse(reqHdr, uint32(len(payload)), req.SubProto)
+	if !ok {
+		hdr.WithMajor(header.MajorErrResp)
+	}
+	if err := s.Send(hdr, payload); err != nil {
+		return err
+	}
+	if s.logs != nil {
+		trimmed, truncated := trimPayload(payload, logPayloadLimit)
+		s.logs.AppendPayload("info",
+			fmt.Sprintf("[TX] major=%d sub=%d src=%d tgt=%d len=%d",
+				hdr.Major(), hdr.SubProto(), hdr.SourceID(), hdr.TargetID(), len(payload)),
+			trimmed,
+			len(payload),
+			truncated,
+		)
+	}
+	return nil
+}
+
 func (s *SessionService) SendCommandAndAwait(ctx context.Context, subProto uint8, sourceID, targetID uint32, payload []byte, expectAction string) (sdkawait.Response, error) {
 	if subProto == 0 {
 		return sdkawait.Response{}, errors.New("subProto is required")
@@ -0,0 +1,270 @@
+package topicbus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	CodecJSON     = "json"
+	CodecText     = "text"
+	CodecBase64   = "base64"
+	CodecCBOR     = "cbor"
+	CodecMsgPack  = "msgpack"
+	CodecGzipJSON = "gzip-json"
+
+	maxGzipDecoded = 16 * 1024 * 1024
+)
+
+// PayloadCodec converts between the text entered for a publish and the JSON
+// payload carried by PublishReq. Binary codecs travel as a base64 JSON string,
+// since the publish payload itself must stay valid JSON.
+type PayloadCodec interface {
+	Name() string
+	Encode(text string) (json.RawMessage, error)
+	Decode(payload json.RawMessage) (json.RawMessage, error)
+}
+
+func builtinCodecs() map[string]PayloadCodec {
+	out := make(map[string]PayloadCodec)
+	for _, c := range []PayloadCodec{
+		jsonCodec{}, textCodec{}, base64Codec{},
+		binaryCodec{name: CodecCBOR, marshal: cborMarshal, unmarshal: cborUnmarshal},
+		binaryCodec{name: CodecMsgPack, marshal: msgpackMarshal, unmarshal: msgpackUnmarshal},
+		binaryCodec{name: CodecGzipJSON, marshal: gzipMarshal, unmarshal: gzipUnmarshal},
+	} {
+		out[c.Name()] = c
+	}
+	return out
+}
+
+// RegisterCodec adds or replaces a payload codec.
+func (s *TopicBusService) RegisterCodec(codec PayloadCodec) error {
+	if codec == nil || strings.TrimSpace(codec.Name()) == "" {
+		return errors.New("codec name is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.codecs == nil {
+		s.codecs = builtinCodecs()
+	}
+	s.codecs[strings.TrimSpace(codec.Name())] = codec
+	return nil
+}
+
+func (s *TopicBusService) Codecs() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.codecs))
+	for name := range s.codecs {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// SetTopicCodecs replaces the topic (or pattern) to codec mapping. Topics not
+// covered by the mapping use the json codec.
+func (s *TopicBusService) SetTopicCodecs(mapping map[string]string) error {
+	next := make(map[string]string, len(mapping))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for topic, name := range mapping {
+		topic = strings.TrimSpace(topic)
+		name = strings.TrimSpace(name)
+		if topic == "" || name == "" {
+			continue
+		}
+		if err := ValidatePattern(topic); err != nil {
+			return fmt.Errorf("topic %q: %w", topic, err)
+		}
+		if _, ok := s.codecs[name]; !ok {
+			return fmt.Errorf("unknown codec %q", name)
+		}
+		next[topic] = name
+	}
+	s.topicCodecs = next
+	return nil
+}
+
+// EncodePayload runs the codec of topic on text and returns the payload that
+// Publish would put on the wire.
+func (s *TopicBusService) EncodePayload(topic, text string) (json.RawMessage, error) {
+	codec := s.codecFor(strings.TrimSpace(topic))
+	payload, err := codec.Encode(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s payload: %w", codec.Name(), err)
+	}
+	return payload, nil
+}
+
+// codecFor picks the codec of an exact topic entry, else of the longest
+// matching pattern.
+func (s *TopicBusService) codecFor(topic string) PayloadCodec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	name, ok := s.topicCodecs[topic]
+	if !ok {
+		best := ""
+		for pattern, codec := range s.topicCodecs {
+			if len(pattern) > len(best) && MatchTopic(pattern, topic) {
+				best, name = pattern, codec
+			}
+		}
+	}
+	if c := s.codecs[name]; c != nil {
+		return c
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return CodecJSON }
+
+func (jsonCodec) Encode(text string) (json.RawMessage, error) {
+	return normalizePayload(text), nil
+}
+
+func (jsonCodec) Decode(payload json.RawMessage) (json.RawMessage, error) {
+	return payload, nil
+}
+
+type textCodec struct{}
+
+func (textCodec) Name() string { return CodecText }
+
+func (textCodec) Encode(text string) (json.RawMessage, error) {
+	if !utf8.ValidString(text) {
+		return nil, errors.New("text is not valid UTF-8")
+	}
+	return json.Marshal(text)
+}
+
+func (textCodec) Decode(payload json.RawMessage) (json.RawMessage, error) {
+	var text string
+	if err := json.Unmarshal(payload, &text); err != nil {
+		return nil, errors.New("payload is not a string")
+	}
+	return json.Marshal(text)
+}
+
+type base64Codec struct{}
+
+func (base64Codec) Name() string { return CodecBase64 }
+
+func (base64Codec) Encode(text string) (json.RawMessage, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(raw))
+}
+
+func (base64Codec) Decode(payload json.RawMessage) (json.RawMessage, error) {
+	raw, err := payloadBytes(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{"size": len(raw), "hex": hex.EncodeToString(raw)})
+}
+
+// binaryCodec turns the JSON value of the input text into bytes (and back),
+// carried on the wire as a base64 string.
+type binaryCodec struct {
+	name      string
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(raw []byte) (any, error)
+}
+
+func (c binaryCodec) Name() string { return c.name }
+
+func (c binaryCodec) Encode(text string) (json.RawMessage, error) {
+	v, err := parseJSONValue(normalizePayload(text))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(raw))
+}
+
+func (c binaryCodec) Decode(payload json.RawMessage) (json.RawMessage, error) {
+	raw, err := payloadBytes(payload)
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.unmarshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func gzipMarshal(v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipUnmarshal(raw []byte) (any, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zr.Close() }()
+	body, err := io.ReadAll(io.LimitReader(zr, maxGzipDecoded+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxGzipDecoded {
+		return nil, errors.New("gzip payload too large")
+	}
+	return parseJSONValue(body)
+}
+
+func payloadBytes(payload json.RawMessage) ([]byte, error) {
+	var text string
+	if err := json.Unmarshal(payload, &text); err != nil {
+		return nil, errors.New("payload is not a base64 string")
+	}
+	raw, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return raw, nil
+}
+
+func parseJSONValue(raw []byte) (any, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,326 @@
+package topicbus
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Minimal CBOR (RFC 8949) support for the JSON data model: integers, floats,
+// strings, arrays, maps, booleans and null. Byte strings decode to base64
+// text and tags are skipped.
+
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+
+	cborIndefinite = 31
+	cborBreak      = 0xff
+	maxCodecDepth  = 64
+)
+
+var errCodecTruncated = errors.New("payload truncated")
+
+func cborMarshal(v any) ([]byte, error) {
+	return cborAppend(nil, v, 0)
+}
+
+func cborAppend(buf []byte, v any, depth int) ([]byte, error) {
+	if depth > maxCodecDepth {
+		return nil, errors.New("payload nested too deeply")
+	}
+	switch t := v.(type) {
+	case nil:
+		return append(buf, 0xf6), nil
+	case bool:
+		if t {
+			return append(buf, 0xf5), nil
+		}
+		return append(buf, 0xf4), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(t.String(), 10, 64); err == nil {
+			if i >= 0 {
+				return cborHead(buf, cborUint, uint64(i)), nil
+			}
+			return cborHead(buf, cborNegInt, uint64(-1-i)), nil
+		}
+		if u, err := strconv.ParseUint(t.String(), 10, 64); err == nil {
+			return cborHead(buf, cborUint, u), nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, 0xfb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case string:
+		buf = cborHead(buf, cborText, uint64(len(t)))
+		return append(buf, t...), nil
+	case []any:
+		buf = cborHead(buf, cborArray, uint64(len(t)))
+		var err error
+		for _, item := range t {
+			if buf, err = cborAppend(buf, item, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf = cborHead(buf, cborMap, uint64(len(t)))
+		var err error
+		for _, k := range keys {
+			buf = cborHead(buf, cborText, uint64(len(k)))
+			buf = append(buf, k...)
+			if buf, err = cborAppend(buf, t[k], depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported type %T", v)
+	}
+}
+
+func cborHead(buf []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, m|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, m|27), n)
+	}
+}
+
+func cborUnmarshal(raw []byte) (any, error) {
+	d := cborDecoder{buf: raw}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.buf) {
+		return nil, errors.New("cbor: trailing bytes")
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, errCodecTruncated
+	}
+	out := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return out, nil
+}
+
+// head reads the initial byte and its argument. indefinite is true for
+// additional info 31.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, indefinite bool, err error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info == 24:
+		p, err := d.take(1)
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		return major, info, uint64(p[0]), false, nil
+	case info == 25:
+		p, err := d.take(2)
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		return major, info, uint64(binary.BigEndian.Uint16(p)), false, nil
+	case info == 26:
+		p, err := d.take(4)
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		return major, info, uint64(binary.BigEndian.Uint32(p)), false, nil
+	case info == 27:
+		p, err := d.take(8)
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		return major, info, binary.BigEndian.Uint64(p), false, nil
+	case info == cborIndefinite:
+		return major, info, 0, true, nil
+	default:
+		return 0, 0, 0, false, fmt.Errorf("cbor: reserved additional info %d", info)
+	}
+}
+
+func (d *cborDecoder) atBreak() bool {
+	if d.pos < len(d.buf) && d.buf[d.pos] == cborBreak {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > maxCodecDepth {
+		return nil, errors.New("payload nested too deeply")
+	}
+	major, info, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer out of range")
+		}
+		return json.Number(strconv.FormatInt(-1-int64(arg), 10)), nil
+	case cborBytes, cborText:
+		data, err := d.stringData(major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborBytes {
+			return base64.StdEncoding.EncodeToString(data), nil
+		}
+		return string(data), nil
+	case cborArray:
+		out := make([]any, 0)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.atBreak() {
+				break
+			}
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, item)
+		}
+		return out, nil
+	case cborMap:
+		out := make(map[string]any)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.atBreak() {
+				break
+			}
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			val, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := key.(string); ok {
+				out[s] = val
+			} else {
+				out[fmt.Sprint(key)] = val
+			}
+		}
+		return out, nil
+	case cborTag:
+		return d.value(depth + 1)
+	default:
+		return d.simple(info, arg)
+	}
+}
+
+func (d *cborDecoder) stringData(major byte, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return d.take(n)
+	}
+	var out []byte
+	for !d.atBreak() {
+		m, _, arg, ind, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m != major || ind {
+			return nil, errors.New("cbor: invalid indefinite string chunk")
+		}
+		chunk, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+func (d *cborDecoder) simple(info byte, arg uint64) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return jsonFloat(halfToFloat(uint16(arg)))
+	case 26:
+		return jsonFloat(float64(math.Float32frombits(uint32(arg))))
+	case 27:
+		return jsonFloat(math.Float64frombits(arg))
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", arg)
+	}
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
+
+func jsonFloat(f float64) (any, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errors.New("non-finite float cannot be represented in JSON")
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
@@ -0,0 +1,325 @@
+package topicbus
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Minimal MessagePack support for the JSON data model. bin values decode to
+// base64 text and ext values to {"ext": type, "data": base64}.
+
+func msgpackMarshal(v any) ([]byte, error) {
+	return msgpackAppend(nil, v, 0)
+}
+
+func msgpackAppend(buf []byte, v any, depth int) ([]byte, error) {
+	if depth > maxCodecDepth {
+		return nil, errors.New("payload nested too deeply")
+	}
+	switch t := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if t {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(t.String(), 10, 64); err == nil {
+			return msgpackInt(buf, i), nil
+		}
+		if u, err := strconv.ParseUint(t.String(), 10, 64); err == nil {
+			return binary.BigEndian.AppendUint64(append(buf, 0xcf), u), nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(f)), nil
+	case string:
+		n := len(t)
+		switch {
+		case n < 32:
+			buf = append(buf, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			buf = append(buf, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+		default:
+			buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+		}
+		return append(buf, t...), nil
+	case []any:
+		n := len(t)
+		switch {
+		case n < 16:
+			buf = append(buf, 0x90|byte(n))
+		case n <= math.MaxUint16:
+			buf = binary.BigEndian.AppendUint16(append(buf, 0xdc), uint16(n))
+		default:
+			buf = binary.BigEndian.AppendUint32(append(buf, 0xdd), uint32(n))
+		}
+		var err error
+		for _, item := range t {
+			if buf, err = msgpackAppend(buf, item, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]any:
+		n := len(t)
+		switch {
+		case n < 16:
+			buf = append(buf, 0x80|byte(n))
+		case n <= math.MaxUint16:
+			buf = binary.BigEndian.AppendUint16(append(buf, 0xde), uint16(n))
+		default:
+			buf = binary.BigEndian.AppendUint32(append(buf, 0xdf), uint32(n))
+		}
+		keys := make([]string, 0, n)
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			if buf, err = msgpackAppend(buf, k, depth+1); err != nil {
+				return nil, err
+			}
+			if buf, err = msgpackAppend(buf, t[k], depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+}
+
+func msgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 127:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(int8(i)))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(buf, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(i))
+	case i >= 0:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), uint64(i))
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(int32(i)))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(i))
+	}
+}
+
+func msgpackUnmarshal(raw []byte) (any, error) {
+	d := msgpackDecoder{buf: raw}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.buf) {
+		return nil, errors.New("msgpack: trailing bytes")
+	}
+	return v, nil
+}
+
+type msgpackDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *msgpackDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, errCodecTruncated
+	}
+	out := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return out, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	p, err := d.take(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(p[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(p)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(p)), nil
+	default:
+		return binary.BigEndian.Uint64(p), nil
+	}
+}
+
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > maxCodecDepth {
+		return nil, errors.New("payload nested too deeply")
+	}
+	p, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	b := p[0]
+	switch {
+	case b <= 0x7f:
+		return json.Number(strconv.Itoa(int(b))), nil
+	case b >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(b)))), nil
+	case b&0xf0 == 0x80:
+		return d.mapN(uint64(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return d.arrayN(uint64(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return d.str(uint64(b & 0x1f))
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		bits, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return jsonFloat(float64(math.Float32frombits(uint32(bits))))
+	case 0xcb:
+		bits, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return jsonFloat(math.Float64frombits(bits))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(u, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width.
+		shift := uint(64 - 8*size)
+		return json.Number(strconv.FormatInt(int64(u<<shift)>>shift, 10)), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(uint64(1) << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayN(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapN(n, depth)
+	default:
+		return nil, fmt.Errorf("msgpack: invalid type byte 0x%02x", b)
+	}
+}
+
+func (d *msgpackDecoder) str(n uint64) (any, error) {
+	data, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (d *msgpackDecoder) ext(n uint64) (any, error) {
+	typ, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"ext": json.Number(strconv.Itoa(int(int8(typ[0])))), "data": base64.StdEncoding.EncodeToString(data)}, nil
+}
+
+func (d *msgpackDecoder) arrayN(n uint64, depth int) (any, error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, errCodecTruncated
+	}
+	out := make([]any, 0, n)
+	for i := uint64(0); i < n; i++ {
+		item, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (d *msgpackDecoder) mapN(n uint64, depth int) (any, error) {
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, errCodecTruncated
+	}
+	out := make(map[string]any, n)
+	for i := uint64(0); i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		val, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := key.(string); ok {
+			out[s] = val
+		} else {
+			out[fmt.Sprint(key)] = val
+		}
+	}
+	return out, nil
+}
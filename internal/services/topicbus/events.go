@@ -14,6 +14,15 @@ import (
 
 const EventTopicBusEvent = "topicbus.event"
 
+// TopicBusEvent is a received publish together with its payload decoded by the
+// codec configured for the topic.
+type TopicBusEvent struct {
+	protocol.PublishReq
+	Codec       string          `json:"codec"`
+	Decoded     json.RawMessage `json:"decoded,omitempty"`
+	DecodeError string          `json:"decodeError,omitempty"`
+}
+
 type busToken struct {
 	name  string
 	token string
@@ -85,5 +94,19 @@ func (s *TopicBusService) handleFrame(payload []byte) {
 	if data.Topic == "" || data.Name == "" {
 		return
 	}
-	_ = s.bus.Publish(context.Background(), EventTopicBusEvent, data, nil)
+	s.observeStats(data)
+	s.deliverReply(data)
+	if !s.acceptPublish(data.Topic) {
+		return
+	}
+	s.dispatchRoutes(data)
+	evt := TopicBusEvent{PublishReq: data}
+	codec := s.codecFor(data.Topic)
+	evt.Codec = codec.Name()
+	if decoded, err := codec.Decode(data.Payload); err != nil {
+		evt.DecodeError = err.Error()
+	} else {
+		evt.Decoded = decoded
+	}
+	_ = s.bus.Publish(context.Background(), EventTopicBusEvent, evt, nil)
 }
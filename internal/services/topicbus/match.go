@@ -0,0 +1,64 @@
+package topicbus
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	topicLevelSep     = "/"
+	wildcardSingle    = "+"
+	wildcardMulti     = "#"
+	broadSubscription = "#"
+)
+
+// IsPattern reports whether topic contains MQTT-style wildcards.
+func IsPattern(topic string) bool {
+	return strings.Contains(topic, wildcardSingle) || strings.Contains(topic, wildcardMulti)
+}
+
+// ValidatePattern checks MQTT wildcard placement: "+" must occupy a whole level
+// and "#" must be the whole last level.
+func ValidatePattern(pattern string) error {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return errors.New("pattern is required")
+	}
+	levels := strings.Split(pattern, topicLevelSep)
+	for i, level := range levels {
+		if strings.Contains(level, wildcardMulti) {
+			if level != wildcardMulti || i != len(levels)-1 {
+				return errors.New("'#' must be the last level")
+			}
+		}
+		if strings.Contains(level, wildcardSingle) && level != wildcardSingle {
+			return errors.New("'+' must occupy a whole level")
+		}
+	}
+	return nil
+}
+
+// MatchTopic matches topic against an MQTT-style pattern.
+// "+" matches exactly one level, "#" matches the remaining levels (including none).
+func MatchTopic(pattern, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+	if !IsPattern(pattern) {
+		return false
+	}
+	pLevels := strings.Split(pattern, topicLevelSep)
+	tLevels := strings.Split(topic, topicLevelSep)
+	for i, p := range pLevels {
+		if p == wildcardMulti {
+			return true
+		}
+		if i >= len(tLevels) {
+			return false
+		}
+		if p != wildcardSingle && p != tLevels[i] {
+			return false
+		}
+	}
+	return len(pLevels) == len(tLevels)
+}
@@ -0,0 +1,319 @@
+package topicbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/topicbus"
+)
+
+const (
+	corrIDField           = "corr_id"
+	replyToField          = "reply_to"
+	replyDataField        = "data"
+	replyErrorField       = "error"
+	replyName             = "reply"
+	defaultRequestTimeout = 8 * time.Second
+)
+
+// RequestHandler answers a request received by a responder. The returned data
+// is sent back as the "data" field of the reply; an error becomes "error".
+type RequestHandler func(req topicbus.PublishReq, data json.RawMessage) (json.RawMessage, error)
+
+type RequestReply struct {
+	Topic   string          `json:"topic"`
+	Name    string          `json:"name"`
+	TS      int64           `json:"ts"`
+	CorrID  string          `json:"corrId"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type replySub struct {
+	refs     int
+	owned    bool
+	sourceID uint32
+	targetID uint32
+}
+
+type responder struct {
+	topic    string
+	sourceID uint32
+	targetID uint32
+	routeID  string
+}
+
+type envelope struct {
+	CorrID  string          `json:"corr_id"`
+	ReplyTo string          `json:"reply_to"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+}
+
+// Request publishes payloadText on topic with a correlation id and reply topic
+// injected, then waits for the matching publish on replyTopic. The reply topic is
+// subscribed for the duration of the call unless it already was.
+func (s *TopicBusService) Request(ctx context.Context, sourceID, targetID uint32, topic, name, payloadText, replyTopic string, timeout time.Duration) (RequestReply, error) {
+	replyTopic = strings.TrimSpace(replyTopic)
+	if replyTopic == "" {
+		return RequestReply{}, errors.New("reply topic is required")
+	}
+	if IsPattern(replyTopic) {
+		return RequestReply{}, errors.New("reply topic must not contain wildcards")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	corrID, err := newCorrID()
+	if err != nil {
+		return RequestReply{}, err
+	}
+	payload, err := injectCorrelation(normalizePayload(payloadText), corrID, replyTopic)
+	if err != nil {
+		return RequestReply{}, err
+	}
+
+	ch := make(chan topicbus.PublishReq, 1)
+	s.mu.Lock()
+	if s.pending == nil {
+		s.pending = make(map[string]chan topicbus.PublishReq)
+	}
+	s.pending[corrID] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, corrID)
+		s.mu.Unlock()
+	}()
+
+	if err := s.acquireReplyTopic(ctx, sourceID, targetID, replyTopic); err != nil {
+		return RequestReply{}, err
+	}
+	defer s.releaseReplyTopic(replyTopic)
+
+	// The envelope is always plain JSON so any responder can read it,
+	// whatever codec is configured for the topic.
+	if err := s.PublishRaw(ctx, sourceID, targetID, topic, name, payload); err != nil {
+		return RequestReply{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		if s.logs != nil {
+			s.logs.Appendf("warn", "topicbus request timed out topic=%s corr_id=%s", strings.TrimSpace(topic), corrID)
+		}
+		return RequestReply{}, fmt.Errorf("topicbus request: %w", toUIError(ctx.Err()))
+	case msg := <-ch:
+		env, _ := s.decodeEnvelope(msg)
+		if strings.TrimSpace(env.Error) != "" {
+			return RequestReply{}, errors.New(strings.TrimSpace(env.Error))
+		}
+		return RequestReply{Topic: msg.Topic, Name: msg.Name, TS: msg.TS, CorrID: corrID, Data: env.Data, Payload: msg.Payload}, nil
+	}
+}
+
+func (s *TopicBusService) RequestSimple(sourceID, targetID uint32, topic, name, payloadText, replyTopic string, timeoutMs int) (RequestReply, error) {
+	return s.Request(context.Background(), sourceID, targetID, topic, name, payloadText, replyTopic, time.Duration(timeoutMs)*time.Millisecond)
+}
+
+// Respond subscribes topic and answers every request carrying corr_id and
+// reply_to with handler's result. Handlers run on their own goroutine.
+func (s *TopicBusService) Respond(ctx context.Context, sourceID, targetID uint32, topic string, handler RequestHandler) (string, error) {
+	topic = strings.TrimSpace(topic)
+	if topic == "" {
+		return "", errors.New("topic is required")
+	}
+	if handler == nil {
+		return "", errors.New("handler is required")
+	}
+	if _, err := s.SubscribePattern(ctx, sourceID, targetID, topic, nil); err != nil {
+		return "", err
+	}
+	routeID, err := s.Route(topic, func(msg topicbus.PublishReq) {
+		env, ok := s.decodeEnvelope(msg)
+		if !ok {
+			return
+		}
+		env.CorrID = strings.TrimSpace(env.CorrID)
+		env.ReplyTo = strings.TrimSpace(env.ReplyTo)
+		if env.CorrID == "" || env.ReplyTo == "" {
+			return
+		}
+		if len(env.Data) == 0 {
+			env.Data = msg.Payload
+		}
+		go s.answer(sourceID, targetID, msg, env, handler)
+	})
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	if s.responders == nil {
+		s.responders = make(map[string]responder)
+	}
+	s.responders[routeID] = responder{topic: topic, sourceID: sourceID, targetID: targetID, routeID: routeID}
+	s.mu.Unlock()
+	return routeID, nil
+}
+
+func (s *TopicBusService) StopResponder(ctx context.Context, responderID string) error {
+	responderID = strings.TrimSpace(responderID)
+	s.mu.Lock()
+	r, ok := s.responders[responderID]
+	delete(s.responders, responderID)
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("responder not found")
+	}
+	s.Unroute(r.routeID)
+	// SubscribePattern subscribes a plain topic directly, without recording a
+	// pattern, so it has to be released the same way.
+	if !IsPattern(r.topic) {
+		_, err := s.Unsubscribe(ctx, r.sourceID, r.targetID, r.topic)
+		return err
+	}
+	return s.UnsubscribePattern(ctx, r.topic)
+}
+
+func (s *TopicBusService) answer(sourceID, targetID uint32, req topicbus.PublishReq, env envelope, handler RequestHandler) {
+	reply := map[string]any{corrIDField: env.CorrID}
+	data, err := handler(req, env.Data)
+	if err != nil {
+		reply[replyErrorField] = err.Error()
+	} else if len(data) > 0 {
+		reply[replyDataField] = data
+	}
+	body, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	if err := s.PublishRaw(context.Background(), sourceID, targetID, env.ReplyTo, replyName, body); err != nil && s.logs != nil {
+		s.logs.Appendf("warn", "topicbus reply failed topic=%s corr_id=%s: %v", env.ReplyTo, env.CorrID, err)
+	}
+}
+
+// deliverReply hands a publish to a pending Request when its corr_id matches.
+func (s *TopicBusService) deliverReply(msg topicbus.PublishReq) {
+	s.mu.RLock()
+	if len(s.pending) == 0 || s.replySubs[msg.Topic] == nil {
+		s.mu.RUnlock()
+		return
+	}
+	s.mu.RUnlock()
+	env, ok := s.decodeEnvelope(msg)
+	if !ok || env.CorrID == "" {
+		return
+	}
+	s.mu.RLock()
+	ch := s.pending[env.CorrID]
+	s.mu.RUnlock()
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- msg:
+	default:
+	}
+}
+
+func (s *TopicBusService) acquireReplyTopic(ctx context.Context, sourceID, targetID uint32, topic string) error {
+	s.mu.Lock()
+	if s.replySubs == nil {
+		s.replySubs = make(map[string]*replySub)
+	}
+	sub := s.replySubs[topic]
+	if sub != nil {
+		sub.refs++
+		s.mu.Unlock()
+		return nil
+	}
+	needSubscribe := !s.exact[topic]
+	s.replySubs[topic] = &replySub{refs: 1, owned: needSubscribe, sourceID: sourceID, targetID: targetID}
+	s.mu.Unlock()
+	if !needSubscribe {
+		return nil
+	}
+	if _, err := s.Subscribe(ctx, sourceID, targetID, topic); err != nil {
+		s.mu.Lock()
+		delete(s.replySubs, topic)
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *TopicBusService) releaseReplyTopic(topic string) {
+	s.mu.Lock()
+	sub := s.replySubs[topic]
+	if sub == nil {
+		s.mu.Unlock()
+		return
+	}
+	sub.refs--
+	if sub.refs > 0 {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.replySubs, topic)
+	s.mu.Unlock()
+	if !sub.owned {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTopicBusTimeout)
+	defer cancel()
+	_, _ = s.Unsubscribe(ctx, sub.sourceID, sub.targetID, topic)
+}
+
+// decodeEnvelope reads a request or reply envelope. Envelopes we send are
+// plain JSON; peers that publish through the topic codec are decoded with it.
+func (s *TopicBusService) decodeEnvelope(msg topicbus.PublishReq) (envelope, bool) {
+	var env envelope
+	if err := json.Unmarshal(msg.Payload, &env); err == nil && env.CorrID != "" {
+		return env, true
+	}
+	decoded, err := s.codecFor(msg.Topic).Decode(msg.Payload)
+	if err != nil {
+		return env, false
+	}
+	var viaCodec envelope
+	if err := json.Unmarshal(decoded, &viaCodec); err != nil {
+		return env, false
+	}
+	return viaCodec, true
+}
+
+// injectCorrelation adds corr_id/reply_to to a JSON object payload, or wraps any
+// other payload as {"corr_id":..,"reply_to":..,"data":payload}.
+func injectCorrelation(payload json.RawMessage, corrID, replyTo string) (json.RawMessage, error) {
+	obj := map[string]json.RawMessage{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &obj); err != nil || obj == nil {
+			obj = map[string]json.RawMessage{replyDataField: payload}
+		}
+	}
+	corr, _ := json.Marshal(corrID)
+	reply, _ := json.Marshal(replyTo)
+	obj[corrIDField] = corr
+	obj[replyToField] = reply
+	return json.Marshal(obj)
+}
+
+func newCorrID() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
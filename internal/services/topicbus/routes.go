@@ -0,0 +1,302 @@
+package topicbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/topicbus"
+)
+
+const (
+	PatternModeHub      = "hub"
+	PatternModeExpanded = "expanded"
+	PatternModeBroad    = "broad"
+)
+
+// TopicHandler receives publishes matching a routed pattern. It runs on the
+// event bus goroutine and must not block.
+type TopicHandler func(msg topicbus.PublishReq)
+
+type PatternSub struct {
+	Pattern  string   `json:"pattern"`
+	Mode     string   `json:"mode"`
+	Topics   []string `json:"topics"`
+	SourceID uint32   `json:"sourceId"`
+	TargetID uint32   `json:"targetId"`
+}
+
+type topicRoute struct {
+	id      string
+	pattern string
+	handler TopicHandler
+}
+
+// SubscribePattern subscribes to an MQTT-style pattern. The pattern is first sent
+// to the hub as-is; if the hub rejects it, the matching candidates are subscribed
+// instead, and with no candidates a broad "#" subscription is used as the last
+// resort. In the fallback modes handleFrame filters publishes locally.
+// Subscribing a pattern that is already subscribed returns the existing sub.
+func (s *TopicBusService) SubscribePattern(ctx context.Context, sourceID, targetID uint32, pattern string, candidates []string) (PatternSub, error) {
+	pattern = strings.TrimSpace(pattern)
+	if err := ValidatePattern(pattern); err != nil {
+		return PatternSub{}, err
+	}
+	if !IsPattern(pattern) {
+		if _, err := s.Subscribe(ctx, sourceID, targetID, pattern); err != nil {
+			return PatternSub{}, err
+		}
+		return PatternSub{Pattern: pattern, Mode: PatternModeHub, Topics: []string{pattern}, SourceID: sourceID, TargetID: targetID}, nil
+	}
+	s.mu.RLock()
+	existing, ok := s.patterns[pattern]
+	s.mu.RUnlock()
+	if ok {
+		return existing, nil
+	}
+
+	sub := PatternSub{Pattern: pattern, SourceID: sourceID, TargetID: targetID}
+	if _, err := s.subscribe(ctx, sourceID, targetID, pattern); err == nil {
+		sub.Mode = PatternModeHub
+		sub.Topics = []string{pattern}
+	} else {
+		matched := make([]string, 0, len(candidates))
+		for _, topic := range normalizeTopics(candidates) {
+			if !IsPattern(topic) && MatchTopic(pattern, topic) {
+				matched = append(matched, topic)
+			}
+		}
+		if len(matched) > 0 {
+			if s.logs != nil {
+				s.logs.Appendf("warn", "topicbus hub rejected pattern %s, subscribing %d matching topics: %v", pattern, len(matched), err)
+			}
+			if _, err := s.subscribeBatch(ctx, sourceID, targetID, matched); err != nil {
+				return PatternSub{}, err
+			}
+			sub.Mode = PatternModeExpanded
+			sub.Topics = matched
+		} else {
+			if s.logs != nil {
+				s.logs.Appendf("warn", "topicbus hub rejected pattern %s, subscribing broadly and filtering locally: %v", pattern, err)
+			}
+			if _, err := s.subscribe(ctx, sourceID, targetID, broadSubscription); err != nil {
+				return PatternSub{}, err
+			}
+			sub.Mode = PatternModeBroad
+			sub.Topics = []string{broadSubscription}
+		}
+	}
+
+	s.mu.Lock()
+	if s.patterns == nil {
+		s.patterns = make(map[string]PatternSub)
+	}
+	if existing, ok := s.patterns[pattern]; ok {
+		// A concurrent call won the race; drop what this one subscribed.
+		topics := s.unheldTopicsLocked(sub.Topics)
+		s.mu.Unlock()
+		_ = s.unsubscribeTopics(ctx, sub.SourceID, sub.TargetID, topics)
+		return existing, nil
+	}
+	s.patterns[pattern] = sub
+	s.mu.Unlock()
+	return sub, nil
+}
+
+func (s *TopicBusService) SubscribePatternSimple(sourceID, targetID uint32, pattern string, candidates []string) (PatternSub, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTopicBusTimeout)
+	defer cancel()
+	return s.SubscribePattern(ctx, sourceID, targetID, pattern, candidates)
+}
+
+// UnsubscribePattern drops a pattern subscription. Expanded topics that are
+// still held by an explicit subscription or another pattern stay subscribed
+// on the hub.
+func (s *TopicBusService) UnsubscribePattern(ctx context.Context, pattern string) error {
+	pattern = strings.TrimSpace(pattern)
+	s.mu.Lock()
+	sub, ok := s.patterns[pattern]
+	if ok {
+		delete(s.patterns, pattern)
+	}
+	topics := s.unheldTopicsLocked(sub.Topics)
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("pattern not subscribed")
+	}
+	return s.unsubscribeTopics(ctx, sub.SourceID, sub.TargetID, topics)
+}
+
+// unsubscribeTopics drops pattern-owned topics on the hub.
+func (s *TopicBusService) unsubscribeTopics(ctx context.Context, sourceID, targetID uint32, topics []string) error {
+	switch len(topics) {
+	case 0:
+		return nil
+	case 1:
+		_, err := s.unsubscribe(ctx, sourceID, targetID, topics[0])
+		return err
+	default:
+		_, err := s.unsubscribeBatch(ctx, sourceID, targetID, topics)
+		return err
+	}
+}
+
+func (s *TopicBusService) UnsubscribePatternSimple(pattern string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTopicBusTimeout)
+	defer cancel()
+	return s.UnsubscribePattern(ctx, pattern)
+}
+
+func (s *TopicBusService) PatternSubs() ([]PatternSub, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]PatternSub, 0, len(s.patterns))
+	for _, sub := range s.patterns {
+		out = append(out, sub)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Pattern < out[j].Pattern })
+	return out, nil
+}
+
+// Route registers a handler for publishes whose topic matches pattern. Several
+// consumers may route the same pattern; each gets its own route id.
+func (s *TopicBusService) Route(pattern string, handler TopicHandler) (string, error) {
+	pattern = strings.TrimSpace(pattern)
+	if err := ValidatePattern(pattern); err != nil {
+		return "", err
+	}
+	if handler == nil {
+		return "", errors.New("handler is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routeSeq++
+	id := fmt.Sprintf("route-%d", s.routeSeq)
+	s.routes = append(s.routes, topicRoute{id: id, pattern: pattern, handler: handler})
+	return id, nil
+}
+
+func (s *TopicBusService) Unroute(routeID string) {
+	routeID = strings.TrimSpace(routeID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.routes {
+		if r.id == routeID {
+			s.routes = append(s.routes[:i:i], s.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// acceptPublish reports whether a received publish should be surfaced. While a
+// broad fallback subscription is active, only topics covered by an explicit
+// subscription or pattern pass.
+func (s *TopicBusService) acceptPublish(topic string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	broad := false
+	for _, sub := range s.patterns {
+		if sub.Mode == PatternModeBroad {
+			broad = true
+			break
+		}
+	}
+	if !broad || s.exact[topic] || s.exact[broadSubscription] {
+		return true
+	}
+	for pattern := range s.patterns {
+		if MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TopicBusService) dispatchRoutes(msg topicbus.PublishReq) {
+	s.mu.RLock()
+	handlers := make([]TopicHandler, 0, len(s.routes))
+	for _, r := range s.routes {
+		if MatchTopic(r.pattern, msg.Topic) {
+			handlers = append(handlers, r.handler)
+		}
+	}
+	s.mu.RUnlock()
+	for _, h := range handlers {
+		h(msg)
+	}
+}
+
+func (s *TopicBusService) trackExact(topics []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exact == nil {
+		s.exact = make(map[string]bool)
+	}
+	for _, topic := range topics {
+		if topic != "" {
+			s.exact[topic] = true
+		}
+	}
+}
+
+// releaseExact forgets explicit subscriptions and returns the topics no
+// pattern still holds, i.e. the ones to unsubscribe on the hub.
+func (s *TopicBusService) releaseExact(topics []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, topic := range topics {
+		delete(s.exact, topic)
+	}
+	return s.unheldTopicsLocked(topics)
+}
+
+// unheldTopicsLocked returns the topics no explicit subscription or pattern
+// still holds.
+func (s *TopicBusService) unheldTopicsLocked(topics []string) []string {
+	out := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if !s.topicHeldLocked(topic) {
+			out = append(out, topic)
+		}
+	}
+	return out
+}
+
+// topicHeldLocked reports whether topic is still wanted by an explicit
+// subscription or by any pattern, whatever its mode.
+func (s *TopicBusService) topicHeldLocked(topic string) bool {
+	if s.exact[topic] {
+		return true
+	}
+	for _, sub := range s.patterns {
+		for _, held := range sub.Topics {
+			if held == topic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SubscriptionCount is the number of exact topics and patterns currently
+// subscribed through this service.
+func (s *TopicBusService) SubscriptionCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.exact) + len(s.patterns)
+}
+
+// Subscribed reports whether topic, or a pattern with exactly this text, is
+// currently subscribed through this service.
+func (s *TopicBusService) Subscribed(topic string) bool {
+	topic = strings.TrimSpace(topic)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.exact[topic] {
+		return true
+	}
+	_, ok := s.patterns[topic]
+	return ok
+}
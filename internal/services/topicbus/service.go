@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	corebus "github.com/yttydcs/myflowhub-core/eventbus"
@@ -23,19 +24,49 @@ type TopicBusService struct {
 	bus     corebus.IBus
 
 	busTokens []busToken
+
+	mu       sync.RWMutex
+	exact    map[string]bool
+	patterns map[string]PatternSub
+	routes   []topicRoute
+	routeSeq uint64
+
+	pending    map[string]chan topicbus.PublishReq
+	replySubs  map[string]*replySub
+	responders map[string]responder
+
+	codecs      map[string]PayloadCodec
+	topicCodecs map[string]string
+
+	statsMu     sync.Mutex
+	stats       map[string]*topicStats
+	statsCancel context.CancelFunc
 }
 
 func New(session *sessionsvc.SessionService, logsSvc *logs.LogService, bus corebus.IBus) *TopicBusService {
-	svc := &TopicBusService{session: session, logs: logsSvc, bus: bus}
+	svc := &TopicBusService{session: session, logs: logsSvc, bus: bus, codecs: builtinCodecs()}
 	svc.bindBus()
+	svc.startStatsTicker()
 	return svc
 }
 
 func (s *TopicBusService) Close() {
+	s.stopStatsTicker()
 	s.unbindBus()
 }
 
 func (s *TopicBusService) Subscribe(ctx context.Context, sourceID, targetID uint32, topic string) (topicbus.Resp, error) {
+	resp, err := s.subscribe(ctx, sourceID, targetID, topic)
+	if err != nil {
+		return topicbus.Resp{}, err
+	}
+	s.trackExact([]string{strings.TrimSpace(topic)})
+	return resp, nil
+}
+
+// subscribe sends the subscription without recording it as explicit, for
+// subscriptions owned by a pattern.
+func (s *TopicBusService) subscribe(ctx context.Context, sourceID, targetID uint32, topic string) (topicbus.Resp, error) {
 	topic = strings.TrimSpace(topic)
 	if topic == "" {
 		return topicbus.Resp{}, errors.New("topic is required")
@@ -58,6 +89,15 @@ func (s *TopicBusService) SubscribeSimple(sourceID, targetID uint32, topic strin
 }
 
 func (s *TopicBusService) SubscribeBatch(ctx context.Context, sourceID, targetID uint32, topics []string) (topicbus.Resp, error) {
+	resp, err := s.subscribeBatch(ctx, sourceID, targetID, topics)
+	if err != nil {
+		return topicbus.Resp{}, err
+	}
+	s.trackExact(normalizeTopics(topics))
+	return resp, nil
+}
+
+func (s *TopicBusService) subscribeBatch(ctx context.Context, sourceID, targetID uint32, topics []string) (topicbus.Resp, error) {
 	topics = normalizeTopics(topics)
 	if len(topics) == 0 {
 		return topicbus.Resp{}, errors.New("topics are required")
@@ -79,7 +119,17 @@ func (s *TopicBusService) SubscribeBatchSimple(sourceID, targetID uint32, topics
 	return s.SubscribeBatch(ctx, sourceID, targetID, topics)
 }
 
+// Unsubscribe drops an explicit subscription. A topic that a pattern still
+// holds stays subscribed on the hub.
 func (s *TopicBusService) Unsubscribe(ctx context.Context, sourceID, targetID uint32, topic string) (topicbus.Resp, error) {
+	topic = strings.TrimSpace(topic)
+	if topic != "" && len(s.releaseExact([]string{topic})) == 0 {
+		return topicbus.Resp{Code: 1, Topic: topic}, nil
+	}
+	return s.unsubscribe(ctx, sourceID, targetID, topic)
+}
+
+func (s *TopicBusService) unsubscribe(ctx context.Context, sourceID, targetID uint32, topic string) (topicbus.Resp, error) {
 	topic = strings.TrimSpace(topic)
 	if topic == "" {
 		return topicbus.Resp{}, errors.New("topic is required")
@@ -102,6 +152,18 @@ func (s *TopicBusService) UnsubscribeSimple(sourceID, targetID uint32, topic str
 }
 
 func (s *TopicBusService) UnsubscribeBatch(ctx context.Context, sourceID, targetID uint32, topics []string) (topicbus.Resp, error) {
+	topics = normalizeTopics(topics)
+	if len(topics) > 0 {
+		release := s.releaseExact(topics)
+		if len(release) == 0 {
+			return topicbus.Resp{Code: 1, Topics: topics}, nil
+		}
+		topics = release
+	}
+	return s.unsubscribeBatch(ctx, sourceID, targetID, topics)
+}
+
+func (s *TopicBusService) unsubscribeBatch(ctx context.Context, sourceID, targetID uint32, topics []string) (topicbus.Resp, error) {
 	topics = normalizeTopics(topics)
 	if len(topics) == 0 {
 		return topicbus.Resp{}, errors.New("topics are required")
@@ -150,7 +212,28 @@ func (s *TopicBusService) Publish(ctx context.Context, sourceID, targetID uint32
 	if name == "" {
 		return errors.New("name is required")
 	}
-	payload := normalizePayload(payloadText)
+	payload, err := s.EncodePayload(topic, payloadText)
+	if err != nil {
+		return err
+	}
+	return s.publishRaw(ctx, sourceID, targetID, topic, name, payload)
+}
+
+// PublishRaw sends payload as it is, without running the topic codec. It is
+// meant for payloads that are already in wire form, such as recorded ones.
+func (s *TopicBusService) PublishRaw(ctx context.Context, sourceID, targetID uint32, topic, name string, payload json.RawMessage) error {
+	topic = strings.TrimSpace(topic)
+	if topic == "" {
+		return errors.New("topic is required")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+	return s.publishRaw(ctx, sourceID, targetID, topic, name, payload)
+}
+
+func (s *TopicBusService) publishRaw(ctx context.Context, sourceID, targetID uint32, topic, name string, payload json.RawMessage) error {
 	data := topicbus.PublishReq{
 		Topic:   topic,
 		Name:    name,
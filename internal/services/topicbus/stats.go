@@ -0,0 +1,299 @@
+package topicbus
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/topicbus"
+)
+
+const (
+	EventTopicBusStats = "topicbus.stats"
+
+	statsWindowSec = 10
+	statsEmitTick  = time.Second
+	maxStatsTopics = 1000
+	maxStatsNames  = 100
+	// Smoothing factor of the RFC 3550 style jitter and the latency average.
+	statsSmoothing = 16.0
+)
+
+// sizeBucketBounds are the upper bounds (inclusive, bytes) of the payload size
+// histogram. A final bucket counts everything larger.
+var sizeBucketBounds = []int{64, 256, 1024, 4096, 16384, 65536}
+
+type SizeBucket struct {
+	// LE is the inclusive upper bound in bytes; -1 means unbounded.
+	LE    int   `json:"le"`
+	Count int64 `json:"count"`
+}
+
+type StatCounters struct {
+	Messages      int64        `json:"messages"`
+	Bytes         int64        `json:"bytes"`
+	MsgPerSec     float64      `json:"msgPerSec"`
+	BytesPerSec   float64      `json:"bytesPerSec"`
+	SizeHistogram []SizeBucket `json:"sizeHistogram"`
+	LastSeen      time.Time    `json:"lastSeen"`
+	JitterMs      float64      `json:"jitterMs"`
+	LatencyMs     float64      `json:"latencyMs"`
+	LastLatencyMs int64        `json:"lastLatencyMs"`
+}
+
+type NameStat struct {
+	Name string `json:"name"`
+	StatCounters
+}
+
+type TopicStat struct {
+	Topic string `json:"topic"`
+	StatCounters
+	Names []NameStat `json:"names"`
+}
+
+type rateBucket struct {
+	sec   int64
+	msgs  int64
+	bytes int64
+}
+
+type statCounter struct {
+	window     [statsWindowSec]rateBucket
+	messages   int64
+	bytes      int64
+	hist       [7]int64
+	lastSeen   time.Time
+	lastGapMs  float64
+	hasGap     bool
+	jitterMs   float64
+	latencyMs  float64
+	hasLatency bool
+	lastLatMs  int64
+}
+
+type topicStats struct {
+	statCounter
+	names map[string]*statCounter
+}
+
+func (c *statCounter) observe(now time.Time, size int, ts int64) {
+	sec := now.Unix()
+	b := &c.window[sec%statsWindowSec]
+	if b.sec != sec {
+		*b = rateBucket{sec: sec}
+	}
+	b.msgs++
+	b.bytes += int64(size)
+	c.messages++
+	c.bytes += int64(size)
+	c.hist[sizeBucket(size)]++
+
+	if !c.lastSeen.IsZero() {
+		gap := float64(now.Sub(c.lastSeen)) / float64(time.Millisecond)
+		if c.hasGap {
+			c.jitterMs += (math.Abs(gap-c.lastGapMs) - c.jitterMs) / statsSmoothing
+		}
+		c.lastGapMs = gap
+		c.hasGap = true
+	}
+	c.lastSeen = now
+
+	if ts > 0 {
+		lat := now.UnixMilli() - ts
+		c.lastLatMs = lat
+		if c.hasLatency {
+			c.latencyMs += (float64(lat) - c.latencyMs) / statsSmoothing
+		} else {
+			c.latencyMs = float64(lat)
+			c.hasLatency = true
+		}
+	}
+}
+
+func (c *statCounter) snapshot(now time.Time) StatCounters {
+	out := StatCounters{
+		Messages:      c.messages,
+		Bytes:         c.bytes,
+		LastSeen:      c.lastSeen,
+		JitterMs:      c.jitterMs,
+		LatencyMs:     c.latencyMs,
+		LastLatencyMs: c.lastLatMs,
+		SizeHistogram: make([]SizeBucket, 0, len(c.hist)),
+	}
+	cutoff := now.Unix() - statsWindowSec
+	var msgs, bytes int64
+	for _, b := range c.window {
+		if b.sec > cutoff {
+			msgs += b.msgs
+			bytes += b.bytes
+		}
+	}
+	out.MsgPerSec = float64(msgs) / statsWindowSec
+	out.BytesPerSec = float64(bytes) / statsWindowSec
+	for i, count := range c.hist {
+		le := -1
+		if i < len(sizeBucketBounds) {
+			le = sizeBucketBounds[i]
+		}
+		out.SizeHistogram = append(out.SizeHistogram, SizeBucket{LE: le, Count: count})
+	}
+	return out
+}
+
+func sizeBucket(size int) int {
+	for i, bound := range sizeBucketBounds {
+		if size <= bound {
+			return i
+		}
+	}
+	return len(sizeBucketBounds)
+}
+
+// TopicStats returns rolling statistics for every topic seen since the last
+// reset, busiest first. Rates cover the last 10 seconds; latency compares the
+// publisher's TS with the local receive time and so includes clock skew.
+func (s *TopicBusService) TopicStats() ([]TopicStat, error) {
+	return s.statsSnapshot(time.Now()), nil
+}
+
+func (s *TopicBusService) ResetTopicStats() error {
+	s.statsMu.Lock()
+	s.stats = nil
+	s.statsMu.Unlock()
+	s.emitStats()
+	return nil
+}
+
+func (s *TopicBusService) observeStats(msg topicbus.PublishReq) {
+	now := time.Now()
+	s.statsMu.Lock()
+	if s.stats == nil {
+		s.stats = make(map[string]*topicStats)
+	}
+	ts := s.stats[msg.Topic]
+	if ts == nil {
+		if len(s.stats) >= maxStatsTopics {
+			s.evictStatsLocked()
+		}
+		ts = &topicStats{names: make(map[string]*statCounter)}
+		s.stats[msg.Topic] = ts
+	}
+	nc := ts.names[msg.Name]
+	if nc == nil {
+		if len(ts.names) >= maxStatsNames {
+			ts.evictNameLocked()
+		}
+		nc = &statCounter{}
+		ts.names[msg.Name] = nc
+	}
+	size := len(msg.Payload)
+	ts.observe(now, size, msg.TS)
+	nc.observe(now, size, msg.TS)
+	s.statsMu.Unlock()
+}
+
+// startStatsTicker emits the stats every statsEmitTick while any topic had
+// traffic within the rate window, plus once more after it goes quiet so the
+// rates drop to zero.
+func (s *TopicBusService) startStatsTicker() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.statsCancel = cancel
+	go func() {
+		ticker := time.NewTicker(statsEmitTick)
+		defer ticker.Stop()
+		live := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				active := s.statsActive(now)
+				if active || live {
+					s.emitStats()
+				}
+				live = active
+			}
+		}
+	}()
+}
+
+func (s *TopicBusService) stopStatsTicker() {
+	if s.statsCancel != nil {
+		s.statsCancel()
+	}
+}
+
+// statsActive reports whether any topic has messages inside the rate window.
+func (s *TopicBusService) statsActive(now time.Time) bool {
+	cutoff := now.Unix() - statsWindowSec
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	for _, ts := range s.stats {
+		for _, b := range ts.window {
+			if b.sec > cutoff && b.msgs > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evictStatsLocked drops the topic that has been quiet the longest.
+func (s *TopicBusService) evictStatsLocked() {
+	oldest := ""
+	var oldestSeen time.Time
+	for topic, ts := range s.stats {
+		if oldest == "" || ts.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = topic, ts.lastSeen
+		}
+	}
+	delete(s.stats, oldest)
+}
+
+// evictNameLocked drops the name under a topic that has been quiet the
+// longest.
+func (ts *topicStats) evictNameLocked() {
+	oldest := ""
+	var oldestSeen time.Time
+	for name, nc := range ts.names {
+		if oldest == "" || nc.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = name, nc.lastSeen
+		}
+	}
+	delete(ts.names, oldest)
+}
+
+func (s *TopicBusService) statsSnapshot(now time.Time) []TopicStat {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	out := make([]TopicStat, 0, len(s.stats))
+	for topic, ts := range s.stats {
+		stat := TopicStat{Topic: topic, StatCounters: ts.snapshot(now), Names: make([]NameStat, 0, len(ts.names))}
+		for name, nc := range ts.names {
+			stat.Names = append(stat.Names, NameStat{Name: name, StatCounters: nc.snapshot(now)})
+		}
+		sort.Slice(stat.Names, func(i, j int) bool {
+			if stat.Names[i].MsgPerSec != stat.Names[j].MsgPerSec {
+				return stat.Names[i].MsgPerSec > stat.Names[j].MsgPerSec
+			}
+			return stat.Names[i].Name < stat.Names[j].Name
+		})
+		out = append(out, stat)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].MsgPerSec != out[j].MsgPerSec {
+			return out[i].MsgPerSec > out[j].MsgPerSec
+		}
+		return out[i].Topic < out[j].Topic
+	})
+	return out
+}
+
+func (s *TopicBusService) emitStats() {
+	if s == nil || s.bus == nil {
+		return
+	}
+	_ = s.bus.Publish(context.Background(), EventTopicBusStats, s.statsSnapshot(time.Now()), nil)
+}
@@ -0,0 +1,71 @@
+package topology
+
+const EventTopologyChanged = "topology.changed"
+
+// TopologyNode is one node in a crawled graph. HubID is the hub the node is
+// attached to, which is its parent for every node except the root. A Stale
+// node was not reached because listing one of its ancestors failed, so its
+// data is carried over from the previous crawl.
+type TopologyNode struct {
+	NodeID      uint32            `json:"nodeId"`
+	ParentID    uint32            `json:"parentId"`
+	HubID       uint32            `json:"hubId"`
+	Depth       int               `json:"depth"`
+	IsHub       bool              `json:"isHub"`
+	Children    []uint32          `json:"children"`
+	Items       map[string]string `json:"items,omitempty"`
+	InfoAt      int64             `json:"infoAt,omitempty"`
+	InfoError   string            `json:"infoError,omitempty"`
+	ListError   string            `json:"listError,omitempty"`
+	Stale       bool              `json:"stale,omitempty"`
+	FirstSeenAt int64             `json:"firstSeenAt"`
+	LastSeenAt  int64             `json:"lastSeenAt"`
+}
+
+type TopologyEdge struct {
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+}
+
+type TopologyGraph struct {
+	RootID      uint32         `json:"rootId"`
+	CrawledAt   int64          `json:"crawledAt"`
+	DurationMs  int64          `json:"durationMs"`
+	Errors      int            `json:"errors"`
+	Truncated   bool           `json:"truncated"`
+	IncludeInfo bool           `json:"includeInfo"`
+	Nodes       []TopologyNode `json:"nodes"`
+	Edges       []TopologyEdge `json:"edges"`
+}
+
+type TopologyMove struct {
+	NodeID     uint32 `json:"nodeId"`
+	FromParent uint32 `json:"fromParent"`
+	ToParent   uint32 `json:"toParent"`
+}
+
+// TopologyChange is published on EventTopologyChanged when a crawl finds
+// nodes that appeared, disappeared or moved since the previous crawl of the
+// same root.
+type TopologyChange struct {
+	RootID  uint32         `json:"rootId"`
+	At      int64          `json:"at"`
+	Nodes   int            `json:"nodes"`
+	Added   []uint32       `json:"added"`
+	Removed []uint32       `json:"removed"`
+	Moved   []TopologyMove `json:"moved"`
+}
+
+// CrawlOptions tunes a crawl. Zero values pick the defaults. A cached graph
+// younger than MaxAgeMs is returned without touching the network unless Force
+// is set; NodeInfo items are refetched only when older than InfoTTLMs. Crawls
+// with MaxDepth or MaxNodes below the defaults are never cached.
+type CrawlOptions struct {
+	Force       bool  `json:"force"`
+	IncludeInfo bool  `json:"includeInfo"`
+	MaxAgeMs    int64 `json:"maxAgeMs"`
+	InfoTTLMs   int64 `json:"infoTtlMs"`
+	Concurrency int   `json:"concurrency"`
+	MaxDepth    int   `json:"maxDepth"`
+	MaxNodes    int   `json:"maxNodes"`
+}
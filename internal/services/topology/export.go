@@ -0,0 +1,111 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+)
+
+const (
+	ExportFormatJSON = "json"
+	ExportFormatDOT  = "dot"
+)
+
+// GraphJSON returns the cached graph under rootID as indented JSON.
+func (s *TopologyService) GraphJSON(rootID uint32) (string, error) {
+	graph, err := s.Graph(rootID)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GraphDOT returns the cached graph under rootID as a Graphviz digraph.
+func (s *TopologyService) GraphDOT(rootID uint32) (string, error) {
+	graph, err := s.Graph(rootID)
+	if err != nil {
+		return "", err
+	}
+	return EncodeDOT(graph), nil
+}
+
+// ExportGraph writes the cached graph under rootID to path. The format comes
+// from the extension: .dot and .gv write DOT, anything else JSON.
+func (s *TopologyService) ExportGraph(rootID uint32, path string) (string, error) {
+	path, err := fleet.ExportPath(path)
+	if err != nil {
+		return "", err
+	}
+	format := ExportFormatJSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dot", ".gv":
+		format = ExportFormatDOT
+	}
+	var text string
+	if format == ExportFormatDOT {
+		text, err = s.GraphDOT(rootID)
+	} else {
+		text, err = s.GraphJSON(rootID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := fleet.WriteFile(path, []byte(text)); err != nil {
+		return "", err
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "topology %d exported as %s path=%s", rootID, format, path)
+	}
+	return format, nil
+}
+
+// EncodeDOT renders a graph for Graphviz. Hubs are drawn as 3D boxes, nodes
+// with errors in red and stale nodes dashed.
+func EncodeDOT(graph TopologyGraph) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph topology_%d {\n", graph.RootID)
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	for _, node := range graph.Nodes {
+		label := fmt.Sprintf("%d", node.NodeID)
+		if app := strings.TrimSpace(node.Items["app"]); app != "" {
+			label += "\n" + app
+		}
+		if platform := strings.TrimSpace(node.Items["platform"]); platform != "" {
+			label += "\n" + platform
+		}
+		attrs := []string{"label=" + dotQuote(label)}
+		if node.IsHub {
+			attrs = append(attrs, "shape=box3d")
+		}
+		if node.NodeID == graph.RootID {
+			attrs = append(attrs, "penwidth=2")
+		}
+		if node.ListError != "" || node.InfoError != "" {
+			attrs = append(attrs, "color=red")
+		}
+		if node.Stale {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(fmt.Sprintf("%d", node.NodeID)), strings.Join(attrs, ", "))
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(fmt.Sprintf("%d", edge.From)), dotQuote(fmt.Sprintf("%d", edge.To)))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "\"" + s + "\""
+}
@@ -0,0 +1,420 @@
+package topology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-proto/protocol/management"
+	"github.com/yttydcs/myflowhub-win/internal/services/fleet"
+	"github.com/yttydcs/myflowhub-win/internal/services/logs"
+	mgmtsvc "github.com/yttydcs/myflowhub-win/internal/services/management"
+)
+
+const (
+	defaultCallTimeout   = 8 * time.Second
+	defaultCrawlTimeout  = 60 * time.Second
+	defaultMaxAgeMs      = 30 * 1000
+	defaultInfoTTLMs     = 5 * 60 * 1000
+	defaultConcurrency   = 8
+	maxConcurrency       = 32
+	defaultMaxDepth      = 16
+	defaultMaxNodes      = 2000
+	maxCachedInfoEntries = 5000
+)
+
+// TopologyService crawls the node tree under a hub with list_nodes and keeps
+// the latest graph per root so the UI can render a full network map without
+// stitching one level at a time.
+type TopologyService struct {
+	management *mgmtsvc.ManagementService
+	logs       *logs.LogService
+	bus        eventbus.IBus
+
+	crawlMu sync.Mutex
+
+	mu     sync.Mutex
+	graphs map[uint32]TopologyGraph
+	info   map[uint32]infoEntry
+}
+
+type infoEntry struct {
+	items map[string]string
+	at    int64
+}
+
+type crawlNode struct {
+	node     TopologyNode
+	hasHint  bool
+	children []uint32
+}
+
+func New(management *mgmtsvc.ManagementService, logsSvc *logs.LogService, bus eventbus.IBus) *TopologyService {
+	return &TopologyService{
+		management: management,
+		logs:       logsSvc,
+		bus:        bus,
+		graphs:     make(map[uint32]TopologyGraph),
+		info:       make(map[uint32]infoEntry),
+	}
+}
+
+// Crawl returns the graph under rootID, reusing a cached crawl younger than
+// opts.MaxAgeMs unless opts.Force is set or the cached crawl lacks the
+// requested NodeInfo items. Crawls are serialized so two pages
+// asking at once share one walk of the network.
+func (s *TopologyService) Crawl(ctx context.Context, sourceID, rootID uint32, opts CrawlOptions) (TopologyGraph, error) {
+	if s.management == nil {
+		return TopologyGraph{}, errors.New("management service not initialized")
+	}
+	if rootID == 0 {
+		return TopologyGraph{}, errors.New("root node is required")
+	}
+	opts = normalizeOptions(opts)
+
+	s.crawlMu.Lock()
+	defer s.crawlMu.Unlock()
+
+	s.mu.Lock()
+	cached, ok := s.graphs[rootID]
+	s.mu.Unlock()
+	if ok && !opts.Force && time.Now().UnixMilli()-cached.CrawledAt < opts.MaxAgeMs && (cached.IncludeInfo || !opts.IncludeInfo) {
+		return cached, nil
+	}
+
+	graph, err := s.crawl(ctx, sourceID, rootID, opts, cached, ok)
+	if err != nil {
+		return TopologyGraph{}, err
+	}
+	// Only full-depth crawls are cached and diffed: a shallower or capped
+	// walk would otherwise report every node beyond its limits as removed.
+	if !fullCrawl(opts) {
+		return graph, nil
+	}
+	s.mu.Lock()
+	s.graphs[rootID] = graph
+	s.mu.Unlock()
+
+	if ok {
+		if change := diffGraphs(cached, graph); hasChanges(change) {
+			if s.logs != nil {
+				s.logs.Appendf("info", "topology %d changed: +%d -%d moved %d", rootID, len(change.Added), len(change.Removed), len(change.Moved))
+			}
+			if s.bus != nil {
+				_ = s.bus.Publish(context.Background(), EventTopologyChanged, change, nil)
+			}
+		}
+	}
+	if s.logs != nil {
+		s.logs.Appendf("info", "topology %d crawled: %d nodes, %d errors (%dms)", rootID, len(graph.Nodes), graph.Errors, graph.DurationMs)
+	}
+	return graph, nil
+}
+
+func (s *TopologyService) CrawlSimple(sourceID, rootID uint32, opts CrawlOptions) (TopologyGraph, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCrawlTimeout)
+	defer cancel()
+	return s.Crawl(ctx, sourceID, rootID, opts)
+}
+
+// Graph returns the last crawl of rootID regardless of its age.
+func (s *TopologyService) Graph(rootID uint32) (TopologyGraph, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	graph, ok := s.graphs[rootID]
+	if !ok {
+		return TopologyGraph{}, fmt.Errorf("no topology for node %d", rootID)
+	}
+	return graph, nil
+}
+
+// Invalidate drops the cached graph and NodeInfo items under rootID so the
+// next Crawl walks the network again. A zero rootID clears everything.
+func (s *TopologyService) Invalidate(rootID uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rootID == 0 {
+		s.graphs = make(map[uint32]TopologyGraph)
+		s.info = make(map[uint32]infoEntry)
+		return nil
+	}
+	if graph, ok := s.graphs[rootID]; ok {
+		for _, node := range graph.Nodes {
+			delete(s.info, node.NodeID)
+		}
+	}
+	delete(s.graphs, rootID)
+	return nil
+}
+
+func (s *TopologyService) crawl(ctx context.Context, sourceID, rootID uint32, opts CrawlOptions, prev TopologyGraph, hasPrev bool) (TopologyGraph, error) {
+	started := time.Now()
+	now := started.UnixMilli()
+	nodes := map[uint32]*crawlNode{
+		rootID: {node: TopologyNode{NodeID: rootID, HubID: rootID}, hasHint: true},
+	}
+	order := []uint32{rootID}
+	failed := make(map[uint32]bool)
+	truncated := false
+
+	level := []uint32{rootID}
+	for depth := 0; len(level) > 0; depth++ {
+		if depth >= opts.MaxDepth {
+			truncated = true
+			break
+		}
+		found := make([][]management.NodeInfo, len(level))
+		errs := make([]error, len(level))
+		fleet.ForEach(ctx, len(level), opts.Concurrency, func(i int) {
+			callCtx, cancel := context.WithTimeout(ctx, defaultCallTimeout)
+			defer cancel()
+			resp, err := s.management.ListNodes(callCtx, sourceID, level[i])
+			found[i], errs[i] = resp.Nodes, err
+		})
+		if ctx.Err() != nil {
+			return TopologyGraph{}, ctx.Err()
+		}
+		var next []uint32
+		for i, parent := range level {
+			if errs[i] != nil {
+				if parent == rootID {
+					return TopologyGraph{}, fmt.Errorf("list nodes of %d: %w", rootID, errs[i])
+				}
+				nodes[parent].node.ListError = errs[i].Error()
+				failed[parent] = true
+				continue
+			}
+			for _, info := range found[i] {
+				if info.NodeID == 0 || info.NodeID == parent {
+					continue
+				}
+				if _, seen := nodes[info.NodeID]; seen {
+					continue
+				}
+				if len(nodes) >= opts.MaxNodes {
+					truncated = true
+					break
+				}
+				nodes[info.NodeID] = &crawlNode{
+					node:    TopologyNode{NodeID: info.NodeID, ParentID: parent, HubID: parent, Depth: depth + 1},
+					hasHint: info.HasChildren,
+				}
+				nodes[parent].children = append(nodes[parent].children, info.NodeID)
+				order = append(order, info.NodeID)
+				if info.HasChildren {
+					next = append(next, info.NodeID)
+				}
+			}
+		}
+		level = next
+	}
+
+	if opts.IncludeInfo {
+		s.fillInfo(ctx, sourceID, nodes, order, opts)
+	}
+
+	prevByID := make(map[uint32]TopologyNode)
+	if hasPrev {
+		for _, node := range prev.Nodes {
+			prevByID[node.NodeID] = node
+		}
+	}
+	graph := TopologyGraph{RootID: rootID, CrawledAt: now, Truncated: truncated, IncludeInfo: opts.IncludeInfo}
+	for _, id := range order {
+		cn := nodes[id]
+		node := cn.node
+		node.Children = append([]uint32{}, cn.children...)
+		sort.Slice(node.Children, func(i, j int) bool { return node.Children[i] < node.Children[j] })
+		node.IsHub = cn.hasHint || len(cn.children) > 0
+		node.FirstSeenAt = now
+		if old, ok := prevByID[id]; ok && old.FirstSeenAt > 0 {
+			node.FirstSeenAt = old.FirstSeenAt
+		}
+		node.LastSeenAt = now
+		if node.ListError != "" || node.InfoError != "" {
+			graph.Errors++
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	// Nodes below a hub whose listing failed are unknown rather than gone.
+	// Carry them over so a flaky link does not look like nodes disappearing
+	// and then reappearing on the next crawl.
+	if len(failed) > 0 {
+		for _, old := range prev.Nodes {
+			if _, ok := nodes[old.NodeID]; ok {
+				continue
+			}
+			if !underFailed(old.NodeID, prevByID, failed) {
+				continue
+			}
+			old.Stale = true
+			graph.Nodes = append(graph.Nodes, old)
+		}
+		present := make(map[uint32]int, len(graph.Nodes))
+		for i, node := range graph.Nodes {
+			present[node.NodeID] = i
+		}
+		for _, node := range graph.Nodes {
+			if !node.Stale {
+				continue
+			}
+			if idx, ok := present[node.ParentID]; ok && !containsNode(graph.Nodes[idx].Children, node.NodeID) {
+				graph.Nodes[idx].Children = append(graph.Nodes[idx].Children, node.NodeID)
+			}
+		}
+	}
+
+	sort.SliceStable(graph.Nodes, func(i, j int) bool {
+		if graph.Nodes[i].Depth != graph.Nodes[j].Depth {
+			return graph.Nodes[i].Depth < graph.Nodes[j].Depth
+		}
+		return graph.Nodes[i].NodeID < graph.Nodes[j].NodeID
+	})
+	graph.Edges = []TopologyEdge{}
+	for _, node := range graph.Nodes {
+		if node.NodeID != rootID && node.ParentID != 0 {
+			graph.Edges = append(graph.Edges, TopologyEdge{From: node.ParentID, To: node.NodeID})
+		}
+	}
+	graph.DurationMs = time.Since(started).Milliseconds()
+	return graph, nil
+}
+
+func (s *TopologyService) fillInfo(ctx context.Context, sourceID uint32, nodes map[uint32]*crawlNode, order []uint32, opts CrawlOptions) {
+	now := time.Now().UnixMilli()
+	var stale []uint32
+	s.mu.Lock()
+	for _, id := range order {
+		entry, ok := s.info[id]
+		if ok && now-entry.at < opts.InfoTTLMs {
+			nodes[id].node.Items = entry.items
+			nodes[id].node.InfoAt = entry.at
+			continue
+		}
+		stale = append(stale, id)
+	}
+	s.mu.Unlock()
+
+	items := make([]map[string]string, len(stale))
+	errs := make([]error, len(stale))
+	fleet.ForEach(ctx, len(stale), opts.Concurrency, func(i int) {
+		callCtx, cancel := context.WithTimeout(ctx, defaultCallTimeout)
+		defer cancel()
+		resp, err := s.management.NodeInfo(callCtx, sourceID, stale[i])
+		items[i], errs[i] = resp.Items, err
+	})
+
+	fetchedAt := time.Now().UnixMilli()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, id := range stale {
+		if errs[i] != nil {
+			nodes[id].node.InfoError = errs[i].Error()
+			if entry, ok := s.info[id]; ok {
+				nodes[id].node.Items = entry.items
+				nodes[id].node.InfoAt = entry.at
+			}
+			continue
+		}
+		if items[i] == nil && errs[i] == nil && ctx.Err() != nil {
+			continue
+		}
+		s.info[id] = infoEntry{items: items[i], at: fetchedAt}
+		nodes[id].node.Items = items[i]
+		nodes[id].node.InfoAt = fetchedAt
+	}
+	if len(s.info) > maxCachedInfoEntries {
+		for id, entry := range s.info {
+			if fetchedAt-entry.at >= opts.InfoTTLMs {
+				delete(s.info, id)
+			}
+		}
+	}
+}
+
+func diffGraphs(prev, next TopologyGraph) TopologyChange {
+	change := TopologyChange{RootID: next.RootID, At: next.CrawledAt, Nodes: len(next.Nodes), Added: []uint32{}, Removed: []uint32{}, Moved: []TopologyMove{}}
+	before := make(map[uint32]TopologyNode, len(prev.Nodes))
+	for _, node := range prev.Nodes {
+		before[node.NodeID] = node
+	}
+	after := make(map[uint32]bool, len(next.Nodes))
+	for _, node := range next.Nodes {
+		after[node.NodeID] = true
+		old, ok := before[node.NodeID]
+		if !ok {
+			change.Added = append(change.Added, node.NodeID)
+			continue
+		}
+		if old.ParentID != node.ParentID {
+			change.Moved = append(change.Moved, TopologyMove{NodeID: node.NodeID, FromParent: old.ParentID, ToParent: node.ParentID})
+		}
+	}
+	for _, node := range prev.Nodes {
+		if !after[node.NodeID] {
+			change.Removed = append(change.Removed, node.NodeID)
+		}
+	}
+	sort.Slice(change.Added, func(i, j int) bool { return change.Added[i] < change.Added[j] })
+	sort.Slice(change.Removed, func(i, j int) bool { return change.Removed[i] < change.Removed[j] })
+	sort.Slice(change.Moved, func(i, j int) bool { return change.Moved[i].NodeID < change.Moved[j].NodeID })
+	return change
+}
+
+func hasChanges(change TopologyChange) bool {
+	return len(change.Added) > 0 || len(change.Removed) > 0 || len(change.Moved) > 0
+}
+
+func underFailed(id uint32, byID map[uint32]TopologyNode, failed map[uint32]bool) bool {
+	for guard := 0; guard < defaultMaxNodes; guard++ {
+		node, ok := byID[id]
+		if !ok || node.ParentID == 0 {
+			return false
+		}
+		if failed[node.ParentID] {
+			return true
+		}
+		id = node.ParentID
+	}
+	return false
+}
+
+func containsNode(list []uint32, id uint32) bool {
+	for _, v := range list {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func fullCrawl(opts CrawlOptions) bool {
+	return opts.MaxDepth >= defaultMaxDepth && opts.MaxNodes >= defaultMaxNodes
+}
+
+func normalizeOptions(opts CrawlOptions) CrawlOptions {
+	if opts.MaxAgeMs <= 0 {
+		opts.MaxAgeMs = defaultMaxAgeMs
+	}
+	if opts.InfoTTLMs <= 0 {
+		opts.InfoTTLMs = defaultInfoTTLMs
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.Concurrency > maxConcurrency {
+		opts.Concurrency = maxConcurrency
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultMaxDepth
+	}
+	if opts.MaxNodes <= 0 {
+		opts.MaxNodes = defaultMaxNodes
+	}
+	return opts
+}
@@ -96,5 +96,6 @@ func (s *VarPoolService) publishVarEvent(name string, raw json.RawMessage) {
 	if out.Name == "" || out.Owner == 0 {
 		return
 	}
+	s.observePolled(name, out)
 	_ = s.bus.Publish(context.Background(), name, out, nil)
 }
@@ -0,0 +1,361 @@
+package varpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/varstore"
+)
+
+const (
+	defaultPollInterval = time.Second
+	minPollInterval     = 200 * time.Millisecond
+	maxPollBackoff      = 16
+)
+
+type PollReq struct {
+	Name          string `json:"name"`
+	Owner         uint32 `json:"owner"`
+	IntervalMs    int    `json:"intervalMs"`
+	MaxIntervalMs int    `json:"maxIntervalMs"`
+}
+
+type PollStatus struct {
+	WatchID       string    `json:"watchId"`
+	Name          string    `json:"name"`
+	Owner         uint32    `json:"owner"`
+	IntervalMs    int       `json:"intervalMs"`
+	MaxIntervalMs int       `json:"maxIntervalMs"`
+	CurrentMs     int       `json:"currentMs"`
+	Watchers      int       `json:"watchers"`
+	Value         string    `json:"value"`
+	Exists        bool      `json:"exists"`
+	Polls         int       `json:"polls"`
+	Changes       int       `json:"changes"`
+	Errors        int       `json:"errors"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastPolledAt  time.Time `json:"lastPolledAt"`
+	LastChangedAt time.Time `json:"lastChangedAt"`
+}
+
+type pollKey struct {
+	owner uint32
+	name  string
+}
+
+type pollWatch struct {
+	id          string
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+// varPoller is shared by every watch on the same (owner, name); it runs at the
+// shortest interval requested by its watches.
+type varPoller struct {
+	key      pollKey
+	sourceID uint32
+	targetID uint32
+	watches  map[string]pollWatch
+	cancel   context.CancelFunc
+	// rearm wakes the poll loop when a joining watch shortens the interval.
+	rearm chan struct{}
+
+	current       time.Duration
+	hasValue      bool
+	last          varstore.VarResp
+	polls         int
+	changes       int
+	errors        int
+	lastError     string
+	lastPolledAt  time.Time
+	lastChangedAt time.Time
+}
+
+// StartPoll watches a variable by issuing Get periodically, for owners that never
+// emit notify_set. The interval backs off (up to MaxIntervalMs) while the value is
+// unchanged and resets on change; varpool.changed is published only on real changes.
+// Watches of the same variable share one poller and must use the same route.
+func (s *VarPoolService) StartPoll(sourceID, targetID uint32, req PollReq) (PollStatus, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return PollStatus{}, errors.New("name is required")
+	}
+	if req.Owner == 0 {
+		return PollStatus{}, errors.New("owner is required")
+	}
+	if s.session == nil {
+		return PollStatus{}, errors.New("session service not initialized")
+	}
+	interval := time.Duration(req.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if interval < minPollInterval {
+		interval = minPollInterval
+	}
+	maxInterval := time.Duration(req.MaxIntervalMs) * time.Millisecond
+	if maxInterval <= 0 {
+		maxInterval = interval * maxPollBackoff
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	key := pollKey{owner: req.Owner, name: req.Name}
+
+	s.mu.Lock()
+	if s.pollers == nil {
+		s.pollers = make(map[pollKey]*varPoller)
+		s.pollIndex = make(map[string]pollKey)
+	}
+	p := s.pollers[key]
+	if p != nil && (p.sourceID != sourceID || p.targetID != targetID) {
+		s.mu.Unlock()
+		return PollStatus{}, fmt.Errorf("%s of %d is already polled via source %d target %d", key.name, key.owner, p.sourceID, p.targetID)
+	}
+	s.pollSeq++
+	watch := pollWatch{id: fmt.Sprintf("poll-%d", s.pollSeq), interval: interval, maxInterval: maxInterval}
+	s.pollIndex[watch.id] = key
+	if p != nil {
+		p.watches[watch.id] = watch
+		if interval < p.current {
+			p.current = interval
+			select {
+			case p.rearm <- struct{}{}:
+			default:
+			}
+		}
+		status := p.statusLocked(watch)
+		s.mu.Unlock()
+		return status, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p = &varPoller{
+		key:      key,
+		sourceID: sourceID,
+		targetID: targetID,
+		watches:  map[string]pollWatch{watch.id: watch},
+		cancel:   cancel,
+		rearm:    make(chan struct{}, 1),
+		current:  interval,
+	}
+	s.pollers[key] = p
+	status := p.statusLocked(watch)
+	s.mu.Unlock()
+
+	go s.runPoller(ctx, p)
+	if s.logs != nil {
+		s.logs.Appendf("info", "varpool poll started name=%s owner=%d interval=%s", key.name, key.owner, interval)
+	}
+	return status, nil
+}
+
+func (s *VarPoolService) StopPoll(watchID string) error {
+	watchID = strings.TrimSpace(watchID)
+	s.mu.Lock()
+	key, ok := s.pollIndex[watchID]
+	if !ok {
+		s.mu.Unlock()
+		return errors.New("poll watch not found")
+	}
+	delete(s.pollIndex, watchID)
+	p := s.pollers[key]
+	var cancel context.CancelFunc
+	if p != nil {
+		delete(p.watches, watchID)
+		if len(p.watches) == 0 {
+			delete(s.pollers, key)
+			cancel = p.cancel
+		}
+	}
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		if s.logs != nil {
+			s.logs.Appendf("info", "varpool poll stopped name=%s owner=%d", key.name, key.owner)
+		}
+	}
+	return nil
+}
+
+func (s *VarPoolService) Polls() ([]PollStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]PollStatus, 0, len(s.pollIndex))
+	for id, key := range s.pollIndex {
+		p := s.pollers[key]
+		if p == nil {
+			continue
+		}
+		out = append(out, p.statusLocked(p.watches[id]))
+	}
+	return out, nil
+}
+
+func (s *VarPoolService) stopAllPolls() {
+	s.mu.Lock()
+	pollers := s.pollers
+	s.pollers = nil
+	s.pollIndex = nil
+	s.mu.Unlock()
+	for _, p := range pollers {
+		p.cancel()
+	}
+}
+
+func (s *VarPoolService) runPoller(ctx context.Context, p *varPoller) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.rearm:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(s.untilNextPoll(p))
+			continue
+		case <-timer.C:
+		}
+		callCtx, cancel := context.WithTimeout(ctx, defaultVarPoolTimeout)
+		resp, err := s.Get(callCtx, p.sourceID, p.targetID, varstore.GetReq{Name: p.key.name, Owner: p.key.owner})
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		timer.Reset(s.applyPollResult(p, resp, err))
+	}
+}
+
+// untilNextPoll is the delay left until the next poll at the current interval.
+func (s *VarPoolService) untilNextPoll(p *varPoller) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := time.Until(p.lastPolledAt.Add(p.current))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// applyPollResult records one poll and returns the delay until the next one.
+func (s *VarPoolService) applyPollResult(p *varPoller, resp varstore.VarResp, err error) time.Duration {
+	now := time.Now()
+	evtName := ""
+	var evt varstore.VarResp
+
+	s.mu.Lock()
+	p.polls++
+	p.lastPolledAt = now
+	changed := false
+	switch {
+	case err == nil:
+		p.lastError = ""
+		resp.Name = p.key.name
+		resp.Owner = p.key.owner
+		if !p.hasValue || !sameVar(p.last, resp) {
+			changed = p.hasValue
+			p.hasValue = true
+			p.last = resp
+			if changed {
+				evtName, evt = EventVarPoolChanged, resp
+			}
+		}
+	case isNotFound(err):
+		p.lastError = ""
+		if p.hasValue {
+			changed = true
+			p.hasValue = false
+			evtName, evt = EventVarPoolDeleted, varstore.VarResp{Code: 1, Name: p.key.name, Owner: p.key.owner}
+		}
+	default:
+		p.errors++
+		p.lastError = err.Error()
+	}
+	base, maxInterval := p.boundsLocked()
+	if changed {
+		p.changes++
+		p.lastChangedAt = now
+		p.current = base
+	} else {
+		p.current *= 2
+		if p.current > maxInterval {
+			p.current = maxInterval
+		}
+	}
+	next := p.current
+	s.mu.Unlock()
+
+	if evtName != "" && s.bus != nil {
+		_ = s.bus.Publish(context.Background(), evtName, evt, nil)
+	}
+	return next
+}
+
+// observePolled keeps pollers in sync with notify frames so a value already
+// announced by the owner is not re-emitted by the next poll.
+func (s *VarPoolService) observePolled(evtName string, resp varstore.VarResp) {
+	key := pollKey{owner: resp.Owner, name: resp.Name}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pollers[key]
+	if p == nil {
+		return
+	}
+	switch evtName {
+	case EventVarPoolChanged:
+		p.hasValue = true
+		p.last = resp
+	case EventVarPoolDeleted:
+		p.hasValue = false
+	}
+}
+
+func (p *varPoller) boundsLocked() (time.Duration, time.Duration) {
+	var base, maxInterval time.Duration
+	for _, w := range p.watches {
+		if base == 0 || w.interval < base {
+			base = w.interval
+		}
+		if maxInterval == 0 || w.maxInterval < maxInterval {
+			maxInterval = w.maxInterval
+		}
+	}
+	if base == 0 {
+		base = defaultPollInterval
+	}
+	if maxInterval < base {
+		maxInterval = base
+	}
+	return base, maxInterval
+}
+
+func (p *varPoller) statusLocked(w pollWatch) PollStatus {
+	return PollStatus{
+		WatchID:       w.id,
+		Name:          p.key.name,
+		Owner:         p.key.owner,
+		IntervalMs:    int(w.interval / time.Millisecond),
+		MaxIntervalMs: int(w.maxInterval / time.Millisecond),
+		CurrentMs:     int(p.current / time.Millisecond),
+		Watchers:      len(p.watches),
+		Value:         p.last.Value,
+		Exists:        p.hasValue,
+		Polls:         p.polls,
+		Changes:       p.changes,
+		Errors:        p.errors,
+		LastError:     p.lastError,
+		LastPolledAt:  p.lastPolledAt,
+		LastChangedAt: p.lastChangedAt,
+	}
+}
+
+func sameVar(a, b varstore.VarResp) bool {
+	return a.Value == b.Value && a.Type == b.Type && a.Visibility == b.Visibility
+}
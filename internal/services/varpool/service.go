@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	corebus "github.com/yttydcs/myflowhub-core/eventbus"
@@ -23,6 +24,11 @@ type VarPoolService struct {
 	bus     corebus.IBus
 
 	busTokens []busToken
+
+	mu        sync.Mutex
+	pollers   map[pollKey]*varPoller
+	pollIndex map[string]pollKey
+	pollSeq   uint64
 }
 
 func New(session *sessionsvc.SessionService, logsSvc *logs.LogService, bus corebus.IBus) *VarPoolService {
@@ -33,6 +39,7 @@ func New(session *sessionsvc.SessionService, logsSvc *logs.LogService, bus coreb
 
 func (s *VarPoolService) Close() {
 	s.unbindBus()
+	s.stopAllPolls()
 }
 
 func (s *VarPoolService) Set(ctx context.Context, sourceID, targetID uint32, req varstore.SetReq) (varstore.VarResp, error) {
@@ -197,12 +204,12 @@ func (s *VarPoolService) sendAndAwait(ctx context.Context, sourceID, targetID ui
 			if s.logs != nil {
 				s.logs.Appendf("warn", "varpool %s failed (code=%d msg=%q)", trimmedAction, out.Code, msg)
 			}
-			return varstore.VarResp{}, fmt.Errorf("%s (code=%d)", msg, out.Code)
+			return varstore.VarResp{}, &respError{code: out.Code, msg: msg}
 		}
 		if s.logs != nil {
 			s.logs.Appendf("warn", "varpool %s failed (code=%d)", trimmedAction, out.Code)
 		}
-		return varstore.VarResp{}, fmt.Errorf("varpool %s failed (code=%d)", trimmedAction, out.Code)
+		return varstore.VarResp{}, &respError{code: out.Code, msg: fmt.Sprintf("varpool %s failed", trimmedAction)}
 	}
 	if s.logs != nil {
 		if trimmedName != "" {
@@ -214,6 +221,25 @@ func (s *VarPoolService) sendAndAwait(ctx context.Context, sourceID, targetID ui
 	return out, nil
 }
 
+// respError carries the code of a non-ok VarResp so callers can tell
+// "not found" apart from transport failures.
+type respError struct {
+	code int
+	msg  string
+}
+
+func (e *respError) Error() string {
+	return fmt.Sprintf("%s (code=%d)", e.msg, e.code)
+}
+
+func isNotFound(err error) bool {
+	var re *respError
+	if !errors.As(err, &re) {
+		return false
+	}
+	return re.code == 404 || strings.Contains(strings.ToLower(re.msg), "not found")
+}
+
 func toUIError(err error) error {
 	if err == nil {
 		return nil
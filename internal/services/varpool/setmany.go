@@ -0,0 +1,166 @@
+package varpool
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/yttydcs/myflowhub-proto/protocol/varstore"
+)
+
+const (
+	setManyStatusApplied        = "applied"
+	setManyStatusFailed         = "failed"
+	setManyStatusSkipped        = "skipped"
+	setManyStatusRolledBack     = "rolled_back"
+	setManyStatusRollbackFailed = "rollback_failed"
+)
+
+type SetManyOutcome struct {
+	Name          string `json:"name"`
+	Owner         uint32 `json:"owner,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	PrevExisted   bool   `json:"prevExisted"`
+	PrevValue     string `json:"prevValue,omitempty"`
+	RollbackError string `json:"rollbackError,omitempty"`
+}
+
+type SetManyResult struct {
+	OK         bool             `json:"ok"`
+	FailedAt   int              `json:"failedAt"`
+	RolledBack bool             `json:"rolledBack"`
+	Items      []SetManyOutcome `json:"items"`
+}
+
+type setManyPrior struct {
+	existed bool
+	resp    varstore.VarResp
+}
+
+// SetMany applies reqs in order. Prior values are captured with Get first; if
+// any Set fails, the already applied variables are restored in reverse order
+// (re-set to the captured value, or revoked when they did not exist before).
+// The failed variable is restored too unless the owner definitely rejected
+// it, since a timed out Set may still have been applied. The rollback is
+// best-effort and its outcome is reported per variable.
+func (s *VarPoolService) SetMany(ctx context.Context, sourceID, targetID uint32, reqs []varstore.SetReq) (SetManyResult, error) {
+	if len(reqs) == 0 {
+		return SetManyResult{}, errors.New("reqs are required")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	reqs = append([]varstore.SetReq(nil), reqs...)
+	result := SetManyResult{FailedAt: -1, Items: make([]SetManyOutcome, len(reqs))}
+	for i := range reqs {
+		reqs[i].Name = strings.TrimSpace(reqs[i].Name)
+		if reqs[i].Name == "" {
+			return SetManyResult{}, errors.New("name is required")
+		}
+		result.Items[i] = SetManyOutcome{Name: reqs[i].Name, Owner: reqs[i].Owner, Status: setManyStatusSkipped}
+	}
+
+	priors := make([]setManyPrior, len(reqs))
+	for i, req := range reqs {
+		resp, err := s.getWithTimeout(ctx, sourceID, targetID, varstore.GetReq{Name: req.Name, Owner: req.Owner})
+		switch {
+		case err == nil:
+			priors[i] = setManyPrior{existed: true, resp: resp}
+			result.Items[i].PrevExisted = true
+			result.Items[i].PrevValue = resp.Value
+		case isNotFound(err):
+			priors[i] = setManyPrior{}
+		default:
+			// Without a known prior value the set could not be undone, so nothing is applied.
+			result.FailedAt = i
+			result.Items[i].Status = setManyStatusFailed
+			result.Items[i].Error = "capture prior value: " + err.Error()
+			return result, nil
+		}
+	}
+
+	for i, req := range reqs {
+		setCtx, cancel := context.WithTimeout(ctx, defaultVarPoolTimeout)
+		_, err := s.Set(setCtx, sourceID, targetID, req)
+		cancel()
+		if err == nil {
+			result.Items[i].Status = setManyStatusApplied
+			continue
+		}
+		result.FailedAt = i
+		result.Items[i].Status = setManyStatusFailed
+		result.Items[i].Error = err.Error()
+		undo := i
+		if !isRejected(err) {
+			undo = i + 1
+		}
+		result.RolledBack = s.rollbackSetMany(ctx, sourceID, targetID, reqs[:undo], priors[:undo], result.Items[:undo])
+		if s.logs != nil {
+			s.logs.Appendf("warn", "varpool set_many failed at %d/%d name=%s rolled_back=%t", i+1, len(reqs), req.Name, result.RolledBack)
+		}
+		return result, nil
+	}
+
+	result.OK = true
+	if s.logs != nil {
+		s.logs.Appendf("info", "varpool set_many ok count=%d", len(reqs))
+	}
+	return result, nil
+}
+
+func (s *VarPoolService) SetManySimple(sourceID, targetID uint32, reqs []varstore.SetReq) (SetManyResult, error) {
+	return s.SetMany(context.Background(), sourceID, targetID, reqs)
+}
+
+func (s *VarPoolService) rollbackSetMany(ctx context.Context, sourceID, targetID uint32, reqs []varstore.SetReq, priors []setManyPrior, items []SetManyOutcome) bool {
+	// Compensation must still run when the caller's context was canceled mid-way.
+	ctx = context.WithoutCancel(ctx)
+	ok := true
+	for i := len(reqs) - 1; i >= 0; i-- {
+		var err error
+		callCtx, cancel := context.WithTimeout(ctx, defaultVarPoolTimeout)
+		if priors[i].existed {
+			prev := priors[i].resp
+			restore := varstore.SetReq{
+				Name:       reqs[i].Name,
+				Value:      prev.Value,
+				Visibility: prev.Visibility,
+				Type:       prev.Type,
+				Owner:      reqs[i].Owner,
+			}
+			if strings.TrimSpace(restore.Visibility) == "" {
+				restore.Visibility = reqs[i].Visibility
+			}
+			_, err = s.Set(callCtx, sourceID, targetID, restore)
+		} else {
+			_, err = s.Revoke(callCtx, sourceID, targetID, varstore.GetReq{Name: reqs[i].Name, Owner: reqs[i].Owner})
+			if isNotFound(err) {
+				// The variable is already absent, e.g. the failed Set never applied.
+				err = nil
+			}
+		}
+		cancel()
+		if err != nil {
+			ok = false
+			items[i].Status = setManyStatusRollbackFailed
+			items[i].RollbackError = err.Error()
+			continue
+		}
+		items[i].Status = setManyStatusRolledBack
+	}
+	return ok
+}
+
+// isRejected reports whether err is a reply from the owner, i.e. the Set
+// definitely did not apply.
+func isRejected(err error) bool {
+	var re *respError
+	return errors.As(err, &re)
+}
+
+func (s *VarPoolService) getWithTimeout(ctx context.Context, sourceID, targetID uint32, req varstore.GetReq) (varstore.VarResp, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultVarPoolTimeout)
+	defer cancel()
+	return s.Get(callCtx, sourceID, targetID, req)
+}
@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const dataDirName = "data"
+
+// DataDir returns the per-profile directory for local service data (records,
+// history, snapshots). The directory is not created.
+func (s *Store) DataDir(profile, name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if strings.TrimSpace(s.baseDir) == "" {
+		return ""
+	}
+	profileDir := defaultProfile
+	if !isDefaultProfile(profile) {
+		profileDir = sanitizeProfileName(profile)
+	}
+	return filepath.Join(s.baseDir, dataDirName, profileDir, filepath.Clean(strings.TrimSpace(name)))
+}